@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"os"
 
@@ -12,12 +13,15 @@ func main() {
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Error loading config: %v", err)
+		log.Printf("Error loading config: %v", err)
+		os.Exit(cmd.ExitError)
 	}
 
 	// Execute command with configuration
 	if err := cmd.Execute(cfg); err != nil {
-		log.Printf("Error executing command: %v", err)
-		os.Exit(1)
+		if !errors.Is(err, cmd.ErrDrift) {
+			log.Printf("Error executing command: %v", err)
+		}
+		os.Exit(cmd.ExitCode(err))
 	}
 }
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+// Authorizer narrows the manager serving a request to what the
+// authenticated caller is allowed to do
+type Authorizer func(manager k8s.SecretManager, identity *api.Identity) (k8s.SecretManager, error)
+
+// WithAuthorizer authorizes every secret operation with authorize. Requests
+// without an identity are rejected, so it needs authentication in front.
+func WithAuthorizer(authorize Authorizer) Option {
+	return func(h *Handler) {
+		h.authorize = authorize
+	}
+}
+
+// AccessReview checks each operation with a SubjectAccessReview for the
+// verb, namespace and name of the secret on the cluster serving it
+func AccessReview(manager k8s.SecretManager, identity *api.Identity) (k8s.SecretManager, error) {
+	reviewer, ok := manager.(k8s.AccessReviewer)
+	if !ok {
+		return nil, apperrors.New(apperrors.CodeNotImplemented, "access reviews are not supported by this backend")
+	}
+	return k8s.NewAccessReviewManager(manager, reviewer, userInfo(identity)), nil
+}
+
+// Impersonate serves the request with a client impersonating the caller, so
+// that the API server enforces its RBAC rules
+func Impersonate(manager k8s.SecretManager, identity *api.Identity) (k8s.SecretManager, error) {
+	impersonator, ok := manager.(k8s.Impersonator)
+	if !ok {
+		return nil, apperrors.New(apperrors.CodeNotImplemented, "impersonation is not supported by this backend")
+	}
+	return impersonator.Impersonate(userInfo(identity))
+}
+
+func userInfo(identity *api.Identity) authenticationv1.UserInfo {
+	return authenticationv1.UserInfo{Username: identity.Username, UID: identity.UID, Groups: identity.Groups}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	"github.com/mpalu/k8s-secrets-manager/internal/backup"
+	"github.com/mpalu/k8s-secrets-manager/internal/crypto"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/logging"
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
+)
+
+// BackupRequest is the body of POST /api/v1/admin/backup. The archive is
+// encrypted with Passphrase or to the age Recipients.
+type BackupRequest struct {
+	Namespaces    []string `json:"namespaces,omitempty"`
+	LabelSelector string   `json:"labelSelector,omitempty"`
+	Passphrase    string   `json:"passphrase,omitempty"`
+	Recipients    []string `json:"recipients,omitempty"`
+}
+
+// Backup streams an encrypted archive of the selected secrets. Archives
+// carry values, so they need the reveal permission.
+func (h *Handler) Backup(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	var req BackupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.WriteErrorResponse(w, apperrors.CodeBadRequest, "invalid request body", err.Error())
+		return
+	}
+	recipients, err := crypto.Recipients(req.Passphrase, req.Recipients)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	if !h.reveal(w, r, strings.Join(req.Namespaces, ","), "", "") {
+		return
+	}
+
+	filename := fmt.Sprintf("secrets-%s.tar.gz.age", time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Once streaming started an error can only cut the archive short, which
+	// restore detects
+	if _, err := backup.Backup(r.Context(), client, w, recipients, backup.Options{
+		Namespaces:    req.Namespaces,
+		LabelSelector: req.LabelSelector,
+	}); err != nil {
+		logging.GetLogger().Error().Err(err).Msg("backup failed")
+	}
+}
+
+// defaultMaxRestoreSize bounds the archives Restore accepts
+const defaultMaxRestoreSize = 256 << 20
+
+// Restore restores the archive in the request body. The passphrase or age
+// identity travels in the X-Backup-Passphrase or X-Backup-Identity header.
+// ?namespaces= restricts the restore, ?namespaceMap=from=to,... renames
+// namespaces, ?conflict= is skip (default), overwrite or fail and
+// ?dryRun=true only reports what would be restored. Like Backup it needs
+// the reveal permission.
+func (h *Handler) Restore(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	if !h.reveal(w, r, query.Get("namespaces"), "", "") {
+		return
+	}
+	var keys io.Reader
+	if identity := r.Header.Get("X-Backup-Identity"); identity != "" {
+		keys = strings.NewReader(identity)
+	}
+	identities, err := crypto.Identities(r.Header.Get("X-Backup-Passphrase"), keys)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	conflict, err := secretio.ParseConflictPolicy(queryDefault(r, "conflict", string(secretio.ConflictSkip)))
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	namespaceMap, err := backup.ParseNamespaceMap(query.Get("namespaceMap"))
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	dryRun, _ := strconv.ParseBool(query.Get("dryRun"))
+
+	opts := backup.RestoreOptions{NamespaceMap: namespaceMap, Conflict: conflict, DryRun: dryRun}
+	if namespaces := query.Get("namespaces"); namespaces != "" {
+		opts.Namespaces = strings.Split(namespaces, ",")
+	}
+
+	// The archive is decrypted whole before the first write anyway
+	archive, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxRestoreSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			api.WriteErrorResponse(w, apperrors.CodeTooLarge, "archive too large",
+				fmt.Sprintf("archives are limited to %d bytes", tooLarge.Limit))
+			return
+		}
+		api.WriteErrorResponse(w, apperrors.CodeBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	result, err := backup.Restore(r.Context(), client, bytes.NewReader(archive), identities, opts)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, result)
+}
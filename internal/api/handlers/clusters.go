@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+)
+
+// ListClusters reports every registered cluster and whether its API server
+// currently answers. Clusters are probed concurrently so a single unreachable
+// cluster only costs one client timeout.
+func (h *Handler) ListClusters(w http.ResponseWriter, r *http.Request) {
+	names := h.clusters.Names()
+	statuses := make([]api.ClusterStatus, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		statuses[i] = api.ClusterStatus{
+			Name:    name,
+			Default: name == h.clusters.Default(),
+		}
+
+		client, err := h.clusters.Get(name)
+		if err != nil {
+			statuses[i].Error = err.Error()
+			continue
+		}
+
+		checker, ok := client.(k8s.HealthChecker)
+		if !ok {
+			// Managers without a remote API server are always reachable
+			statuses[i].Reachable = true
+			continue
+		}
+
+		wg.Add(1)
+		go func(status *api.ClusterStatus) {
+			defer wg.Done()
+			version, err := checker.ServerVersion()
+			if err != nil {
+				status.Error = err.Error()
+				return
+			}
+			status.Reachable = true
+			status.Version = version
+		}(&statuses[i])
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
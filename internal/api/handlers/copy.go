@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/replication"
+)
+
+// CopySecret copies a secret to another namespace and/or name
+func (h *Handler) CopySecret(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	var req replication.CopyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.WriteErrorResponse(w, apperrors.CodeBadRequest, "invalid request body", err.Error())
+		return
+	}
+	vars := mux.Vars(r)
+	req.Namespace, req.Name = vars["namespace"], vars["name"]
+
+	secret, err := replication.Copy(r.Context(), client, &req)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(secret.ResourceVersion))
+	api.WriteJSON(w, http.StatusCreated, api.NewSecretView(secret, false))
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	"github.com/mpalu/k8s-secrets-manager/internal/diff"
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
+)
+
+// Diff compares the secret definitions of the request body in ?format=
+// (secretdata by default) with the cluster. ?namespace= applies to
+// definitions without one and ?name= names env input. Values are shown as
+// hashes unless ?reveal=true and revealing is allowed for every secret.
+func (h *Handler) Diff(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	format, err := secretio.ParseFormat(queryDefault(r, "format", string(secretio.FormatSecretData)))
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	desired, err := secretio.Read(r.Body, secretio.ImportOptions{
+		Namespace:  queryDefault(r, "namespace", "default"),
+		Name:       query.Get("name"),
+		Type:       query.Get("type"),
+		Format:     format,
+		Identities: h.identities,
+	})
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	opts := diff.Options{Reveal: revealRequested(r)}
+	if opts.Reveal {
+		for _, secret := range desired {
+			if !h.reveal(w, r, secret.Namespace, secret.Name, "") {
+				return
+			}
+		}
+	}
+
+	results, err := diff.Secrets(r.Context(), client, desired, opts)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, api.DiffResponse{Drift: diff.Drift(results), Secrets: results})
+}
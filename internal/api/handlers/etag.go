@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// etag formats a resourceVersion as a strong entity tag
+func etag(resourceVersion string) string {
+	return `"` + resourceVersion + `"`
+}
+
+// ifMatch returns the resourceVersion an If-Match header requires. A missing
+// header or "*" yields an empty version, i.e. no precondition beyond the
+// secret existing.
+func ifMatch(r *http.Request) (resourceVersion string, present bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return "", false
+	}
+	if header == "*" {
+		return "", true
+	}
+
+	// Only a single tag is meaningful for a single resource
+	tag := strings.TrimSpace(strings.Split(header, ",")[0])
+	tag = strings.TrimPrefix(tag, "W/")
+	return strings.Trim(tag, `"`), true
+}
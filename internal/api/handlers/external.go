@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/external"
+)
+
+// ExternalStatusReporter reports the state of the external secret sync
+type ExternalStatusReporter interface {
+	Status() []external.Status
+}
+
+// WithExternalStatus serves the status of the external secret sync
+func WithExternalStatus(reporter ExternalStatusReporter) Option {
+	return func(h *Handler) {
+		h.external = reporter
+	}
+}
+
+// ExternalStatus lists the sync status of every external secret mapping.
+// Values are never part of it.
+func (h *Handler) ExternalStatus(w http.ResponseWriter, r *http.Request) {
+	if h.external == nil {
+		api.WriteError(w, apperrors.New(apperrors.CodeNotImplemented, "external secret sync is not enabled"))
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, h.external.Status())
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/generate"
+)
+
+// WithGenerators replaces the built-in generators used by GenerateSecret
+func WithGenerators(generators *generate.Registry) Option {
+	return func(h *Handler) {
+		h.generators = generators
+	}
+}
+
+// GenerateSecret creates a secret, or adds keys to an existing one, with
+// server side generated values. The values are never returned.
+func (h *Handler) GenerateSecret(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	var req generate.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.WriteErrorResponse(w, apperrors.CodeBadRequest, "invalid request body", err.Error())
+		return
+	}
+	vars := mux.Vars(r)
+	req.Namespace, req.Name = vars["namespace"], vars["name"]
+
+	result, err := h.generators.GenerateSecret(r.Context(), client, &req)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if result.Created {
+		status = http.StatusCreated
+	}
+	w.Header().Set("ETag", etag(result.Secret.ResourceVersion))
+	api.WriteJSON(w, status, api.GenerateResponse{
+		Keys:   result.Keys,
+		Secret: api.NewSecretView(result.Secret, false),
+	})
+}
@@ -3,34 +3,95 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
+	"filippo.io/age"
 	"github.com/gorilla/mux"
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/generate"
 	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/policy"
 	"github.com/mpalu/k8s-secrets-manager/internal/validator"
+	"github.com/rs/zerolog"
 )
 
 type Handler struct {
-	client k8s.SecretManager
+	clusters        *k8s.Registry
+	authorizeReveal RevealAuthorizer
+	authorize       Authorizer
+	audit           *zerolog.Logger
+	generators      *generate.Registry
+	identities      []age.Identity
+	external        ExternalStatusReporter
+	policy          *policy.Policy
+	maxRestoreSize  int64
 }
 
-func NewHandler(client k8s.SecretManager) *Handler {
-	return &Handler{client: client}
+// NewHandler serves a single cluster backed by client
+func NewHandler(client k8s.SecretManager, opts ...Option) *Handler {
+	clusters := k8s.NewRegistry()
+	clusters.Register(k8s.DefaultClusterName, client)
+	return NewClusterHandler(clusters, opts...)
+}
+
+// NewClusterHandler serves every cluster of the registry. Requests pick a
+// cluster through the {cluster} route variable and fall back to the default.
+func NewClusterHandler(clusters *k8s.Registry, opts ...Option) *Handler {
+	nop := zerolog.Nop()
+	h := &Handler{clusters: clusters, audit: &nop, generators: generate.NewRegistry(), maxRestoreSize: defaultMaxRestoreSize}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// manager resolves the SecretManager for the cluster addressed by r,
+// authorized for its caller and enforcing the policy. When it returns false
+// an error response has already been written.
+func (h *Handler) manager(w http.ResponseWriter, r *http.Request) (k8s.SecretManager, bool) {
+	client, err := h.clusters.Get(mux.Vars(r)["cluster"])
+	if err != nil {
+		api.WriteError(w, err)
+		return nil, false
+	}
+	if h.authorize != nil {
+		identity := api.IdentityFrom(r.Context())
+		if identity == nil {
+			api.WriteErrorResponse(w, apperrors.CodeUnauthorized, "authentication required", "")
+			return nil, false
+		}
+		client, err = h.authorize(client, identity)
+		if err != nil {
+			api.WriteError(w, err)
+			return nil, false
+		}
+	}
+	if h.policy != nil {
+		client = policy.Enforce(client, h.policy)
+	}
+	return client, true
 }
 
 func (h *Handler) CreateSecret(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
 	var secretData k8s.SecretData
 	if err := json.NewDecoder(r.Body).Decode(&secretData); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		api.WriteErrorResponse(w, apperrors.CodeBadRequest, "invalid request body", err.Error())
 		return
 	}
 
 	if err := validator.ValidateSecretData(&secretData); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		api.WriteError(w, err)
 		return
 	}
 
-	if err := h.client.CreateSecret(r.Context(), &secretData); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := client.CreateSecret(r.Context(), &secretData); err != nil {
+		api.WriteError(w, err)
 		return
 	}
 
@@ -43,78 +104,183 @@ func (h *Handler) CreateSecret(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) GetSecret(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	name := vars["name"]
-	namespace := vars["namespace"]
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	name, namespace := secretRef(r)
 
 	// Check if required parameters are present
 	if name == "" || namespace == "" {
-		http.Error(w, "name and namespace are required", http.StatusBadRequest)
+		api.WriteErrorResponse(w, apperrors.CodeBadRequest, "name and namespace are required", "")
 		return
 	}
 
-	secret, err := h.client.GetSecret(r.Context(), namespace, name)
+	reveal := revealRequested(r)
+	if reveal && !h.reveal(w, r, namespace, name, "") {
+		return
+	}
+
+	secret, err := client.GetSecret(r.Context(), namespace, name)
 	if err != nil {
-		// Handle not found errors separately from internal errors
-		if err.Error() == "secret not found" {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		api.WriteError(w, err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(secret)
+	w.Header().Set("ETag", etag(secret.ResourceVersion))
+	if reveal {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	api.WriteJSON(w, http.StatusOK, api.NewSecretView(secret, reveal))
 }
 
+// ListSecrets lists the secrets of ?namespace=, or of every namespace with
+// ?allNamespaces=true, filtered by ?labelSelector= and ?fieldSelector= and
+// paged with ?limit= and ?continue=
 func (h *Handler) ListSecrets(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	namespace := vars["namespace"]
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	namespace := query.Get("namespace")
+	allNamespaces, _ := strconv.ParseBool(query.Get("allNamespaces"))
 
 	// Check if namespace parameter is present
-	if namespace == "" {
-		http.Error(w, "namespace is required", http.StatusBadRequest)
+	if namespace == "" && !allNamespaces {
+		api.WriteErrorResponse(w, apperrors.CodeBadRequest, "namespace is required", "")
 		return
 	}
+	if allNamespaces {
+		namespace = ""
+	}
 
-	secrets, err := h.client.ListSecrets(r.Context(), namespace)
+	opts := k8s.ListOptions{
+		LabelSelector: query.Get("labelSelector"),
+		FieldSelector: query.Get("fieldSelector"),
+		Continue:      query.Get("continue"),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || n < 0 {
+			api.WriteErrorResponse(w, apperrors.CodeBadRequest, "limit must be a non-negative integer", "")
+			return
+		}
+		opts.Limit = n
+	}
+
+	secrets, err := client.ListSecrets(r.Context(), namespace, opts)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if apperrors.CodeOf(err) == apperrors.CodeGone {
+			api.WriteErrorResponse(w, apperrors.CodeGone, "continue token has expired", "restart the list without a continue token")
+			return
+		}
+		api.WriteError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(secrets)
+	items := make([]api.SecretView, 0, len(secrets.Items))
+	for i := range secrets.Items {
+		items = append(items, api.NewSecretView(&secrets.Items[i], false))
+	}
+
+	api.WriteJSON(w, http.StatusOK, api.SecretListResponse{
+		Items:              items,
+		Continue:           secrets.Continue,
+		RemainingItemCount: secrets.RemainingItemCount,
+	})
 }
 
 func (h *Handler) UpdateSecret(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	name := vars["name"]
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
 
 	var secretData k8s.SecretData
 	if err := json.NewDecoder(r.Body).Decode(&secretData); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		api.WriteErrorResponse(w, apperrors.CodeBadRequest, "invalid request body", err.Error())
 		return
 	}
 
+	name, namespace := secretRef(r)
 	secretData.Name = name
-	if err := h.client.UpdateSecret(r.Context(), &secretData); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if namespace != "" {
+		secretData.Namespace = namespace
+	}
+
+	resourceVersion, conditional := ifMatch(r)
+	if conditional {
+		secretData.ResourceVersion = resourceVersion
+	}
+
+	if err := validator.ValidateSecretMetadata(&secretData); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	// The type and annotations may be left to the existing secret, so its
+	// type rules apply to the secret as the update leaves it
+	existing, err := client.GetSecret(r.Context(), secretData.Namespace, name)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	if err := k8s.ApplySecretData(existing, &secretData); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	if err := validator.ValidateSecretType(k8s.NewSecretData(existing)); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	if err := client.UpdateSecret(r.Context(), &secretData); err != nil {
+		writeUpdateError(w, err, conditional)
 		return
 	}
 
+	w.Header().Set("ETag", etag(secretData.ResourceVersion))
 	w.WriteHeader(http.StatusOK)
 }
 
 func (h *Handler) DeleteSecret(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	name := vars["name"]
-	namespace := vars["namespace"]
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	name, namespace := secretRef(r)
 
-	if err := h.client.DeleteSecret(r.Context(), namespace, name); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	resourceVersion, conditional := ifMatch(r)
+	if err := client.DeleteSecret(r.Context(), namespace, name, k8s.DeleteOptions{ResourceVersion: resourceVersion}); err != nil {
+		writeUpdateError(w, err, conditional)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// secretRef returns the name and namespace a request addresses. The namespace
+// may also be given as the namespace query parameter.
+func secretRef(r *http.Request) (name, namespace string) {
+	vars := mux.Vars(r)
+	namespace = vars["namespace"]
+	if namespace == "" {
+		namespace = r.URL.Query().Get("namespace")
+	}
+	return vars["name"], namespace
+}
+
+// writeUpdateError answers the errors a write to an existing secret can
+// produce. A Conflict answers 412 when the request carried an If-Match
+// precondition and 409 otherwise.
+func writeUpdateError(w http.ResponseWriter, err error, conditional bool) {
+	if conditional && apperrors.CodeOf(err) == apperrors.CodeConflict {
+		api.WriteErrorResponse(w, apperrors.CodePreconditionFailed, "secret has been modified", err.Error())
+		return
+	}
+	api.WriteError(w, err)
+}
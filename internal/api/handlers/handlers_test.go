@@ -6,33 +6,49 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 
+	"filippo.io/age"
 	"github.com/gorilla/mux"
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/external"
+	"github.com/mpalu/k8s-secrets-manager/internal/generate"
 	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/policy"
+	"github.com/rs/zerolog"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 // mockClient implements k8s.Client interface for testing
 type mockClient struct {
 	secrets map[string]*k8s.SecretData
+	history map[string][]*k8s.SecretData
 }
 
 func newMockClient() *mockClient {
 	return &mockClient{
 		secrets: make(map[string]*k8s.SecretData),
+		history: make(map[string][]*k8s.SecretData),
 	}
 }
 
 func (m *mockClient) CreateSecret(ctx context.Context, data *k8s.SecretData) error {
 	key := data.Namespace + "/" + data.Name
 	if _, exists := m.secrets[key]; exists {
-		return &k8s.ValidationError{
-			Field:   "name",
-			Message: "secret already exists",
-		}
+		return apperrors.New(apperrors.CodeAlreadyExists, "secret already exists")
 	}
+	data.ResourceVersion = "1"
 	m.secrets[key] = data
 	return nil
 }
@@ -40,64 +56,158 @@ func (m *mockClient) CreateSecret(ctx context.Context, data *k8s.SecretData) err
 func (m *mockClient) GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
 	key := namespace + "/" + name
 	if secret, exists := m.secrets[key]; exists {
+		data := secret.Values()
 		return &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      secret.Name,
-				Namespace: secret.Namespace,
-			},
-			Data: map[string][]byte{
-				"key1": []byte("value1"),
+				Name:            secret.Name,
+				Namespace:       secret.Namespace,
+				ResourceVersion: secret.ResourceVersion,
+				Labels:          secret.Labels,
+				Annotations:     secret.Annotations,
 			},
+			Type:      corev1.SecretType(secret.Type),
+			Data:      data,
+			Immutable: &secret.Immutable,
 		}, nil
 	}
-	return nil, &k8s.NotFoundError{
-		Resource: "secret",
-		Name:     name,
+	return nil, &k8s.NotFoundError{Resource: "secret", Name: name, Namespace: namespace}
+}
+
+func (m *mockClient) GetSecretString(ctx context.Context, namespace, name, key string) (string, error) {
+	secret, err := m.GetSecret(ctx, namespace, name)
+	if err != nil {
+		return "", err
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", &k8s.KeyNotFoundError{Secret: name, Key: key}
 	}
+	return string(value), nil
 }
 
-func (m *mockClient) DeleteSecret(ctx context.Context, namespace, name string) error {
+func (m *mockClient) DeleteSecret(ctx context.Context, namespace, name string, opts ...k8s.DeleteOptions) error {
 	key := namespace + "/" + name
-	if _, exists := m.secrets[key]; !exists {
-		return &k8s.ValidationError{
-			Field:   "name",
-			Message: "secret not found",
+	existing, exists := m.secrets[key]
+	if !exists {
+		return &k8s.NotFoundError{Resource: "secret", Name: name, Namespace: namespace}
+	}
+	for _, opt := range opts {
+		if opt.ResourceVersion != "" && opt.ResourceVersion != existing.ResourceVersion {
+			return apierrors.NewConflict(corev1.Resource("secrets"), name, nil)
 		}
 	}
 	delete(m.secrets, key)
 	return nil
 }
 
-func (m *mockClient) ListSecrets(ctx context.Context, namespace string) ([]corev1.Secret, error) {
-	secrets := []corev1.Secret{}
-	for _, secret := range m.secrets {
-		if secret.Namespace == namespace {
-			secrets = append(secrets, corev1.Secret{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      secret.Name,
-					Namespace: secret.Namespace,
-				},
-				Data: map[string][]byte{
-					"key1": []byte("value1"),
-				},
-			})
+func (m *mockClient) ListSecrets(ctx context.Context, namespace string, opts k8s.ListOptions) (*k8s.SecretList, error) {
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, &k8s.ValidationError{Field: "labelSelector", Message: err.Error()}
+	}
+
+	keys := make([]string, 0, len(m.secrets))
+	for key := range m.secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := &k8s.SecretList{Items: []corev1.Secret{}}
+	for _, key := range keys {
+		secret := m.secrets[key]
+		if namespace != "" && secret.Namespace != namespace {
+			continue
+		}
+		if !selector.Matches(labels.Set(secret.Labels)) {
+			continue
 		}
+		list.Items = append(list.Items, corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      secret.Name,
+				Namespace: secret.Namespace,
+				Labels:    secret.Labels,
+			},
+			Data: map[string][]byte{
+				"key1": []byte("value1"),
+			},
+		})
 	}
-	return secrets, nil
+	return list, nil
 }
 
 func (m *mockClient) UpdateSecret(ctx context.Context, data *k8s.SecretData) error {
 	key := data.Namespace + "/" + data.Name
-	if _, exists := m.secrets[key]; !exists {
-		return &k8s.ValidationError{
-			Field:   "name",
-			Message: "secret not found",
-		}
+	existing, exists := m.secrets[key]
+	if !exists {
+		return &k8s.NotFoundError{Resource: "secret", Name: data.Name, Namespace: data.Namespace}
+	}
+	if data.ResourceVersion != "" && data.ResourceVersion != existing.ResourceVersion {
+		return apierrors.NewConflict(corev1.Resource("secrets"), data.Name, nil)
 	}
+	version, _ := strconv.Atoi(existing.ResourceVersion)
+	data.ResourceVersion = strconv.Itoa(version + 1)
+	m.history[key] = append(m.history[key], existing)
 	m.secrets[key] = data
 	return nil
 }
 
+func (m *mockClient) ListRevisions(ctx context.Context, namespace, name string) ([]k8s.Revision, error) {
+	revisions := []k8s.Revision{}
+	for i, previous := range m.history[namespace+"/"+name] {
+		revisions = append(revisions, k8s.Revision{Revision: int64(i + 1), ResourceVersion: previous.ResourceVersion})
+	}
+	return revisions, nil
+}
+
+func (m *mockClient) GetRevision(ctx context.Context, namespace, name string, revision int64) (*k8s.Revision, error) {
+	history := m.history[namespace+"/"+name]
+	if revision < 1 || revision > int64(len(history)) {
+		return nil, &k8s.NotFoundError{Resource: "revision", Name: strconv.FormatInt(revision, 10), Namespace: namespace}
+	}
+	previous := history[revision-1]
+	return &k8s.Revision{
+		Revision:        revision,
+		ResourceVersion: previous.ResourceVersion,
+		Secret: &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, ResourceVersion: previous.ResourceVersion},
+			Data:       previous.Values(),
+		},
+	}, nil
+}
+
+func (m *mockClient) Rollback(ctx context.Context, namespace, name string, revision int64) (*corev1.Secret, error) {
+	rev, err := m.GetRevision(ctx, namespace, name, revision)
+	if err != nil {
+		return nil, err
+	}
+	data := k8s.NewSecretData(rev.Secret)
+	data.ResourceVersion = ""
+	if err := m.UpdateSecret(ctx, data); err != nil {
+		return nil, err
+	}
+	return m.GetSecret(ctx, namespace, name)
+}
+
+func (m *mockClient) PatchSecret(ctx context.Context, namespace, name string, patch *k8s.SecretPatch) (*corev1.Secret, error) {
+	secret, err := m.GetSecret(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if patch.ResourceVersion != "" && patch.ResourceVersion != secret.ResourceVersion {
+		return nil, apierrors.NewConflict(corev1.Resource("secrets"), name, nil)
+	}
+	if err := patch.Apply(secret); err != nil {
+		return nil, err
+	}
+
+	data := k8s.NewSecretData(secret)
+	data.ResourceVersion = ""
+	if err := m.UpdateSecret(ctx, data); err != nil {
+		return nil, err
+	}
+	return m.GetSecret(ctx, namespace, name)
+}
+
 func TestCreateSecret(t *testing.T) {
 	mockClient := newMockClient()
 	handler := NewHandler(mockClient)
@@ -199,6 +309,46 @@ func TestGetSecret(t *testing.T) {
 	}
 }
 
+func TestGetSecret_LastAppliedConfiguration(t *testing.T) {
+	mockClient := newMockClient()
+	mockClient.CreateSecret(context.Background(), &k8s.SecretData{
+		Name:      "test-secret",
+		Namespace: "default",
+		Data:      map[string]string{"password": "s3cr3t"},
+		Annotations: map[string]string{
+			corev1.LastAppliedConfigAnnotation: `{"apiVersion":"v1","kind":"Secret","data":{"password":"czNjcjN0"}}`,
+		},
+	})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/secrets", NewHandler(mockClient).ListSecrets)
+	router.HandleFunc("/api/v1/secrets/{name}", NewHandler(mockClient).GetSecret)
+	router.HandleFunc("/revealed/api/v1/secrets/{name}", NewHandler(mockClient, WithRevealAuthorizer(AllowReveal)).GetSecret)
+
+	tests := []struct {
+		name     string
+		path     string
+		wantLeak bool
+	}{
+		{"get", "/api/v1/secrets/test-secret?namespace=default", false},
+		{"list", "/api/v1/secrets?namespace=default", false},
+		{"revealed", "/revealed/api/v1/secrets/test-secret?namespace=default&reveal=true", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+			}
+			if leaked := strings.Contains(rr.Body.String(), "czNjcjN0"); leaked != tt.wantLeak {
+				t.Errorf("value in response = %v, want %v: %s", leaked, tt.wantLeak, rr.Body.String())
+			}
+		})
+	}
+}
+
 func TestUpdateSecret(t *testing.T) {
 	mockClient := newMockClient()
 	handler := NewHandler(mockClient)
@@ -263,3 +413,1103 @@ func TestUpdateSecret(t *testing.T) {
 		})
 	}
 }
+
+func TestSecretTypeValidation(t *testing.T) {
+	selfSigned, err := generate.NewRegistry().Get("self-signed-cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := selfSigned.Generate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := selfSigned.Generate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatched, _ := json.Marshal(map[string]interface{}{
+		"data": map[string]string{
+			corev1.TLSCertKey:       string(pair[corev1.TLSCertKey]),
+			corev1.TLSPrivateKeyKey: string(other[corev1.TLSPrivateKeyKey]),
+		},
+	})
+
+	tests := []struct {
+		name        string
+		method      string
+		secret      string
+		contentType string
+		body        string
+	}{
+		{"update with mismatched tls key", http.MethodPut, "tls", "application/json", string(mismatched)},
+		{"patch with mismatched tls key", http.MethodPatch, "tls", "application/merge-patch+json", string(mismatched)},
+		{"update with invalid dockerconfigjson", http.MethodPut, "registry", "application/json", `{"data":{".dockerconfigjson":"not json"}}`},
+		{"patch with invalid dockerconfigjson", http.MethodPatch, "registry", "application/merge-patch+json", `{"data":{".dockerconfigjson":"not json"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := newMockClient()
+			mockClient.CreateSecret(context.Background(), &k8s.SecretData{
+				Name:      "tls",
+				Namespace: "default",
+				Type:      string(corev1.SecretTypeTLS),
+				Data:      map[string]string{corev1.TLSCertKey: string(pair[corev1.TLSCertKey]), corev1.TLSPrivateKeyKey: string(pair[corev1.TLSPrivateKeyKey])},
+			})
+			mockClient.CreateSecret(context.Background(), &k8s.SecretData{
+				Name:      "registry",
+				Namespace: "default",
+				Type:      string(corev1.SecretTypeDockerConfigJson),
+				Data:      map[string]string{corev1.DockerConfigJsonKey: `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`},
+			})
+			handler := NewHandler(mockClient)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/api/v1/secrets/{namespace}/{name}", handler.UpdateSecret).Methods(http.MethodPut)
+			router.HandleFunc("/api/v1/secrets/{namespace}/{name}", handler.PatchSecret).Methods(http.MethodPatch)
+
+			req := httptest.NewRequest(tt.method, "/api/v1/secrets/default/"+tt.secret, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusBadRequest, rr.Body.String())
+			}
+			if version := mockClient.secrets["default/"+tt.secret].ResourceVersion; version != "1" {
+				t.Errorf("invalid secret was written, version %s", version)
+			}
+		})
+	}
+}
+
+func TestClusterRouting(t *testing.T) {
+	staging := newMockClient()
+	staging.CreateSecret(context.Background(), &k8s.SecretData{
+		Name:      "staging-secret",
+		Namespace: "default",
+		Data:      map[string]string{"key1": "value1"},
+	})
+	prod := newMockClient()
+	prod.CreateSecret(context.Background(), &k8s.SecretData{
+		Name:      "prod-secret",
+		Namespace: "default",
+		Data:      map[string]string{"key1": "value1"},
+	})
+
+	clusters := k8s.NewRegistry()
+	clusters.Register("staging", staging)
+	clusters.Register("prod", prod)
+	handler := NewClusterHandler(clusters)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/clusters", handler.ListClusters)
+	router.HandleFunc("/api/v1/secrets/{namespace}/{name}", handler.GetSecret)
+	router.HandleFunc("/api/v1/clusters/{cluster}/secrets/{namespace}/{name}", handler.GetSecret)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{
+			name:           "named cluster",
+			path:           "/api/v1/clusters/prod/secrets/default/prod-secret",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "default cluster",
+			path:           "/api/v1/secrets/default/staging-secret",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unknown cluster",
+			path:           "/api/v1/clusters/dev/secrets/default/prod-secret",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+			}
+		})
+	}
+
+	t.Run("list clusters", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/clusters", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var statuses []api.ClusterStatus
+		if err := json.NewDecoder(rr.Body).Decode(&statuses); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(statuses) != 2 || statuses[0].Name != "staging" || !statuses[0].Default || !statuses[1].Reachable {
+			t.Errorf("unexpected cluster statuses: %+v", statuses)
+		}
+	})
+}
+
+func TestOptimisticConcurrency(t *testing.T) {
+	mockClient := newMockClient()
+	handler := NewHandler(mockClient)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/secrets/{namespace}/{name}", handler.GetSecret).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/secrets/{namespace}/{name}", handler.UpdateSecret).Methods(http.MethodPut)
+	router.HandleFunc("/api/v1/secrets/{namespace}/{name}", handler.DeleteSecret).Methods(http.MethodDelete)
+
+	mockClient.CreateSecret(context.Background(), &k8s.SecretData{
+		Name:      "test-secret",
+		Namespace: "default",
+		Data:      map[string]string{"key1": "value1"},
+	})
+
+	get := httptest.NewRecorder()
+	router.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/api/v1/secrets/default/test-secret", nil))
+	if tag := get.Header().Get("ETag"); tag != `"1"` {
+		t.Fatalf("GET returned ETag %q, want %q", tag, `"1"`)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		ifMatch        string
+		body           string
+		expectedStatus int
+		expectedETag   string
+	}{
+		{
+			name:           "update with current ETag",
+			method:         http.MethodPut,
+			ifMatch:        `"1"`,
+			body:           `{"data":{"key1":"value2"}}`,
+			expectedStatus: http.StatusOK,
+			expectedETag:   `"2"`,
+		},
+		{
+			name:           "update with stale ETag",
+			method:         http.MethodPut,
+			ifMatch:        `"1"`,
+			body:           `{"data":{"key1":"value3"}}`,
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:           "update with stale resourceVersion in body",
+			method:         http.MethodPut,
+			body:           `{"resourceVersion":"1","data":{"key1":"value3"}}`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "delete with stale ETag",
+			method:         http.MethodDelete,
+			ifMatch:        `"1"`,
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:           "delete with current ETag",
+			method:         http.MethodDelete,
+			ifMatch:        `W/"2"`,
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/secrets/default/test-secret", bytes.NewBufferString(tt.body))
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+			}
+			if tt.expectedETag != "" && rr.Header().Get("ETag") != tt.expectedETag {
+				t.Errorf("handler returned ETag %q, want %q", rr.Header().Get("ETag"), tt.expectedETag)
+			}
+			if rr.Code == http.StatusConflict || rr.Code == http.StatusPreconditionFailed {
+				var resp api.ErrorResponse
+				if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || resp.Code != rr.Code {
+					t.Errorf("handler returned unstructured conflict body: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestPatchSecret(t *testing.T) {
+	tests := []struct {
+		name           string
+		contentType    string
+		ifMatch        string
+		body           string
+		expectedStatus int
+		expectedData   map[string]string
+	}{
+		{
+			name:           "merge patch sets and removes keys",
+			contentType:    "application/merge-patch+json",
+			body:           `{"data":{"key1":"updated","key3":"value3","key2":null}}`,
+			expectedStatus: http.StatusOK,
+			expectedData:   map[string]string{"key1": "updated", "key3": "value3"},
+		},
+		{
+			name:           "json patch renames a key",
+			contentType:    "application/json-patch+json",
+			body:           `[{"op":"move","from":"/data/key2","path":"/data/renamed"}]`,
+			expectedStatus: http.StatusOK,
+			expectedData:   map[string]string{"key1": "value1", "renamed": "value2"},
+		},
+		{
+			name:           "json patch test failure",
+			contentType:    "application/json-patch+json",
+			body:           `[{"op":"test","path":"/data/key1","value":"other"}]`,
+			expectedStatus: http.StatusBadRequest,
+			expectedData:   map[string]string{"key1": "value1", "key2": "value2"},
+		},
+		{
+			name:           "invalid key",
+			contentType:    "application/merge-patch+json",
+			body:           `{"data":{"bad/key":"value"}}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedData:   map[string]string{"key1": "value1", "key2": "value2"},
+		},
+		{
+			name:           "stale If-Match",
+			contentType:    "application/merge-patch+json",
+			ifMatch:        `"0"`,
+			body:           `{"data":{"key1":"updated"}}`,
+			expectedStatus: http.StatusPreconditionFailed,
+			expectedData:   map[string]string{"key1": "value1", "key2": "value2"},
+		},
+		{
+			name:           "unsupported content type",
+			contentType:    "application/json",
+			body:           `{"data":{"key1":"updated"}}`,
+			expectedStatus: http.StatusUnsupportedMediaType,
+			expectedData:   map[string]string{"key1": "value1", "key2": "value2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := newMockClient()
+			mockClient.CreateSecret(context.Background(), &k8s.SecretData{
+				Name:      "test-secret",
+				Namespace: "default",
+				Data:      map[string]string{"key1": "value1", "key2": "value2"},
+			})
+			handler := NewHandler(mockClient)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/api/v1/secrets/{namespace}/{name}", handler.PatchSecret)
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/secrets/default/test-secret", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v: %s", status, tt.expectedStatus, rr.Body.String())
+			}
+
+			stored := mockClient.secrets["default/test-secret"].Data
+			if len(stored) != len(tt.expectedData) {
+				t.Errorf("secret data = %v, want %v", stored, tt.expectedData)
+			}
+			for k, v := range tt.expectedData {
+				if stored[k] != v {
+					t.Errorf("secret data = %v, want %v", stored, tt.expectedData)
+				}
+			}
+		})
+	}
+}
+
+// staleReads serves reads of an older version of the secrets, as a lagging
+// cache would
+type staleReads struct {
+	*mockClient
+}
+
+func (s staleReads) GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	secret, err := s.mockClient.GetSecret(ctx, namespace, name)
+	if err == nil {
+		secret.ResourceVersion = "1"
+	}
+	return secret, err
+}
+
+func TestPatchSecret_IfMatchWithStaleRead(t *testing.T) {
+	mockClient := newMockClient()
+	data := &k8s.SecretData{Name: "test-secret", Namespace: "default", Data: map[string]string{"key1": "value1"}}
+	mockClient.CreateSecret(context.Background(), data)
+	mockClient.UpdateSecret(context.Background(), data)
+	handler := NewHandler(staleReads{mockClient})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/secrets/{namespace}/{name}", handler.PatchSecret)
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/secrets/default/test-secret", bytes.NewBufferString(`{"data":{"key1":"updated"}}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", etag(data.ResourceVersion))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if got := mockClient.secrets["default/test-secret"].Data["key1"]; got != "updated" {
+		t.Errorf("key1 = %q, want updated", got)
+	}
+}
+
+func TestListSecrets(t *testing.T) {
+	mockClient := newMockClient()
+	mockClient.secrets["default/api"] = &k8s.SecretData{Name: "api", Namespace: "default", Labels: map[string]string{"app": "api"}}
+	mockClient.secrets["default/db"] = &k8s.SecretData{Name: "db", Namespace: "default", Labels: map[string]string{"app": "db"}}
+	mockClient.secrets["other/api"] = &k8s.SecretData{Name: "api", Namespace: "other", Labels: map[string]string{"app": "api"}}
+
+	handler := NewHandler(mockClient)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/secrets", handler.ListSecrets).Methods("GET")
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantNames  []string
+	}{
+		{
+			name:       "namespace",
+			query:      "namespace=default",
+			wantStatus: http.StatusOK,
+			wantNames:  []string{"default/api", "default/db"},
+		},
+		{
+			name:       "label selector",
+			query:      "namespace=default&labelSelector=app%3Dapi",
+			wantStatus: http.StatusOK,
+			wantNames:  []string{"default/api"},
+		},
+		{
+			name:       "all namespaces",
+			query:      "allNamespaces=true&labelSelector=app%3Dapi",
+			wantStatus: http.StatusOK,
+			wantNames:  []string{"default/api", "other/api"},
+		},
+		{
+			name:       "missing namespace",
+			query:      "",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid label selector",
+			query:      "namespace=default&labelSelector=app+in+(api",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid limit",
+			query:      "namespace=default&limit=-1",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/secrets?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response api.SecretListResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			var names []string
+			for _, secret := range response.Items {
+				names = append(names, secret.Namespace+"/"+secret.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("ListSecrets() = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestRevealSecret(t *testing.T) {
+	mockClient := newMockClient()
+	mockClient.CreateSecret(context.Background(), &k8s.SecretData{
+		Name:      "db",
+		Namespace: "default",
+		Data:      map[string]string{"password": "s3cr3t"},
+	})
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		path       string
+		wantStatus int
+		wantBody   string
+		wantNot    string
+	}{
+		{
+			name:       "masked by default",
+			path:       "/api/v1/secrets/default/db",
+			wantStatus: http.StatusOK,
+			// sha256("s3cr3t")
+			wantBody: `"sha256":"4e738ca5563c06cfd0018299933d58db1dd8bf97f6973dc99bf6cdc64b5550bd"`,
+			wantNot:  "s3cr3t",
+		},
+		{
+			name:       "reveal without authorizer",
+			path:       "/api/v1/secrets/default/db?reveal=true",
+			wantStatus: http.StatusForbidden,
+			wantNot:    "s3cr3t",
+		},
+		{
+			name:       "reveal allowed",
+			opts:       []Option{WithRevealAuthorizer(AllowReveal)},
+			path:       "/api/v1/secrets/default/db?reveal=true",
+			wantStatus: http.StatusOK,
+			wantBody:   `"data":{"password":"s3cr3t"}`,
+		},
+		{
+			name:       "key without authorizer",
+			path:       "/api/v1/secrets/default/db/keys/password",
+			wantStatus: http.StatusForbidden,
+			wantNot:    "s3cr3t",
+		},
+		{
+			name:       "key allowed",
+			opts:       []Option{WithRevealAuthorizer(AllowReveal)},
+			path:       "/api/v1/secrets/default/db/keys/password",
+			wantStatus: http.StatusOK,
+			wantBody:   `"value":"s3cr3t"`,
+		},
+		{
+			name:       "missing key",
+			opts:       []Option{WithRevealAuthorizer(AllowReveal)},
+			path:       "/api/v1/secrets/default/db/keys/user",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "authorizer sees the key",
+			opts: []Option{WithRevealAuthorizer(func(r *http.Request, namespace, name, key string) bool {
+				return key == "user"
+			})},
+			path:       "/api/v1/secrets/default/db/keys/password",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var audit bytes.Buffer
+			logger := zerolog.New(&audit)
+			handler := NewHandler(mockClient, append(tt.opts, WithAuditLogger(&logger))...)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/api/v1/secrets/{namespace}/{name}", handler.GetSecret).Methods(http.MethodGet)
+			router.HandleFunc("/api/v1/secrets/{namespace}/{name}/keys/{key}", handler.GetSecretKey).Methods(http.MethodGet)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantStatus)
+			}
+			body := rr.Body.String()
+			if tt.wantBody != "" && !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", body, tt.wantBody)
+			}
+			if tt.wantNot != "" && strings.Contains(body, tt.wantNot) {
+				t.Errorf("body = %s, must not contain %s", body, tt.wantNot)
+			}
+
+			revealed := strings.Contains(req.URL.RawQuery, "reveal") || strings.Contains(req.URL.Path, "/keys/")
+			if audited := strings.Contains(audit.String(), "secret.reveal"); audited != revealed {
+				t.Errorf("audited = %v, want %v (log: %s)", audited, revealed, audit.String())
+			}
+		})
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	mockClient := newMockClient()
+	mockClient.CreateSecret(context.Background(), &k8s.SecretData{
+		Name:      "db",
+		Namespace: "default",
+		Data:      map[string]string{"password": "s3cr3t"},
+	})
+
+	handler := NewHandler(mockClient, WithRevealAuthorizer(AllowReveal))
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/secrets", handler.CreateSecret).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/secrets/{namespace}/{name}", handler.GetSecret).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/secrets/{namespace}/{name}", handler.DeleteSecret).Methods(http.MethodDelete)
+	router.HandleFunc("/api/v1/secrets/{namespace}/{name}/keys/{key}", handler.GetSecretKey).Methods(http.MethodGet)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantReason string
+	}{
+		{
+			name:       "get missing secret",
+			method:     http.MethodGet,
+			path:       "/api/v1/secrets/default/missing",
+			wantStatus: http.StatusNotFound,
+			wantReason: apperrors.CodeNotFound,
+		},
+		{
+			name:       "get missing key",
+			method:     http.MethodGet,
+			path:       "/api/v1/secrets/default/db/keys/user",
+			wantStatus: http.StatusNotFound,
+			wantReason: apperrors.CodeNotFound,
+		},
+		{
+			name:       "delete missing secret",
+			method:     http.MethodDelete,
+			path:       "/api/v1/secrets/default/missing",
+			wantStatus: http.StatusNotFound,
+			wantReason: apperrors.CodeNotFound,
+		},
+		{
+			name:       "create existing secret",
+			method:     http.MethodPost,
+			path:       "/api/v1/secrets",
+			body:       `{"name": "db", "namespace": "default", "data": {"password": "x"}}`,
+			wantStatus: http.StatusConflict,
+			wantReason: apperrors.CodeAlreadyExists,
+		},
+		{
+			name:       "create invalid secret",
+			method:     http.MethodPost,
+			path:       "/api/v1/secrets",
+			body:       `{"namespace": "default", "data": {"password": "x"}}`,
+			wantStatus: http.StatusBadRequest,
+			wantReason: apperrors.CodeInvalid,
+		},
+		{
+			name:       "malformed body",
+			method:     http.MethodPost,
+			path:       "/api/v1/secrets",
+			body:       `{`,
+			wantStatus: http.StatusBadRequest,
+			wantReason: apperrors.CodeBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantStatus)
+			}
+			if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", contentType)
+			}
+
+			var resp api.ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.Reason != tt.wantReason || resp.Code != tt.wantStatus || resp.Error == "" {
+				t.Errorf("response = %+v, want reason %s and code %d", resp, tt.wantReason, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestBinaryDataRoundTrip(t *testing.T) {
+	mockClient := newMockClient()
+	handler := NewHandler(mockClient, WithRevealAuthorizer(AllowReveal))
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/secrets", handler.CreateSecret).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/secrets/{namespace}/{name}", handler.GetSecret).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/secrets/{namespace}/{name}/keys/{key}", handler.GetSecretKey).Methods(http.MethodGet)
+
+	keystore := []byte{0xfe, 0xed, 0xfe, 0xed, 0x00, 0xff}
+	body, _ := json.Marshal(k8s.SecretData{
+		Name:       "keystore",
+		Namespace:  "default",
+		Data:       map[string]string{"password": "changeit"},
+		BinaryData: map[string][]byte{"keystore.jks": keystore},
+	})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/secrets", bytes.NewReader(body)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create returned %v: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/secrets/default/keystore?reveal=true", nil))
+	var view api.SecretView
+	if err := json.NewDecoder(rr.Body).Decode(&view); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if !bytes.Equal(view.BinaryData["keystore.jks"], keystore) || view.Data["password"] != "changeit" {
+		t.Errorf("revealed data = %v, binaryData = %v", view.Data, view.BinaryData)
+	}
+	encodings := make(map[string]string)
+	for _, key := range view.Keys {
+		encodings[key.Name] = key.Encoding
+	}
+	if encodings["keystore.jks"] != api.EncodingBase64 || encodings["password"] != api.EncodingUTF8 {
+		t.Errorf("key encodings = %v", encodings)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/secrets/default/keystore/keys/keystore.jks", nil))
+	var value api.SecretValueResponse
+	if err := json.NewDecoder(rr.Body).Decode(&value); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if value.Encoding != api.EncodingBase64 || value.Value != "/u3+7QD/" {
+		t.Errorf("key response = %+v", value)
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	mockClient := newMockClient()
+	mockClient.CreateSecret(context.TODO(), &k8s.SecretData{Name: "db", Namespace: "default", Data: map[string]string{"password": "v1"}})
+	mockClient.UpdateSecret(context.TODO(), &k8s.SecretData{Name: "db", Namespace: "default", Data: map[string]string{"password": "v2"}})
+
+	handler := NewHandler(mockClient)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/secrets/{namespace}/{name}/revisions", handler.ListRevisions).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/secrets/{namespace}/{name}/revisions/{revision}", handler.GetRevision).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/secrets/{namespace}/{name}/revisions/{revision}/rollback", handler.Rollback).Methods(http.MethodPost)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"list", http.MethodGet, "/api/v1/secrets/default/db/revisions", http.StatusOK},
+		{"get", http.MethodGet, "/api/v1/secrets/default/db/revisions/1", http.StatusOK},
+		{"get unknown revision", http.MethodGet, "/api/v1/secrets/default/db/revisions/7", http.StatusNotFound},
+		{"invalid revision", http.MethodGet, "/api/v1/secrets/default/db/revisions/first", http.StatusBadRequest},
+		{"reveal not allowed", http.MethodGet, "/api/v1/secrets/default/db/revisions/1?reveal=true", http.StatusForbidden},
+		{"rollback", http.MethodPost, "/api/v1/secrets/default/db/revisions/1/rollback", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+			if rr.Code != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK && strings.Contains(rr.Body.String(), "v1") {
+				t.Errorf("response leaks a secret value: %s", rr.Body.String())
+			}
+		})
+	}
+
+	if value, _ := mockClient.GetSecretString(context.TODO(), "default", "db", "password"); value != "v1" {
+		t.Errorf("password after rollback = %s, want v1", value)
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	mockClient := newMockClient()
+	handler := NewHandler(mockClient)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/secrets/{namespace}/{name}/generate", handler.GenerateSecret).Methods(http.MethodPost)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"create", `{"generators":[{"generator":"password","params":{"length":"40"}}]}`, http.StatusCreated},
+		{"extend", `{"generators":[{"generator":"token","params":{"encoding":"hex"}}]}`, http.StatusOK},
+		{"existing key", `{"generators":[{"generator":"password"}]}`, http.StatusConflict},
+		{"unknown generator", `{"generators":[{"generator":"dice"}]}`, http.StatusBadRequest},
+		{"invalid body", `{`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/secrets/default/app/generate", strings.NewReader(tt.body))
+			router.ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if rr.Code >= 300 {
+				return
+			}
+
+			var resp api.GenerateResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if len(resp.Keys) != 1 || resp.Secret.Data != nil {
+				t.Errorf("response = %+v, want one key and no values", resp)
+			}
+		})
+	}
+
+	password, _ := mockClient.GetSecretString(context.TODO(), "default", "app", "password")
+	token, _ := mockClient.GetSecretString(context.TODO(), "default", "app", "token")
+	if len(password) != 40 || len(token) != 64 {
+		t.Errorf("password = %q, token = %q", password, token)
+	}
+}
+
+func TestCopySecret(t *testing.T) {
+	mockClient := newMockClient()
+	mockClient.CreateSecret(context.TODO(), &k8s.SecretData{Name: "registry", Namespace: "infra", Data: map[string]string{"token": "abc"}})
+
+	handler := NewHandler(mockClient)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/secrets/{namespace}/{name}/copy", handler.CopySecret).Methods(http.MethodPost)
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"copy", "/api/v1/secrets/infra/registry/copy", `{"targetNamespace":"team-a"}`, http.StatusCreated},
+		{"target exists", "/api/v1/secrets/infra/registry/copy", `{"targetNamespace":"team-a"}`, http.StatusConflict},
+		{"rename", "/api/v1/secrets/infra/registry/copy", `{"targetName":"registry-mirror"}`, http.StatusCreated},
+		{"same secret", "/api/v1/secrets/infra/registry/copy", `{}`, http.StatusBadRequest},
+		{"missing source", "/api/v1/secrets/infra/missing/copy", `{"targetNamespace":"team-a"}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			if rr.Code != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+		})
+	}
+
+	if value, _ := mockClient.GetSecretString(context.TODO(), "team-a", "registry", "token"); value != "abc" {
+		t.Errorf("copied token = %q, want abc", value)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	mockClient := newMockClient()
+	mockClient.CreateSecret(context.TODO(), &k8s.SecretData{Name: "db", Namespace: "default", Data: map[string]string{"USER": "admin"}})
+
+	router := mux.NewRouter()
+	for _, handler := range []struct {
+		prefix  string
+		handler *Handler
+	}{
+		{"/api/v1", NewHandler(mockClient, WithRevealAuthorizer(AllowReveal))},
+		{"/masked/api/v1", NewHandler(mockClient)},
+	} {
+		router.HandleFunc(handler.prefix+"/secrets/export", handler.handler.ExportSecrets).Methods(http.MethodGet)
+		router.HandleFunc(handler.prefix+"/secrets/import", handler.handler.ImportSecrets).Methods(http.MethodPost)
+		router.HandleFunc(handler.prefix+"/secrets/{namespace}/{name}/export", handler.handler.ExportSecret).Methods(http.MethodGet)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"export env", http.MethodGet, "/api/v1/secrets/default/db/export?format=env", "", http.StatusOK, "USER=admin\n"},
+		{"export namespace", http.MethodGet, "/api/v1/secrets/export?namespace=default", "", http.StatusOK, "kind: Secret"},
+		{"export needs reveal", http.MethodGet, "/masked/api/v1/secrets/default/db/export", "", http.StatusForbidden, ""},
+		{"unknown format", http.MethodGet, "/api/v1/secrets/default/db/export?format=xml", "", http.StatusBadRequest, ""},
+		{"import", http.MethodPost, "/api/v1/secrets/import?namespace=default&format=json", `{"cache": {"url": "redis://cache"}}`, http.StatusCreated, `"default/cache"`},
+		{"import conflict", http.MethodPost, "/api/v1/secrets/import?namespace=default&format=env&name=db&conflict=fail", "USER=root\n", http.StatusConflict, ""},
+		{"import overwrite", http.MethodPost, "/api/v1/secrets/import?namespace=default&format=env&name=db&conflict=overwrite", "USER=root\n", http.StatusOK, `"default/db"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	if value, _ := mockClient.GetSecretString(context.TODO(), "default", "db", "USER"); value != "root" {
+		t.Errorf("USER = %q after overwrite, want root", value)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	mockClient := newMockClient()
+	mockClient.CreateSecret(context.TODO(), &k8s.SecretData{Name: "db", Namespace: "prod", Data: map[string]string{"password": "s3cr3t"}})
+	identity, _ := age.GenerateX25519Identity()
+	other, _ := age.GenerateX25519Identity()
+
+	router := mux.NewRouter()
+	allowed := NewHandler(mockClient, WithRevealAuthorizer(AllowReveal))
+	router.HandleFunc("/api/v1/admin/backup", allowed.Backup).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/admin/restore", allowed.Restore).Methods(http.MethodPost)
+	router.HandleFunc("/masked/api/v1/admin/backup", NewHandler(mockClient).Backup).Methods(http.MethodPost)
+	router.HandleFunc("/masked/api/v1/admin/restore", NewHandler(mockClient).Restore).Methods(http.MethodPost)
+	limited := NewHandler(mockClient, WithRevealAuthorizer(AllowReveal))
+	limited.maxRestoreSize = 16
+	router.HandleFunc("/limited/api/v1/admin/restore", limited.Restore).Methods(http.MethodPost)
+
+	backupBody := `{"namespaces":["prod"],"recipients":["` + identity.Recipient().String() + `"]}`
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/admin/backup", strings.NewReader(backupBody)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("backup returned %v: %s", rr.Code, rr.Body.String())
+	}
+	archive := rr.Body.Bytes()
+
+	tests := []struct {
+		name       string
+		path       string
+		body       []byte
+		identity   string
+		wantStatus int
+		wantBody   string
+	}{
+		{"backup needs reveal", "/masked/api/v1/admin/backup", []byte(backupBody), "", http.StatusForbidden, ""},
+		{"backup needs a key", "/api/v1/admin/backup", []byte(`{}`), "", http.StatusBadRequest, ""},
+		{"dry run restore", "/api/v1/admin/restore?dryRun=true&namespaceMap=prod=prod-restored", archive, identity.String(), http.StatusOK, `"prod-restored/db"`},
+		{"wrong identity", "/api/v1/admin/restore", archive, other.String(), http.StatusForbidden, ""},
+		{"restore needs reveal", "/masked/api/v1/admin/restore?namespaceMap=prod=masked", archive, identity.String(), http.StatusForbidden, ""},
+		{"archive too large", "/limited/api/v1/admin/restore?namespaceMap=prod=limited", archive, identity.String(), http.StatusRequestEntityTooLarge, `"TOO_LARGE"`},
+		{"restore", "/api/v1/admin/restore?namespaceMap=prod=dr", archive, identity.String(), http.StatusOK, `"dr/db"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(tt.body))
+			if tt.identity != "" {
+				req.Header.Set("X-Backup-Identity", tt.identity)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	for _, namespace := range []string{"prod-restored", "masked", "limited"} {
+		if _, err := mockClient.GetSecret(context.TODO(), namespace, "db"); err == nil {
+			t.Errorf("refused or dry run restore wrote %s/db", namespace)
+		}
+	}
+	if value, _ := mockClient.GetSecretString(context.TODO(), "dr", "db", "key1"); value != "value1" {
+		t.Errorf("restored key1 = %q, want value1", value)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	mockClient := newMockClient()
+	mockClient.CreateSecret(context.TODO(), &k8s.SecretData{Name: "db", Namespace: "default", Data: map[string]string{"USER": "admin"}})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/diff", NewHandler(mockClient, WithRevealAuthorizer(AllowReveal)).Diff).Methods(http.MethodPost)
+	router.HandleFunc("/masked/api/v1/diff", NewHandler(mockClient).Diff).Methods(http.MethodPost)
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   []string
+	}{
+		{"in sync", "/api/v1/diff", `{"name": "db", "data": {"USER": "admin"}}`, http.StatusOK,
+			[]string{`"drift":false`, `"status":"in-sync"`}},
+		{"masked drift", "/api/v1/diff", `[{"name": "db", "data": {"USER": "root"}}, {"name": "api"}]`, http.StatusOK,
+			[]string{`"drift":true`, `"status":"drift"`, `"status":"missing"`, `"new":"sha256:`}},
+		{"revealed", "/api/v1/diff?format=env&name=db&reveal=true", "USER=root\n", http.StatusOK,
+			[]string{`"old":"admin","new":"root"`}},
+		{"reveal not allowed", "/masked/api/v1/diff?reveal=true", `{"name": "db"}`, http.StatusForbidden, nil},
+		{"invalid body", "/api/v1/diff", `{"data": {}}`, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(rr.Body.String(), want) {
+					t.Errorf("body = %q, want it to contain %q", rr.Body.String(), want)
+				}
+			}
+		})
+	}
+}
+
+type externalStatus []external.Status
+
+func (s externalStatus) Status() []external.Status { return s }
+
+func TestExternalStatus(t *testing.T) {
+	reporter := externalStatus{{Namespace: "default", Name: "db", Source: external.SourceConfig, State: external.StateSynced}}
+
+	tests := []struct {
+		name       string
+		handler    *Handler
+		wantStatus int
+		wantBody   string
+	}{
+		{"enabled", NewHandler(newMockClient(), WithExternalStatus(reporter)), http.StatusOK, `"state":"synced"`},
+		{"disabled", NewHandler(newMockClient()), http.StatusNotImplemented, apperrors.CodeNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tt.handler.ExternalStatus(rr, httptest.NewRequest(http.MethodGet, "/api/v1/external/status", nil))
+			if rr.Code != tt.wantStatus || !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("got %v %s, want %v with %q", rr.Code, rr.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "ops"}})
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.User == "alice" && review.Spec.ResourceAttributes.Verb == "get"
+		return true, review, nil
+	})
+
+	tests := []struct {
+		name       string
+		client     k8s.SecretManager
+		method     string
+		identity   *api.Identity
+		wantStatus int
+		wantReason string
+	}{
+		{"allowed", k8s.NewClientForClientset(clientset), http.MethodGet, &api.Identity{Username: "alice"}, http.StatusOK, ""},
+		{"denied verb", k8s.NewClientForClientset(clientset), http.MethodDelete, &api.Identity{Username: "alice"}, http.StatusForbidden, apperrors.CodeForbidden},
+		{"denied user", k8s.NewClientForClientset(clientset), http.MethodGet, &api.Identity{Username: "bob"}, http.StatusForbidden, apperrors.CodeForbidden},
+		{"unauthenticated", k8s.NewClientForClientset(clientset), http.MethodGet, nil, http.StatusUnauthorized, apperrors.CodeUnauthorized},
+		{"unsupported backend", newMockClient(), http.MethodGet, &api.Identity{Username: "alice"}, http.StatusNotImplemented, apperrors.CodeNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler(tt.client, WithAuthorizer(AccessReview))
+			router := mux.NewRouter()
+			router.HandleFunc("/api/v1/secrets/{namespace}/{name}", handler.GetSecret).Methods(http.MethodGet)
+			router.HandleFunc("/api/v1/secrets/{namespace}/{name}", handler.DeleteSecret).Methods(http.MethodDelete)
+
+			req := httptest.NewRequest(tt.method, "/api/v1/secrets/ops/db", nil)
+			if tt.identity != nil {
+				req = req.WithContext(api.WithIdentity(req.Context(), tt.identity))
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantReason == "" {
+				return
+			}
+			var response api.ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Reason != tt.wantReason || response.Code != tt.wantStatus {
+				t.Errorf("error response = %+v (%v), want reason %s", response, err, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	p, err := policy.Parse([]byte("rules: [{id: team-label, requiredLabels: [team]}, {id: no-debug, forbiddenKeys: [debug]}]"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	handler := NewHandler(newMockClient(), WithPolicy(p))
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/secrets", handler.CreateSecret).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/validate", handler.Validate).Methods(http.MethodPost)
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		wantRules  []string
+	}{
+		{"create compliant", "/api/v1/secrets", `{"name": "db", "namespace": "default", "labels": {"team": "api"}, "data": {"password": "x"}}`, http.StatusCreated, nil},
+		{"create violating", "/api/v1/secrets", `{"name": "api", "namespace": "default", "data": {"debug": "x"}}`, http.StatusBadRequest, []string{"team-label", "no-debug"}},
+		{"validate compliant", "/api/v1/validate", `{"name": "api", "namespace": "default", "labels": {"team": "api"}, "data": {"password": "x"}}`, http.StatusOK, nil},
+		{"validate violating", "/api/v1/validate", `{"name": "api", "namespace": "default", "data": {"bad key": "x"}}`, http.StatusOK, []string{"", "team-label"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			var response struct {
+				Valid      *bool                  `json:"valid"`
+				Violations []*k8s.ValidationError `json:"violations"`
+			}
+			json.Unmarshal(rr.Body.Bytes(), &response)
+			if response.Valid != nil && *response.Valid != (len(tt.wantRules) == 0) {
+				t.Errorf("valid = %v, want %v", *response.Valid, len(tt.wantRules) == 0)
+			}
+			if len(response.Violations) != len(tt.wantRules) {
+				t.Fatalf("violations = %s, want rules %v", rr.Body.String(), tt.wantRules)
+			}
+			for i, v := range response.Violations {
+				if v.Rule != tt.wantRules[i] {
+					t.Errorf("violation %d = %+v, want rule %q", i, v, tt.wantRules[i])
+				}
+			}
+		})
+	}
+}
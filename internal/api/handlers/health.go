@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+)
+
+// Healthz reports that the process is up
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, "ok")
+}
+
+// Readyz reports ready once every cluster with a read cache has synced it
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	ready := true
+	caches := make(map[string]k8s.CacheStats)
+	for _, name := range h.clusters.Names() {
+		stats, ok := h.cacheStats(name)
+		if !ok || !stats.Enabled {
+			continue
+		}
+		caches[name] = stats
+		ready = ready && stats.Synced
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ready":  ready,
+		"caches": caches,
+	})
+}
+
+// Metrics exposes the read cache counters in the Prometheus text format
+func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	metrics := []struct {
+		name  string
+		help  string
+		kind  string
+		value func(k8s.CacheStats) uint64
+	}{
+		{"k8s_secrets_manager_cache_hits_total", "Secret reads served from the informer cache.", "counter",
+			func(s k8s.CacheStats) uint64 { return s.Hits }},
+		{"k8s_secrets_manager_cache_misses_total", "Secret reads sent to the API server while the cache was enabled.", "counter",
+			func(s k8s.CacheStats) uint64 { return s.Misses }},
+		{"k8s_secrets_manager_cache_synced", "Whether the informer cache has synced.", "gauge",
+			func(s k8s.CacheStats) uint64 {
+				if s.Synced {
+					return 1
+				}
+				return 0
+			}},
+	}
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, name := range h.clusters.Names() {
+			stats, ok := h.cacheStats(name)
+			if !ok || !stats.Enabled {
+				continue
+			}
+			fmt.Fprintf(w, "%s{cluster=%q} %d\n", m.name, name, m.value(stats))
+		}
+	}
+}
+
+func (h *Handler) cacheStats(cluster string) (k8s.CacheStats, bool) {
+	client, err := h.clusters.Get(cluster)
+	if err != nil {
+		return k8s.CacheStats{}, false
+	}
+	reporter, ok := client.(k8s.CacheReporter)
+	if !ok {
+		return k8s.CacheStats{}, false
+	}
+	return reporter.CacheStats(), true
+}
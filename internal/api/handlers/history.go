@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+)
+
+// ListRevisions lists the recorded revisions of a secret, oldest first
+func (h *Handler) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	revisions, err := client.ListRevisions(r.Context(), vars["namespace"], vars["name"])
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	views := make([]api.RevisionView, 0, len(revisions))
+	for _, revision := range revisions {
+		views = append(views, revisionView(&revision, false))
+	}
+	api.WriteJSON(w, http.StatusOK, views)
+}
+
+// GetRevision returns a revision of a secret, masked unless ?reveal=true
+func (h *Handler) GetRevision(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	namespace, name := vars["namespace"], vars["name"]
+	number, ok := revisionNumber(w, r)
+	if !ok {
+		return
+	}
+
+	reveal := revealRequested(r)
+	if reveal && !h.reveal(w, r, namespace, name, "") {
+		return
+	}
+
+	revision, err := client.GetRevision(r.Context(), namespace, name, number)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	if reveal {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	api.WriteJSON(w, http.StatusOK, revisionView(revision, reveal))
+}
+
+// Rollback restores a secret from one of its revisions
+func (h *Handler) Rollback(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	number, ok := revisionNumber(w, r)
+	if !ok {
+		return
+	}
+
+	secret, err := client.Rollback(r.Context(), vars["namespace"], vars["name"], number)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(secret.ResourceVersion))
+	api.WriteJSON(w, http.StatusOK, api.NewSecretView(secret, false))
+}
+
+func revisionNumber(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	number, err := strconv.ParseInt(mux.Vars(r)["revision"], 10, 64)
+	if err != nil || number < 1 {
+		api.WriteErrorResponse(w, apperrors.CodeBadRequest, "revision must be a positive integer", "")
+		return 0, false
+	}
+	return number, true
+}
+
+func revisionView(revision *k8s.Revision, reveal bool) api.RevisionView {
+	view := api.RevisionView{
+		Revision:        revision.Revision,
+		CreatedAt:       revision.CreatedAt,
+		ResourceVersion: revision.ResourceVersion,
+	}
+	if revision.Secret != nil {
+		secret := api.NewSecretView(revision.Secret, reveal)
+		view.Secret = &secret
+	}
+	return view
+}
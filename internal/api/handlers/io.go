@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+
+	"filippo.io/age"
+	"github.com/gorilla/mux"
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
+)
+
+// ExportSecrets exports the secrets of ?namespace= matching ?labelSelector=
+// in ?format= (manifest by default). Exports carry values, so they need the
+// reveal permission.
+func (h *Handler) ExportSecrets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	h.export(w, r, secretio.ExportOptions{
+		Namespace:     query.Get("namespace"),
+		LabelSelector: query.Get("labelSelector"),
+	})
+}
+
+// ExportSecret exports a single secret in ?format=
+func (h *Handler) ExportSecret(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	h.export(w, r, secretio.ExportOptions{Namespace: vars["namespace"], Name: vars["name"]})
+}
+
+func (h *Handler) export(w http.ResponseWriter, r *http.Request, opts secretio.ExportOptions) {
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	format, err := secretio.ParseFormat(queryDefault(r, "format", string(secretio.FormatManifest)))
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	opts.Format = format
+
+	if !h.reveal(w, r, opts.Namespace, opts.Name, "") {
+		return
+	}
+
+	// Buffer the export so that a failure still produces an error response
+	var out bytes.Buffer
+	if err := secretio.Export(r.Context(), client, &out, opts); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(out.Bytes())
+}
+
+// WithDecryptIdentities decrypts encrypted files posted to import and diff
+func WithDecryptIdentities(identities []age.Identity) Option {
+	return func(h *Handler) {
+		h.identities = identities
+	}
+}
+
+// ImportSecrets imports the request body in ?format= into ?namespace=.
+// ?conflict= is skip (default), overwrite or fail; ?name= names the secret
+// of env input and single secret JSON or YAML; ?type= sets the type of
+// secrets read from flat formats. A namespace given for manifests overrides
+// theirs.
+func (h *Handler) ImportSecrets(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	format, err := secretio.ParseFormat(queryDefault(r, "format", string(secretio.FormatManifest)))
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	conflict, err := secretio.ParseConflictPolicy(queryDefault(r, "conflict", string(secretio.ConflictSkip)))
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	namespace := query.Get("namespace")
+	result, err := secretio.Import(r.Context(), client, r.Body, secretio.ImportOptions{
+		Namespace:         namespace,
+		OverrideNamespace: namespace != "",
+		Name:              query.Get("name"),
+		Type:              query.Get("type"),
+		Format:            format,
+		Conflict:          conflict,
+		Identities:        h.identities,
+	})
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if len(result.Created) > 0 {
+		status = http.StatusCreated
+	}
+	api.WriteJSON(w, status, result)
+}
+
+func queryDefault(r *http.Request, name, def string) string {
+	if value := r.URL.Query().Get(name); value != "" {
+		return value
+	}
+	return def
+}
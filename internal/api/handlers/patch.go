@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/gorilla/mux"
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/validator"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// secretDocument is the JSON document PATCH requests operate on, e.g.
+// {"data": {"password": "new", "stale-key": null}} as a merge patch or
+// [{"op": "move", "from": "/data/old", "path": "/data/new"}] as a JSON patch.
+// Values that are not valid UTF-8 live base64 encoded in binaryData.
+type secretDocument struct {
+	Data        map[string]string `json:"data"`
+	BinaryData  map[string][]byte `json:"binaryData"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+func newSecretDocument(secret *corev1.Secret) *secretDocument {
+	doc := &secretDocument{
+		Data:        make(map[string]string, len(secret.Data)),
+		BinaryData:  make(map[string][]byte),
+		Labels:      make(map[string]string, len(secret.Labels)),
+		Annotations: make(map[string]string, len(secret.Annotations)),
+	}
+	for key, value := range secret.Data {
+		if api.EncodingOf(value) == api.EncodingBase64 {
+			doc.BinaryData[key] = value
+			continue
+		}
+		doc.Data[key] = string(value)
+	}
+	for key, value := range secret.Labels {
+		doc.Labels[key] = value
+	}
+	for key, value := range secret.Annotations {
+		doc.Annotations[key] = value
+	}
+	return doc
+}
+
+// diffDocuments turns the change between two documents into a SecretPatch
+func diffDocuments(from, to *secretDocument) *k8s.SecretPatch {
+	patch := &k8s.SecretPatch{}
+	patch.Set, patch.Unset = diffMaps(from.values(), to.values())
+	patch.SetLabels, patch.UnsetLabels = diffMaps(from.Labels, to.Labels)
+	patch.SetAnnotations, patch.UnsetAnnotations = diffMaps(from.Annotations, to.Annotations)
+	return patch
+}
+
+// values merges data and binaryData; Go strings hold arbitrary bytes, so the
+// binary values survive the trip through a SecretPatch
+func (d *secretDocument) values() map[string]string {
+	values := make(map[string]string, len(d.Data)+len(d.BinaryData))
+	for key, value := range d.BinaryData {
+		values[key] = string(value)
+	}
+	for key, value := range d.Data {
+		values[key] = value
+	}
+	return values
+}
+
+func diffMaps(from, to map[string]string) (map[string]string, []string) {
+	set := make(map[string]string)
+	var unset []string
+
+	for key, value := range to {
+		if current, ok := from[key]; !ok || current != value {
+			set[key] = value
+		}
+	}
+	for key := range from {
+		if _, ok := to[key]; !ok {
+			unset = append(unset, key)
+		}
+	}
+	return set, unset
+}
+
+// PatchSecret applies a JSON merge patch (RFC 7386) or a JSON patch
+// (RFC 6902) to the data, labels and annotations of a secret
+func (h *Handler) PatchSecret(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	name := vars["name"]
+	namespace := vars["namespace"]
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != mergePatchContentType && contentType != jsonPatchContentType {
+		api.WriteErrorResponse(w, apperrors.CodeUnsupportedMedia, "unsupported patch content type",
+			"use "+mergePatchContentType+" or "+jsonPatchContentType)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		api.WriteErrorResponse(w, apperrors.CodeBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	current, err := client.GetSecret(r.Context(), namespace, name)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	// The read above may come from the cache, so If-Match is checked by the
+	// write rather than against it
+	resourceVersion, conditional := ifMatch(r)
+	if resourceVersion == "" {
+		resourceVersion = current.ResourceVersion
+	}
+
+	original := newSecretDocument(current)
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	var patchedJSON []byte
+	if contentType == mergePatchContentType {
+		patchedJSON, err = jsonpatch.MergePatch(originalJSON, body)
+	} else {
+		var ops jsonpatch.Patch
+		ops, err = jsonpatch.DecodePatch(body)
+		if err == nil {
+			patchedJSON, err = ops.Apply(originalJSON)
+		}
+	}
+	if err != nil {
+		api.WriteErrorResponse(w, apperrors.CodeBadRequest, "invalid patch", err.Error())
+		return
+	}
+
+	var patched secretDocument
+	if err := json.Unmarshal(patchedJSON, &patched); err != nil {
+		api.WriteErrorResponse(w, apperrors.CodeInvalid, "patch produced an invalid secret", err.Error())
+		return
+	}
+
+	patch := diffDocuments(original, &patched)
+	if patch.IsEmpty() && resourceVersion == current.ResourceVersion {
+		w.Header().Set("ETag", etag(current.ResourceVersion))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err := validator.ValidateSecretPatch(patch); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	result := current.DeepCopy()
+	if err := patch.Apply(result); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	if err := validator.ValidateSecretType(k8s.NewSecretData(result)); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	// The patch was computed against the version read above, or the one the
+	// caller asked for, so the write must not land on a newer one
+	patch.ResourceVersion = resourceVersion
+
+	updated, err := client.PatchSecret(r.Context(), namespace, name, patch)
+	if err != nil {
+		writeUpdateError(w, err, conditional)
+		return
+	}
+
+	w.Header().Set("ETag", etag(updated.ResourceVersion))
+	w.WriteHeader(http.StatusOK)
+}
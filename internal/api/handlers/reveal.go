@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/rs/zerolog"
+)
+
+// RevealAuthorizer decides whether the caller of r may read the values of a
+// secret. key is empty when the whole secret is revealed.
+type RevealAuthorizer func(r *http.Request, namespace, name, key string) bool
+
+// Option configures a Handler
+type Option func(*Handler)
+
+// WithRevealAuthorizer lets requests that authorize reveal secret values.
+// Without it values are never returned.
+func WithRevealAuthorizer(authorize RevealAuthorizer) Option {
+	return func(h *Handler) {
+		h.authorizeReveal = authorize
+	}
+}
+
+// AllowReveal authorizes every reveal request
+func AllowReveal(r *http.Request, namespace, name, key string) bool {
+	return true
+}
+
+// WithAuditLogger records every reveal attempt to logger
+func WithAuditLogger(logger *zerolog.Logger) Option {
+	return func(h *Handler) {
+		h.audit = logger
+	}
+}
+
+// reveal reports whether the caller may read the values of the secret and
+// audits the attempt. When it returns false a 403 has already been written.
+func (h *Handler) reveal(w http.ResponseWriter, r *http.Request, namespace, name, key string) bool {
+	allowed := h.authorizeReveal != nil && h.authorizeReveal(r, namespace, name, key)
+
+	event := h.audit.Info()
+	if identity := api.IdentityFrom(r.Context()); identity != nil {
+		event = event.Str("user", identity.Username).Str("authMethod", identity.Method)
+	}
+	event.Str("event", "secret.reveal").
+		Str("cluster", mux.Vars(r)["cluster"]).
+		Str("namespace", namespace).
+		Str("name", name).
+		Str("key", key).
+		Str("remoteAddr", r.RemoteAddr).
+		Bool("allowed", allowed).
+		Msg("secret value requested")
+
+	if !allowed {
+		api.WriteErrorResponse(w, apperrors.CodeForbidden, "revealing secret values is not allowed", "")
+	}
+	return allowed
+}
+
+func revealRequested(r *http.Request) bool {
+	reveal, _ := strconv.ParseBool(r.URL.Query().Get("reveal"))
+	return reveal
+}
+
+// GetSecretKey returns the value of a single key of a secret
+func (h *Handler) GetSecretKey(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	name := vars["name"]
+	namespace := vars["namespace"]
+	key := vars["key"]
+
+	if !h.reveal(w, r, namespace, name, key) {
+		return
+	}
+
+	value, err := client.GetSecretString(r.Context(), namespace, name, key)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	response := api.SecretValueResponse{Key: key, Value: value, Encoding: api.EncodingOf([]byte(value))}
+	if response.Encoding == api.EncodingBase64 {
+		response.Value = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	api.WriteJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/policy"
+	"github.com/mpalu/k8s-secrets-manager/internal/validator"
+)
+
+// WithPolicy refuses creates, updates and patches of secrets violating p
+func WithPolicy(p *policy.Policy) Option {
+	return func(h *Handler) {
+		h.policy = p
+	}
+}
+
+// Validate is a dry run of creating the secret of the request body. It
+// answers 200 with every violation found, the secret is not written.
+func (h *Handler) Validate(w http.ResponseWriter, r *http.Request) {
+	var secretData k8s.SecretData
+	if err := json.NewDecoder(r.Body).Decode(&secretData); err != nil {
+		api.WriteErrorResponse(w, apperrors.CodeBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	violations := k8s.ValidationErrors{}
+	if err := validator.ValidateSecretData(&secretData); err != nil {
+		var invalid *k8s.ValidationError
+		if !errors.As(err, &invalid) {
+			api.WriteError(w, err)
+			return
+		}
+		violations = append(violations, invalid)
+	}
+	if h.policy != nil {
+		violations = append(violations, h.policy.EvaluateData(&secretData)...)
+	}
+
+	api.WriteJSON(w, http.StatusOK, api.ValidationResponse{
+		Valid:      len(violations) == 0,
+		Violations: violations,
+	})
+}
@@ -0,0 +1,33 @@
+package api
+
+import "context"
+
+// Authentication methods recorded on an Identity
+const (
+	AuthMethodToken       = "token"
+	AuthMethodTokenReview = "tokenreview"
+	AuthMethodCertificate = "x509"
+)
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	Username string
+	UID      string
+	Groups   []string
+	// Method is how the caller authenticated, e.g. AuthMethodToken
+	Method string
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying identity
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFrom returns the identity stored in ctx by the authentication
+// middleware, or nil when the request was not authenticated
+func IdentityFrom(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey{}).(*Identity)
+	return identity
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+)
+
+// WriteJSON encodes v as the JSON response body with the given status
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// WriteError answers with the status and error code err is classified as.
+// Validation errors of a whole secret are listed as violations.
+func WriteError(w http.ResponseWriter, err error) {
+	var violations k8s.ValidationErrors
+	if errors.As(err, &violations) {
+		status := apperrors.HTTPStatus(apperrors.CodeInvalid)
+		WriteJSON(w, status, ErrorResponse{
+			Error:      err.Error(),
+			Code:       status,
+			Reason:     apperrors.CodeInvalid,
+			Violations: violations,
+		})
+		return
+	}
+	WriteErrorResponse(w, apperrors.CodeOf(err), err.Error(), "")
+}
+
+// WriteErrorResponse answers with the ErrorResponse shape and the HTTP status
+// of code
+func WriteErrorResponse(w http.ResponseWriter, code, message, details string) {
+	status := apperrors.HTTPStatus(code)
+	WriteJSON(w, status, ErrorResponse{
+		Error:   message,
+		Code:    status,
+		Reason:  code,
+		Details: details,
+	})
+}
@@ -8,19 +8,45 @@ import (
 	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
 )
 
-func NewRouter(client *k8s.Client) *mux.Router {
+func NewRouter(clusters *k8s.Registry, opts ...handlers.Option) *mux.Router {
 	r := mux.NewRouter()
-	h := handlers.NewHandler(client)
+	h := handlers.NewClusterHandler(clusters, opts...)
+
+	r.HandleFunc("/healthz", h.Healthz).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", h.Readyz).Methods(http.MethodGet)
+	r.HandleFunc("/metrics", h.Metrics).Methods(http.MethodGet)
 
 	// API v1
 	v1 := r.PathPrefix("/api/v1").Subrouter()
 
-	// Secrets endpoints
-	v1.HandleFunc("/secrets", h.CreateSecret).Methods(http.MethodPost)
-	v1.HandleFunc("/secrets", h.ListSecrets).Methods(http.MethodGet)
-	v1.HandleFunc("/secrets/{name}", h.GetSecret).Methods(http.MethodGet)
-	v1.HandleFunc("/secrets/{name}", h.UpdateSecret).Methods(http.MethodPut)
-	v1.HandleFunc("/secrets/{name}", h.DeleteSecret).Methods(http.MethodDelete)
+	v1.HandleFunc("/clusters", h.ListClusters).Methods(http.MethodGet)
+	v1.HandleFunc("/external/status", h.ExternalStatus).Methods(http.MethodGet)
+	v1.HandleFunc("/validate", h.Validate).Methods(http.MethodPost)
+
+	// Secrets endpoints, on the default cluster and per named cluster
+	registerSecretRoutes(v1, h)
+	registerSecretRoutes(v1.PathPrefix("/clusters/{cluster}").Subrouter(), h)
 
 	return r
 }
+
+func registerSecretRoutes(r *mux.Router, h *handlers.Handler) {
+	r.HandleFunc("/secrets", h.CreateSecret).Methods(http.MethodPost)
+	r.HandleFunc("/secrets", h.ListSecrets).Methods(http.MethodGet)
+	r.HandleFunc("/secrets/export", h.ExportSecrets).Methods(http.MethodGet)
+	r.HandleFunc("/secrets/import", h.ImportSecrets).Methods(http.MethodPost)
+	r.HandleFunc("/admin/backup", h.Backup).Methods(http.MethodPost)
+	r.HandleFunc("/admin/restore", h.Restore).Methods(http.MethodPost)
+	r.HandleFunc("/diff", h.Diff).Methods(http.MethodPost)
+	r.HandleFunc("/secrets/{namespace}/{name}", h.GetSecret).Methods(http.MethodGet)
+	r.HandleFunc("/secrets/{namespace}/{name}/keys/{key}", h.GetSecretKey).Methods(http.MethodGet)
+	r.HandleFunc("/secrets/{namespace}/{name}/export", h.ExportSecret).Methods(http.MethodGet)
+	r.HandleFunc("/secrets/{namespace}/{name}/copy", h.CopySecret).Methods(http.MethodPost)
+	r.HandleFunc("/secrets/{namespace}/{name}/generate", h.GenerateSecret).Methods(http.MethodPost)
+	r.HandleFunc("/secrets/{namespace}/{name}/revisions", h.ListRevisions).Methods(http.MethodGet)
+	r.HandleFunc("/secrets/{namespace}/{name}/revisions/{revision}", h.GetRevision).Methods(http.MethodGet)
+	r.HandleFunc("/secrets/{namespace}/{name}/revisions/{revision}/rollback", h.Rollback).Methods(http.MethodPost)
+	r.HandleFunc("/secrets/{namespace}/{name}", h.UpdateSecret).Methods(http.MethodPut)
+	r.HandleFunc("/secrets/{namespace}/{name}", h.PatchSecret).Methods(http.MethodPatch)
+	r.HandleFunc("/secrets/{namespace}/{name}", h.DeleteSecret).Methods(http.MethodDelete)
+}
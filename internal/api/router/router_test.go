@@ -0,0 +1,65 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/api/handlers"
+	"github.com/mpalu/k8s-secrets-manager/internal/backend"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+)
+
+// TestMemoryBackend runs the REST API end to end against the in-memory
+// backend. The steps share one store and run in order.
+func TestMemoryBackend(t *testing.T) {
+	store := backend.NewMemory()
+	if err := store.EnableHistory(10); err != nil {
+		t.Fatal(err)
+	}
+	clusters := k8s.NewRegistry()
+	clusters.Register(k8s.DefaultClusterName, store)
+	router := NewRouter(clusters, handlers.WithRevealAuthorizer(handlers.AllowReveal))
+
+	steps := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantBody    string
+	}{
+		{"create", http.MethodPost, "/api/v1/secrets", "application/json",
+			`{"name": "db", "namespace": "default", "data": {"password": "v1"}, "labels": {"app": "db"}}`, http.StatusCreated, ""},
+		{"create existing", http.MethodPost, "/api/v1/secrets", "application/json",
+			`{"name": "db", "namespace": "default", "data": {"password": "v1"}}`, http.StatusConflict, ""},
+		{"get masked", http.MethodGet, "/api/v1/secrets/default/db", "", "", http.StatusOK, `"name":"db"`},
+		{"patch", http.MethodPatch, "/api/v1/secrets/default/db", "application/merge-patch+json",
+			`{"data": {"password": "v2"}}`, http.StatusOK, ""},
+		{"reveal key", http.MethodGet, "/api/v1/secrets/default/db/keys/password", "", "", http.StatusOK, "v2"},
+		{"list by label", http.MethodGet, "/api/v1/secrets?namespace=default&labelSelector=app%3Ddb", "", "", http.StatusOK, `"name":"db"`},
+		{"revisions", http.MethodGet, "/api/v1/secrets/default/db/revisions", "", "", http.StatusOK, `"revision":1`},
+		{"rollback", http.MethodPost, "/api/v1/secrets/default/db/revisions/1/rollback", "", "", http.StatusOK, ""},
+		{"reveal after rollback", http.MethodGet, "/api/v1/clusters/default/secrets/default/db/keys/password", "", "", http.StatusOK, "v1"},
+		{"delete", http.MethodDelete, "/api/v1/secrets/default/db", "", "", http.StatusNoContent, ""},
+		{"get deleted", http.MethodGet, "/api/v1/secrets/default/db", "", "", http.StatusNotFound, ""},
+	}
+
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, step.path, strings.NewReader(step.body))
+		if step.contentType != "" {
+			req.Header.Set("Content-Type", step.contentType)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != step.wantStatus {
+			t.Fatalf("%s: got status %v want %v: %s", step.name, rr.Code, step.wantStatus, rr.Body.String())
+		}
+		if !strings.Contains(rr.Body.String(), step.wantBody) {
+			t.Errorf("%s: body = %q, want it to contain %q", step.name, rr.Body.String(), step.wantBody)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+)
+
+// Authenticator identifies the caller of a request. It returns nil and no
+// error when the request carries no credentials it recognises, so that the
+// next authenticator can try; an error rejects the request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*api.Identity, error)
+}
+
+// Authenticate puts the identity found by the first successful
+// authenticator on the request context and answers 401 when none succeeds.
+// Requests for publicPaths, e.g. health probes, pass unauthenticated.
+func Authenticate(authenticators []Authenticator, publicPaths ...string) Middleware {
+	public := make(map[string]bool, len(publicPaths))
+	for _, path := range publicPaths {
+		public[path] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if public[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, authenticator := range authenticators {
+				identity, err := authenticator.Authenticate(r)
+				if err != nil {
+					unauthorized(w, err.Error())
+					return
+				}
+				if identity != nil {
+					next.ServeHTTP(w, r.WithContext(api.WithIdentity(r.Context(), identity)))
+					return
+				}
+			}
+			unauthorized(w, "")
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, details string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="k8s-secrets-manager"`)
+	api.WriteErrorResponse(w, apperrors.CodeUnauthorized, "authentication required", details)
+}
+
+// bearerToken returns the token of an Authorization: Bearer header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// TokenAuthenticator accepts static bearer tokens. Tokens are held as
+// SHA-256 digests only.
+type TokenAuthenticator struct {
+	tokens map[[sha256.Size]byte]*api.Identity
+}
+
+// NewTokenAuthenticator reads a token file in the format of the Kubernetes
+// API server: one token,user,uid,"group1,group2" line per token, the uid
+// and groups being optional. Lines starting with # are ignored.
+func NewTokenAuthenticator(path string) (*TokenAuthenticator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading token file: %w", err)
+	}
+	defer file.Close()
+	return ReadTokens(file)
+}
+
+// ReadTokens reads tokens in the format of NewTokenAuthenticator
+func ReadTokens(r io.Reader) (*TokenAuthenticator, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	a := &TokenAuthenticator{tokens: make(map[[sha256.Size]byte]*api.Identity)}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading token file: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) < 2 || record[0] == "" || record[1] == "" {
+			return nil, fmt.Errorf("token file line %d: token and user are required", line)
+		}
+
+		identity := &api.Identity{Username: record[1], Method: api.AuthMethodToken}
+		if len(record) > 2 {
+			identity.UID = record[2]
+		}
+		if len(record) > 3 && record[3] != "" {
+			identity.Groups = strings.Split(record[3], ",")
+		}
+
+		digest := sha256.Sum256([]byte(record[0]))
+		if _, exists := a.tokens[digest]; exists {
+			return nil, fmt.Errorf("token file line %d: duplicate token", line)
+		}
+		a.tokens[digest] = identity
+	}
+	return a, nil
+}
+
+// Authenticate looks the bearer token up. Unknown tokens are left to the
+// next authenticator.
+func (a *TokenAuthenticator) Authenticate(r *http.Request) (*api.Identity, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, nil
+	}
+	return a.tokens[sha256.Sum256([]byte(token))], nil
+}
+
+// maxCachedReviews bounds the TokenReview cache; expired entries are dropped
+// once it is reached
+const maxCachedReviews = 1024
+
+// TokenReviewAuthenticator validates bearer tokens, e.g. ServiceAccount
+// tokens, with the TokenReview API of a cluster. Results are cached for a
+// short time so that every request does not cost a review.
+type TokenReviewAuthenticator struct {
+	reviewer  k8s.TokenReviewer
+	audiences []string
+	ttl       time.Duration
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cachedReview
+}
+
+type cachedReview struct {
+	identity *api.Identity
+	err      error
+	expires  time.Time
+}
+
+// NewTokenReviewAuthenticator reviews tokens with reviewer. audiences, when
+// set, must intersect the audiences of the token. ttl of zero disables the
+// cache.
+func NewTokenReviewAuthenticator(reviewer k8s.TokenReviewer, audiences []string, ttl time.Duration) *TokenReviewAuthenticator {
+	return &TokenReviewAuthenticator{
+		reviewer:  reviewer,
+		audiences: audiences,
+		ttl:       ttl,
+		cache:     make(map[[sha256.Size]byte]cachedReview),
+	}
+}
+
+// Authenticate reviews the bearer token. A token the cluster rejects is an
+// error, so it should come after authenticators of other bearer tokens.
+func (a *TokenReviewAuthenticator) Authenticate(r *http.Request) (*api.Identity, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, nil
+	}
+
+	digest := sha256.Sum256([]byte(token))
+	now := time.Now()
+	a.mu.Lock()
+	cached, found := a.cache[digest]
+	a.mu.Unlock()
+	if found && now.Before(cached.expires) {
+		return cached.identity, cached.err
+	}
+
+	var identity *api.Identity
+	user, err := a.reviewer.ReviewToken(r.Context(), token, a.audiences)
+	if err == nil {
+		identity = &api.Identity{
+			Username: user.Username,
+			UID:      user.UID,
+			Groups:   user.Groups,
+			Method:   api.AuthMethodTokenReview,
+		}
+	} else if apperrors.CodeOf(err) != apperrors.CodeUnauthorized {
+		// The review itself failed, do not cache that
+		return nil, err
+	}
+
+	if a.ttl > 0 {
+		a.mu.Lock()
+		if len(a.cache) >= maxCachedReviews {
+			for key, entry := range a.cache {
+				if now.After(entry.expires) {
+					delete(a.cache, key)
+				}
+			}
+		}
+		if len(a.cache) < maxCachedReviews {
+			a.cache[digest] = cachedReview{identity: identity, err: err, expires: now.Add(a.ttl)}
+		}
+		a.mu.Unlock()
+	}
+	return identity, err
+}
+
+// CertificateAuthenticator accepts client certificates verified by the TLS
+// handshake. Like the Kubernetes API server it takes the user from the
+// common name and the groups from the organizations of the subject.
+type CertificateAuthenticator struct{}
+
+func (CertificateAuthenticator) Authenticate(r *http.Request) (*api.Identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	if subject.CommonName == "" {
+		return nil, fmt.Errorf("client certificate has no common name")
+	}
+	return &api.Identity{
+		Username: subject.CommonName,
+		Groups:   subject.Organization,
+		Method:   api.AuthMethodCertificate,
+	}, nil
+}
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+// reviewer accepts the token "sa-token" and counts the reviews
+type reviewer struct {
+	reviews int
+}
+
+func (f *reviewer) ReviewToken(ctx context.Context, token string, audiences []string) (*authenticationv1.UserInfo, error) {
+	f.reviews++
+	if token != "sa-token" {
+		return nil, apperrors.New(apperrors.CodeUnauthorized, "token is not valid")
+	}
+	return &authenticationv1.UserInfo{Username: "system:serviceaccount:ci:deployer", Groups: []string{"system:serviceaccounts"}}, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	tokens, err := ReadTokens(strings.NewReader("# static tokens\nadmin-token,admin,1,\"ops,dev\"\n"))
+	if err != nil {
+		t.Fatalf("ReadTokens() error = %v", err)
+	}
+	review := &reviewer{}
+	authenticators := []Authenticator{
+		CertificateAuthenticator{},
+		tokens,
+		NewTokenReviewAuthenticator(review, nil, time.Minute),
+	}
+
+	var identity *api.Identity
+	handler := Authenticate(authenticators, "/healthz")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity = api.IdentityFrom(r.Context())
+	}))
+
+	tests := []struct {
+		name       string
+		path       string
+		header     string
+		tls        *tls.ConnectionState
+		wantStatus int
+		wantUser   string
+		wantMethod string
+	}{
+		{name: "no credentials", path: "/api/v1/secrets", wantStatus: http.StatusUnauthorized},
+		{name: "public path", path: "/healthz", wantStatus: http.StatusOK},
+		{name: "static token", path: "/api/v1/secrets", header: "Bearer admin-token", wantStatus: http.StatusOK, wantUser: "admin", wantMethod: api.AuthMethodToken},
+		{name: "service account token", path: "/api/v1/secrets", header: "bearer sa-token", wantStatus: http.StatusOK,
+			wantUser: "system:serviceaccount:ci:deployer", wantMethod: api.AuthMethodTokenReview},
+		{name: "rejected token", path: "/api/v1/secrets", header: "Bearer other", wantStatus: http.StatusUnauthorized},
+		{name: "basic auth", path: "/api/v1/secrets", header: "Basic YWRtaW46YWRtaW4=", wantStatus: http.StatusUnauthorized},
+		{name: "client certificate", path: "/api/v1/secrets", wantStatus: http.StatusOK, wantUser: "alice", wantMethod: api.AuthMethodCertificate,
+			tls: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "alice", Organization: []string{"ops"}}}}}}},
+		{name: "unverified client certificate", path: "/api/v1/secrets", wantStatus: http.StatusUnauthorized,
+			tls: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "mallory"}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity = nil
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			req.TLS = tt.tls
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate header")
+			}
+			if tt.wantUser == "" {
+				return
+			}
+			if identity == nil || identity.Username != tt.wantUser || identity.Method != tt.wantMethod {
+				t.Errorf("identity = %+v, want %s via %s", identity, tt.wantUser, tt.wantMethod)
+			}
+		})
+	}
+
+	// The static token never reaches the reviewer and reviews are cached
+	before := review.reviews
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets", nil)
+		req.Header.Set("Authorization", "Bearer sa-token")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if review.reviews != before {
+		t.Errorf("reviews of a cached token = %d, want none", review.reviews-before)
+	}
+}
+
+func TestReadTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"user only", "token1,alice\n", false},
+		{"missing user", "token1\n", true},
+		{"duplicate token", "token1,alice\ntoken1,bob\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadTokens(strings.NewReader(tt.content)); (err != nil) != tt.wantErr {
+				t.Errorf("ReadTokens() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
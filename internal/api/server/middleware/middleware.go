@@ -3,6 +3,8 @@ package middleware
 import (
 	"net/http"
 
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
 	"github.com/rs/zerolog"
 )
 
@@ -35,7 +37,7 @@ func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				api.WriteErrorResponse(w, apperrors.CodeInternal, "internal server error", "")
 			}
 		}()
 		next.ServeHTTP(w, r)
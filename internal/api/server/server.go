@@ -1,37 +1,61 @@
 package server
 
 import (
+	"crypto/tls"
 	"net/http"
 
-	"github.com/gorilla/mux"
+	"github.com/mpalu/k8s-secrets-manager/internal/api"
 	"github.com/mpalu/k8s-secrets-manager/internal/api/handlers"
+	"github.com/mpalu/k8s-secrets-manager/internal/api/router"
+	"github.com/mpalu/k8s-secrets-manager/internal/api/server/middleware"
 	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
 )
 
-type Server struct {
-	router *mux.Router
-	client *k8s.Client
+// publicPaths are served without authentication so that probes keep working
+var publicPaths = []string{"/healthz", "/readyz"}
+
+// Config configures the HTTP server
+type Config struct {
+	API api.APIConfig
+	// Authenticators identify callers, tried in order. Setting any turns on
+	// API.EnableAuth; with EnableAuth and none, every request but the
+	// probes is rejected.
+	Authenticators []middleware.Authenticator
+	// TLS serves HTTPS when set. Client certificates are only requested
+	// when it names ClientCAs.
+	TLS *tls.Config
 }
 
-func New(client *k8s.Client) *Server {
-	router := mux.NewRouter()
-	h := handlers.NewHandler(client)
-
-	// API v1
-	v1 := router.PathPrefix("/api/v1").Subrouter()
+type Server struct {
+	handler  http.Handler
+	clusters *k8s.Registry
+	tls      *tls.Config
+}
 
-	v1.HandleFunc("/secrets", h.CreateSecret).Methods(http.MethodPost)
-	v1.HandleFunc("/secrets", h.ListSecrets).Methods(http.MethodGet)
-	v1.HandleFunc("/secrets/{namespace}/{name}", h.GetSecret).Methods(http.MethodGet)
-	v1.HandleFunc("/secrets/{namespace}/{name}", h.UpdateSecret).Methods(http.MethodPut)
-	v1.HandleFunc("/secrets/{namespace}/{name}", h.DeleteSecret).Methods(http.MethodDelete)
+func New(clusters *k8s.Registry, config Config, opts ...handlers.Option) *Server {
+	middlewares := []middleware.Middleware{middleware.Recovery}
+	if config.API.EnableAuth || len(config.Authenticators) > 0 {
+		middlewares = append(middlewares, middleware.Authenticate(config.Authenticators, publicPaths...))
+	}
 
 	return &Server{
-		router: router,
-		client: client,
+		handler:  middleware.Chain(middlewares...)(router.NewRouter(clusters, opts...)),
+		clusters: clusters,
+		tls:      config.TLS,
 	}
 }
 
+// Handler returns the handler serving every request, middleware included
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
 func (s *Server) Run(addr string) error {
-	return http.ListenAndServe(addr, s.router)
+	if s.tls == nil {
+		return http.ListenAndServe(addr, s.handler)
+	}
+
+	srv := &http.Server{Addr: addr, Handler: s.handler, TLSConfig: s.tls}
+	// The certificate comes from TLSConfig
+	return srv.ListenAndServeTLS("", "")
 }
@@ -1,9 +1,60 @@
 package api
 
+import (
+	"time"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/diff"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+)
+
+// SecretListResponse is one page of GET /api/v1/secrets. Pass Continue back
+// as the continue query parameter to fetch the next page.
+type SecretListResponse struct {
+	Items              []SecretView `json:"items"`
+	Continue           string       `json:"continue,omitempty"`
+	RemainingItemCount *int64       `json:"remainingItemCount,omitempty"`
+}
+
+// SecretValueResponse is the body of GET /api/v1/secrets/{namespace}/{name}/keys/{key}
+type SecretValueResponse struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Encoding is base64 when Value had to be encoded because it is not UTF-8
+	Encoding string `json:"encoding"`
+}
+
+// RevisionView is a recorded revision of a secret. Secret is only set when a
+// single revision is requested.
+type RevisionView struct {
+	Revision        int64       `json:"revision"`
+	CreatedAt       time.Time   `json:"createdAt"`
+	ResourceVersion string      `json:"resourceVersion"`
+	Secret          *SecretView `json:"secret,omitempty"`
+}
+
+// GenerateResponse is the body of POST
+// /api/v1/secrets/{namespace}/{name}/generate
+type GenerateResponse struct {
+	// Keys are the keys that received generated values
+	Keys   []string   `json:"keys"`
+	Secret SecretView `json:"secret"`
+}
+
+// ErrorResponse is the body of every error answer. Code is the HTTP status
+// and Reason a stable error code such as NOT_FOUND or CONFLICT.
 type ErrorResponse struct {
 	Error   string `json:"error"`
 	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
 	Details string `json:"details,omitempty"`
+	// Violations lists every problem when a secret failed validation
+	Violations []*k8s.ValidationError `json:"violations,omitempty"`
+}
+
+// ValidationResponse is the body of POST /api/v1/validate
+type ValidationResponse struct {
+	Valid      bool                   `json:"valid"`
+	Violations []*k8s.ValidationError `json:"violations"`
 }
 
 type SuccessResponse struct {
@@ -14,7 +65,25 @@ type SuccessResponse struct {
 type APIConfig struct {
 	EnableMetrics bool
 	EnableTracing bool
-	EnableAuth    bool
-	CorsEnabled   bool
-	CorsOrigins   []string
+	// EnableAuth rejects requests whose caller is not identified by one of
+	// the authenticators of the server
+	EnableAuth  bool
+	CorsEnabled bool
+	CorsOrigins []string
+}
+
+// ClusterStatus reports the reachability of a registered cluster
+type ClusterStatus struct {
+	Name      string `json:"name"`
+	Default   bool   `json:"default"`
+	Reachable bool   `json:"reachable"`
+	Version   string `json:"version,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DiffResponse is the body of POST /api/v1/diff
+type DiffResponse struct {
+	// Drift is true when any secret differs from its definition
+	Drift   bool          `json:"drift"`
+	Secrets []diff.Result `json:"secrets"`
 }
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/diff"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SecretView is the API representation of a secret. Values are only
+// included when they were explicitly revealed.
+type SecretView struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace"`
+	Type              string            `json:"type"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+	Immutable         bool              `json:"immutable,omitempty"`
+	ResourceVersion   string            `json:"resourceVersion"`
+	CreationTimestamp metav1.Time       `json:"creationTimestamp"`
+	Keys              []KeyInfo         `json:"keys"`
+	Data              map[string]string `json:"data,omitempty"`
+	// BinaryData holds the revealed values that are not valid UTF-8
+	BinaryData map[string][]byte `json:"binaryData,omitempty"`
+}
+
+// Encodings of a value: UTF-8 text is returned as is, anything else base64
+// encoded
+const (
+	EncodingUTF8   = "utf-8"
+	EncodingBase64 = "base64"
+)
+
+// KeyInfo describes a key of a secret without exposing its value
+type KeyInfo struct {
+	Name     string `json:"name"`
+	Size     int    `json:"size"`
+	SHA256   string `json:"sha256"`
+	Encoding string `json:"encoding"`
+}
+
+// EncodingOf returns the encoding value is transported with
+func EncodingOf(value []byte) string {
+	if utf8.Valid(value) {
+		return EncodingUTF8
+	}
+	return EncodingBase64
+}
+
+// NewSecretView builds the view of secret, with its values when reveal is
+// set. Annotations that copy the values are masked otherwise.
+func NewSecretView(secret *corev1.Secret, reveal bool) SecretView {
+	view := SecretView{
+		Name:              secret.Name,
+		Namespace:         secret.Namespace,
+		Type:              string(secret.Type),
+		Labels:            secret.Labels,
+		Annotations:       diff.MaskAnnotations(secret.Annotations),
+		Immutable:         secret.Immutable != nil && *secret.Immutable,
+		ResourceVersion:   secret.ResourceVersion,
+		CreationTimestamp: secret.CreationTimestamp,
+		Keys:              make([]KeyInfo, 0, len(secret.Data)),
+	}
+
+	for key, value := range secret.Data {
+		sum := sha256.Sum256(value)
+		view.Keys = append(view.Keys, KeyInfo{
+			Name:     key,
+			Size:     len(value),
+			SHA256:   hex.EncodeToString(sum[:]),
+			Encoding: EncodingOf(value),
+		})
+	}
+	sort.Slice(view.Keys, func(i, j int) bool { return view.Keys[i].Name < view.Keys[j].Name })
+
+	if reveal {
+		view.Annotations = secret.Annotations
+		view.Data = make(map[string]string, len(secret.Data))
+		for key, value := range secret.Data {
+			if EncodingOf(value) == EncodingBase64 {
+				if view.BinaryData == nil {
+					view.BinaryData = make(map[string][]byte)
+				}
+				view.BinaryData[key] = value
+				continue
+			}
+			view.Data[key] = string(value)
+		}
+	}
+	return view
+}
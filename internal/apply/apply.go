@@ -0,0 +1,179 @@
+// Package apply reconciles secrets with definitions kept in a directory,
+// such as a git checkout.
+package apply
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/diff"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/validator"
+)
+
+const (
+	// ManagedByLabel marks the secrets apply owns; no other secret is ever
+	// updated or pruned
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "k8s-secrets-manager"
+	// SourceLabel names the source a secret was applied from, so that
+	// several sources can share a cluster without pruning each other
+	SourceLabel = "secrets-manager.io/apply-source"
+	// DefaultSource is the source name used when none is given
+	DefaultSource = "default"
+	// FieldManager owns the fields written with server-side apply
+	FieldManager = "k8s-secrets-manager"
+)
+
+// Action is what apply does with a secret
+type Action string
+
+const (
+	ActionCreate    Action = "create"
+	ActionUpdate    Action = "update"
+	ActionUnchanged Action = "unchanged"
+	ActionPrune     Action = "prune"
+	// ActionSkip leaves an existing secret that apply does not own alone
+	ActionSkip Action = "skip"
+)
+
+// Step is the plan, and after Apply the result, for one secret
+type Step struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Action    Action `json:"action"`
+	// Reason tells why a secret is skipped
+	Reason string `json:"reason,omitempty"`
+	// Changes of an update, with values masked
+	Changes []diff.Change `json:"changes,omitempty"`
+	// Error is set when executing the step failed
+	Error string `json:"error,omitempty"`
+
+	data *k8s.SecretData
+}
+
+// Options describe an apply
+type Options struct {
+	// Source names the set of definitions, DefaultSource when empty
+	Source string
+	// Prune deletes the secrets of Source that are no longer defined
+	Prune bool
+	// DryRun only plans
+	DryRun bool
+}
+
+// Plan validates the desired secrets and decides what to do with each of
+// them and, when pruning, with the managed secrets no longer defined
+func Plan(ctx context.Context, manager k8s.SecretManager, desired []*k8s.SecretData, opts Options) ([]Step, error) {
+	source := opts.Source
+	if source == "" {
+		source = DefaultSource
+	}
+
+	defined := make(map[string]bool, len(desired))
+	steps := make([]Step, 0, len(desired))
+	for _, data := range desired {
+		ref := data.Namespace + "/" + data.Name
+		if defined[ref] {
+			return nil, apperrors.New(apperrors.CodeInvalid, fmt.Sprintf("secret %s is defined more than once", ref))
+		}
+		defined[ref] = true
+		if err := validator.ValidateSecretData(data); err != nil {
+			return nil, fmt.Errorf("secret %s: %w", ref, err)
+		}
+
+		owned := *data
+		owned.Labels = make(map[string]string, len(data.Labels)+2)
+		for key, value := range data.Labels {
+			owned.Labels[key] = value
+		}
+		owned.Labels[ManagedByLabel] = ManagedByValue
+		owned.Labels[SourceLabel] = source
+
+		step := Step{Namespace: data.Namespace, Name: data.Name, data: &owned}
+		live, err := manager.GetSecret(ctx, data.Namespace, data.Name)
+		switch {
+		case apperrors.CodeOf(err) == apperrors.CodeNotFound:
+			step.Action = ActionCreate
+		case err != nil:
+			return nil, err
+		case live.Labels[ManagedByLabel] != ManagedByValue:
+			step.Action = ActionSkip
+			step.Reason = "secret exists and is not managed by " + ManagedByValue
+		case live.Labels[SourceLabel] != source:
+			step.Action = ActionSkip
+			step.Reason = "secret is managed by source " + live.Labels[SourceLabel]
+		default:
+			result := diff.Compare(&owned, live, diff.Options{})
+			step.Action = ActionUnchanged
+			if result.Status != diff.StatusInSync {
+				step.Action = ActionUpdate
+				step.Changes = result.Changes
+			}
+		}
+		steps = append(steps, step)
+	}
+
+	if !opts.Prune {
+		return steps, nil
+	}
+	managed, err := manager.ListSecrets(ctx, "", k8s.ListOptions{
+		LabelSelector: ManagedByLabel + "=" + ManagedByValue + "," + SourceLabel + "=" + source,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var prune []Step
+	for _, secret := range managed.Items {
+		if !defined[secret.Namespace+"/"+secret.Name] {
+			prune = append(prune, Step{Namespace: secret.Namespace, Name: secret.Name, Action: ActionPrune})
+		}
+	}
+	sort.Slice(prune, func(i, j int) bool {
+		if prune[i].Namespace != prune[j].Namespace {
+			return prune[i].Namespace < prune[j].Namespace
+		}
+		return prune[i].Name < prune[j].Name
+	})
+	return append(steps, prune...), nil
+}
+
+// Apply plans and executes the plan. Secrets are created with a plain
+// create, which fails rather than taking over a secret created since the
+// plan, and updated with server-side apply as FieldManager when manager
+// supports it. A failed step does not
+// stop the others; its error is set on the step and joined into the
+// returned error.
+func Apply(ctx context.Context, manager k8s.SecretManager, desired []*k8s.SecretData, opts Options) ([]Step, error) {
+	steps, err := Plan(ctx, manager, desired, opts)
+	if err != nil || opts.DryRun {
+		return steps, err
+	}
+
+	applier, _ := manager.(k8s.Applier)
+	var errs []error
+	for i := range steps {
+		step := &steps[i]
+		var err error
+		switch {
+		case step.Action == ActionPrune:
+			err = manager.DeleteSecret(ctx, step.Namespace, step.Name)
+		case step.Action == ActionCreate:
+			err = manager.CreateSecret(ctx, step.data)
+		case step.Action != ActionUpdate:
+			continue
+		case applier != nil:
+			err = applier.ApplySecret(ctx, step.data, FieldManager)
+		default:
+			err = manager.UpdateSecret(ctx, step.data)
+		}
+		if err != nil {
+			step.Error = err.Error()
+			errs = append(errs, fmt.Errorf("%s/%s: %w", step.Namespace, step.Name, err))
+		}
+	}
+	return steps, errors.Join(errs...)
+}
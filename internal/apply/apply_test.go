@@ -0,0 +1,226 @@
+package apply
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newClientset() *fake.Clientset {
+	managed := func(source string) map[string]string {
+		return map[string]string{ManagedByLabel: ManagedByValue, SourceLabel: source}
+	}
+	clientset := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", Labels: managed(DefaultSource)},
+			Data:       map[string][]byte{"USER": []byte("admin")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "unchanged", Namespace: "default", Labels: managed(DefaultSource)},
+			Type:       corev1.SecretTypeOpaque,
+			Data:       map[string][]byte{"KEY": []byte("value")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "removed", Namespace: "default", Labels: managed(DefaultSource)},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-b", Namespace: "default", Labels: managed("team-b")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "default"},
+			Data:       map[string][]byte{"KEY": []byte("old")},
+		},
+	)
+
+	// The fake clientset cannot create objects through server-side apply
+	clientset.PrependReactor("patch", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		if _, err := clientset.Tracker().Get(action.GetResource(), action.GetNamespace(), patch.GetName()); err == nil {
+			return false, nil, nil
+		}
+		secret := &corev1.Secret{}
+		if err := runtime.DecodeInto(scheme.Codecs.UniversalDecoder(), patch.GetPatch(), secret); err != nil {
+			return true, nil, err
+		}
+		return true, secret, clientset.Tracker().Create(action.GetResource(), secret, action.GetNamespace())
+	})
+	return clientset
+}
+
+func desired() []*k8s.SecretData {
+	return []*k8s.SecretData{
+		{Name: "db", Namespace: "default", Type: "Opaque", Data: map[string]string{"USER": "root"}},
+		{Name: "unchanged", Namespace: "default", Type: "Opaque", Data: map[string]string{"KEY": "value"}},
+		{Name: "api", Namespace: "default", Type: "Opaque", Data: map[string]string{"TOKEN": "t0k3n"}},
+		{Name: "legacy", Namespace: "default", Type: "Opaque", Data: map[string]string{"KEY": "new"}},
+	}
+}
+
+// secretManager hides the Applier implementation of a manager
+type secretManager struct {
+	k8s.SecretManager
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        Options
+		withApplier bool
+		wantActions map[string]Action
+		wantWritten bool
+	}{
+		{
+			name:        "dry run",
+			opts:        Options{Prune: true, DryRun: true},
+			withApplier: true,
+			wantActions: map[string]Action{
+				"db": ActionUpdate, "unchanged": ActionUnchanged, "api": ActionCreate,
+				"legacy": ActionSkip, "removed": ActionPrune,
+			},
+		},
+		{
+			name:        "server-side apply",
+			opts:        Options{Prune: true},
+			withApplier: true,
+			wantActions: map[string]Action{
+				"db": ActionUpdate, "unchanged": ActionUnchanged, "api": ActionCreate,
+				"legacy": ActionSkip, "removed": ActionPrune,
+			},
+			wantWritten: true,
+		},
+		{
+			name: "create and update without pruning",
+			opts: Options{},
+			wantActions: map[string]Action{
+				"db": ActionUpdate, "unchanged": ActionUnchanged, "api": ActionCreate, "legacy": ActionSkip,
+			},
+			wantWritten: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := newClientset()
+			var manager k8s.SecretManager = k8s.NewClientForClientset(clientset)
+			if !tt.withApplier {
+				manager = secretManager{manager}
+			}
+
+			steps, err := Apply(context.Background(), manager, desired(), tt.opts)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if len(steps) != len(tt.wantActions) {
+				t.Fatalf("Apply() returned %d steps, want %d: %+v", len(steps), len(tt.wantActions), steps)
+			}
+			for _, step := range steps {
+				if step.Action != tt.wantActions[step.Name] {
+					t.Errorf("%s: action = %s, want %s", step.Name, step.Action, tt.wantActions[step.Name])
+				}
+			}
+
+			ctx := context.Background()
+			api, err := clientset.CoreV1().Secrets("default").Get(ctx, "api", metav1.GetOptions{})
+			if tt.wantWritten != (err == nil) {
+				t.Fatalf("api written = %v, want %v", err == nil, tt.wantWritten)
+			}
+			if tt.wantWritten && api.Labels[ManagedByLabel] != ManagedByValue {
+				t.Errorf("api labels = %v, want the managed-by label", api.Labels)
+			}
+			db, _ := clientset.CoreV1().Secrets("default").Get(ctx, "db", metav1.GetOptions{})
+			if got := string(db.Data["USER"]); (got == "root") != tt.wantWritten {
+				t.Errorf("db USER = %q", got)
+			}
+			legacy, _ := clientset.CoreV1().Secrets("default").Get(ctx, "legacy", metav1.GetOptions{})
+			if string(legacy.Data["KEY"]) != "old" {
+				t.Errorf("unmanaged secret was changed")
+			}
+			_, err = clientset.CoreV1().Secrets("default").Get(ctx, "removed", metav1.GetOptions{})
+			if pruned := err != nil; pruned != (tt.opts.Prune && !tt.opts.DryRun) {
+				t.Errorf("removed pruned = %v", pruned)
+			}
+			if _, err := clientset.CoreV1().Secrets("default").Get(ctx, "team-b", metav1.GetOptions{}); err != nil {
+				t.Errorf("secret of another source was pruned")
+			}
+		})
+	}
+}
+
+func TestApply_CreatedSincePlan(t *testing.T) {
+	clientset := newClientset()
+	desired := []*k8s.SecretData{{Name: "api", Namespace: "default", Data: map[string]string{"TOKEN": "t0k3n"}}}
+
+	// Another writer creates the secret once the plan has read it
+	reads := 0
+	clientset.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if reads++; reads == 2 {
+			clientset.Tracker().Add(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+				Data:       map[string][]byte{"TOKEN": []byte("theirs")},
+			})
+		}
+		return false, nil, nil
+	})
+
+	steps, err := Apply(context.Background(), k8s.NewClientForClientset(clientset), desired, Options{})
+	if err == nil || steps[0].Action != ActionCreate || steps[0].Error == "" {
+		t.Errorf("Apply() = %+v, %v, want the create to fail", steps, err)
+	}
+	api, _ := clientset.CoreV1().Secrets("default").Get(context.Background(), "api", metav1.GetOptions{})
+	if string(api.Data["TOKEN"]) != "theirs" || api.Labels[ManagedByLabel] != "" {
+		t.Errorf("secret created since the plan was taken over: %+v", api)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"db.yaml":         "apiVersion: v1\nkind: Secret\nmetadata:\n  name: db\n  namespace: prod\nstringData:\n  USER: admin\n",
+		"apps/api.env":    "TOKEN=t0k3n\n",
+		"apps/README.md":  "not a definition",
+		".git/config.yml": "apiVersion: v1\nkind: Secret\nmetadata:\n  name: ignored\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	secrets, err := LoadDir(dir, secretio.ImportOptions{Namespace: "default"})
+	if err != nil {
+		t.Fatalf("LoadDir() error = %v", err)
+	}
+	got := make(map[string]*k8s.SecretData)
+	for _, secret := range secrets {
+		got[secret.Namespace+"/"+secret.Name] = secret
+	}
+	if len(got) != 2 || got["prod/db"] == nil || got["default/api"] == nil {
+		t.Fatalf("LoadDir() = %v, want prod/db and default/api", got)
+	}
+	if got["default/api"].Data["TOKEN"] != "t0k3n" {
+		t.Errorf("api data = %v", got["default/api"].Data)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.yaml"), []byte("kind: ConfigMap\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDir(dir, secretio.ImportOptions{Namespace: "default"}); err == nil {
+		t.Error("LoadDir() accepted a file that is not a secret")
+	}
+}
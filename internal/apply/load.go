@@ -0,0 +1,62 @@
+package apply
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
+)
+
+// LoadDir reads the secret definitions below dir: manifests from .yaml,
+// .yml and .json files and a secret named after the file from each .env
+// file. Hidden files and directories, such as .git, are ignored. Encrypted
+// files are decrypted with opts.Identities and secrets without a namespace
+// get opts.Namespace.
+func LoadDir(dir string, opts secretio.ImportOptions) ([]*k8s.SecretData, error) {
+	var secrets []*k8s.SecretData
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		opts := opts
+		switch ext := filepath.Ext(path); ext {
+		case ".yaml", ".yml", ".json":
+			opts.Format = secretio.FormatManifest
+		case ".env":
+			opts.Format = secretio.FormatEnv
+			opts.Name = strings.TrimSuffix(entry.Name(), ext)
+		default:
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		read, err := secretio.Read(f, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		secrets = append(secrets, read...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading definitions: %w", err)
+	}
+	return secrets, nil
+}
@@ -0,0 +1,72 @@
+package apply
+
+import (
+	"context"
+	"time"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
+	"github.com/rs/zerolog"
+)
+
+// Reconciler applies the definitions of a directory on an interval
+type Reconciler struct {
+	manager k8s.SecretManager
+	dir     string
+	load    secretio.ImportOptions
+	opts    Options
+	logger  *zerolog.Logger
+}
+
+// NewReconciler returns a reconciler applying the definitions below dir,
+// read with load as by LoadDir. logger may be nil.
+func NewReconciler(manager k8s.SecretManager, dir string, load secretio.ImportOptions, opts Options, logger *zerolog.Logger) *Reconciler {
+	if logger == nil {
+		nop := zerolog.Nop()
+		logger = &nop
+	}
+	return &Reconciler{manager: manager, dir: dir, load: load, opts: opts, logger: logger}
+}
+
+// Run reconciles every interval until ctx is done. The directory is read
+// again each time, so changes pulled into it are picked up.
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		steps, err := r.Reconcile(ctx)
+		for _, step := range steps {
+			if step.Action == ActionUnchanged {
+				continue
+			}
+			event := r.logger.Info()
+			if step.Error != "" {
+				event = r.logger.Error().Str("error", step.Error)
+			}
+			event.Str("namespace", step.Namespace).
+				Str("name", step.Name).
+				Str("action", string(step.Action)).
+				Str("reason", step.Reason).
+				Msg("secret applied")
+		}
+		if err != nil && steps == nil {
+			r.logger.Error().Err(err).Str("dir", r.dir).Msg("applying secret definitions failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile reads the directory and applies it once
+func (r *Reconciler) Reconcile(ctx context.Context) ([]Step, error) {
+	desired, err := LoadDir(r.dir, r.load)
+	if err != nil {
+		return nil, err
+	}
+	return Apply(ctx, r.manager, desired, r.opts)
+}
@@ -0,0 +1,88 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/crypto"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// fileAAD binds the sealed content to its use as a backend file
+var fileAAD = []byte("k8s-secrets-manager/backend-file")
+
+// OpenFile returns a Memory that keeps its content in a local file, sealed
+// with the AES-256 key. The file is created on the first write and replaced
+// atomically on every write. It is read once, so only one process may write
+// to it at a time.
+func OpenFile(path string, key []byte) (*Memory, error) {
+	cipher, err := crypto.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	m := NewMemory()
+	sealed, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	default:
+		plaintext, err := cipher.Decrypt(sealed, fileAAD)
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting %s: %w", path, err)
+		}
+		if err := json.Unmarshal(plaintext, m.state); err != nil {
+			return nil, fmt.Errorf("error decoding %s: %w", path, err)
+		}
+		if m.state.Secrets == nil {
+			m.state.Secrets = make(map[string]*corev1.Secret)
+		}
+		if m.state.Revisions == nil {
+			m.state.Revisions = make(map[string][]revision)
+		}
+	}
+
+	m.persist = func(s *state) error {
+		return saveFile(path, cipher, s)
+	}
+	return m, nil
+}
+
+func saveFile(path string, cipher *crypto.Cipher, s *state) error {
+	plaintext, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("error encoding secrets: %w", err)
+	}
+	sealed, err := cipher.Encrypt(plaintext, fileAAD)
+	if err != nil {
+		return err
+	}
+
+	// CreateTemp creates the file with mode 0600
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(sealed); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
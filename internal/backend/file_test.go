@@ -0,0 +1,74 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/crypto"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+)
+
+func TestOpenFile(t *testing.T) {
+	ctx := context.TODO()
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	key, _ := crypto.GenerateKey()
+
+	store, err := OpenFile(path, key)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	if err := store.CreateSecret(ctx, &k8s.SecretData{Name: "db", Namespace: "default", Data: map[string]string{"password": "s3cret"}}); err != nil {
+		t.Fatalf("CreateSecret() error = %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("backend file not written: %v", err)
+	}
+	if bytes.Contains(content, []byte("s3cret")) {
+		t.Error("backend file holds the secret in plain text")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("backend file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	reopened, err := OpenFile(path, key)
+	if err != nil {
+		t.Fatalf("OpenFile() of an existing file error = %v", err)
+	}
+	if value, err := reopened.GetSecretString(ctx, "default", "db", "password"); err != nil || value != "s3cret" {
+		t.Errorf("GetSecretString() after reopening = %q, %v", value, err)
+	}
+	if err := reopened.CreateSecret(ctx, &k8s.SecretData{Name: "api", Namespace: "default", Data: map[string]string{"token": "t"}}); err != nil {
+		t.Fatalf("CreateSecret() after reopening error = %v", err)
+	}
+	secret, _ := reopened.GetSecret(ctx, "default", "api")
+	if secret.ResourceVersion != "2" {
+		t.Errorf("resourceVersion after reopening = %s, want 2", secret.ResourceVersion)
+	}
+
+	otherKey, _ := crypto.GenerateKey()
+	if _, err := OpenFile(path, otherKey); err == nil {
+		t.Error("OpenFile() with another key succeeded")
+	}
+}
+
+func TestOpenFile_FailedWrite(t *testing.T) {
+	ctx := context.TODO()
+	dir := t.TempDir()
+	key, _ := crypto.GenerateKey()
+
+	store, err := OpenFile(filepath.Join(dir, "missing", "secrets.enc"), key)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	if err := store.CreateSecret(ctx, &k8s.SecretData{Name: "db", Namespace: "default", Data: map[string]string{"password": "v1"}}); err == nil {
+		t.Fatal("CreateSecret() into a missing directory succeeded")
+	}
+	if _, err := store.GetSecret(ctx, "default", "db"); err == nil {
+		t.Error("secret of a failed write is visible")
+	}
+}
@@ -0,0 +1,503 @@
+// Package backend provides SecretManager implementations that work without a
+// Kubernetes cluster, for local development and tests.
+package backend
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var errHistoryDisabled = apperrors.New(apperrors.CodeNotImplemented, "revision history is not enabled")
+
+// Memory keeps secrets in process memory. It behaves like the API server
+// where handlers can tell the difference: resource versions, immutability,
+// selectors and paging. Revisions are recorded once history is enabled.
+type Memory struct {
+	mu    sync.RWMutex
+	state *state
+
+	history bool
+	limit   int
+
+	// persist, when set, saves the state after every write; a write whose
+	// state cannot be saved is discarded
+	persist func(*state) error
+}
+
+// state is everything a Memory holds, in the form the file backend stores
+type state struct {
+	// Version is the last resourceVersion handed out
+	Version   int64                     `json:"version"`
+	Secrets   map[string]*corev1.Secret `json:"secrets"`
+	Revisions map[string][]revision     `json:"revisions,omitempty"`
+}
+
+type revision struct {
+	Revision  int64          `json:"revision"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Secret    *corev1.Secret `json:"secret"`
+}
+
+func NewMemory() *Memory {
+	return &Memory{state: newState()}
+}
+
+func newState() *state {
+	return &state{
+		Secrets:   make(map[string]*corev1.Secret),
+		Revisions: make(map[string][]revision),
+	}
+}
+
+// EnableHistory makes every update record the previous version of a secret.
+// limit revisions are kept per secret unless its k8s.HistoryLimitAnnotation
+// says otherwise. It must be called before the store is shared between
+// goroutines.
+func (m *Memory) EnableHistory(limit int) error {
+	if limit < 0 {
+		return fmt.Errorf("history limit must not be negative")
+	}
+	m.history, m.limit = true, limit
+	return nil
+}
+
+func (m *Memory) CreateSecret(ctx context.Context, data *k8s.SecretData) error {
+	if err := validateKey(data.Namespace, data.Name); err != nil {
+		return err
+	}
+
+	var resourceVersion string
+	err := m.write(func(s *state) error {
+		if _, exists := s.Secrets[secretKey(data.Namespace, data.Name)]; exists {
+			return apperrors.New(apperrors.CodeAlreadyExists,
+				fmt.Sprintf("secret %s already exists in namespace %s", data.Name, data.Namespace))
+		}
+
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              data.Name,
+				Namespace:         data.Namespace,
+				Labels:            data.Labels,
+				Annotations:       data.Annotations,
+				UID:               types.UID(uuid.NewString()),
+				CreationTimestamp: metav1.Now(),
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: data.Values(),
+		}
+		if data.Type != "" {
+			secret.Type = corev1.SecretType(data.Type)
+		}
+		if data.Immutable {
+			immutable := true
+			secret.Immutable = &immutable
+		}
+
+		resourceVersion = s.store(secret).ResourceVersion
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	data.ResourceVersion = resourceVersion
+	return nil
+}
+
+// UpdateSecret replaces the data of an existing secret, honouring
+// data.ResourceVersion like k8s.Client does
+func (m *Memory) UpdateSecret(ctx context.Context, data *k8s.SecretData) error {
+	if err := validateKey(data.Namespace, data.Name); err != nil {
+		return err
+	}
+
+	var resourceVersion string
+	err := m.write(func(s *state) error {
+		existing, err := s.get(data.Namespace, data.Name)
+		if err != nil {
+			return fmt.Errorf("error getting existing secret: %w", err)
+		}
+		if err := k8s.CheckResourceVersion(existing, data.ResourceVersion); err != nil {
+			return err
+		}
+
+		previous := existing.DeepCopy()
+		if err := k8s.ApplySecretData(existing, data); err != nil {
+			return err
+		}
+		resourceVersion = m.update(s, previous, existing).ResourceVersion
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	data.ResourceVersion = resourceVersion
+	return nil
+}
+
+// DeleteSecret removes a secret together with its revisions
+func (m *Memory) DeleteSecret(ctx context.Context, namespace, name string, opts ...k8s.DeleteOptions) error {
+	if err := validateKey(namespace, name); err != nil {
+		return err
+	}
+
+	return m.write(func(s *state) error {
+		existing, err := s.get(namespace, name)
+		if err != nil {
+			return err
+		}
+		for _, opt := range opts {
+			if err := k8s.CheckResourceVersion(existing, opt.ResourceVersion); err != nil {
+				return err
+			}
+		}
+
+		delete(s.Secrets, secretKey(namespace, name))
+		delete(s.Revisions, secretKey(namespace, name))
+		return nil
+	})
+}
+
+func (m *Memory) PatchSecret(ctx context.Context, namespace, name string, patch *k8s.SecretPatch) (*corev1.Secret, error) {
+	if err := validateKey(namespace, name); err != nil {
+		return nil, err
+	}
+
+	var updated *corev1.Secret
+	err := m.write(func(s *state) error {
+		existing, err := s.get(namespace, name)
+		if err != nil {
+			return err
+		}
+		if err := k8s.CheckResourceVersion(existing, patch.ResourceVersion); err != nil {
+			return err
+		}
+
+		previous := existing.DeepCopy()
+		if err := patch.Apply(existing); err != nil {
+			return err
+		}
+		updated = m.update(s, previous, existing).DeepCopy()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (m *Memory) GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	if err := validateKey(namespace, name); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.get(namespace, name)
+}
+
+func (m *Memory) GetSecretString(ctx context.Context, namespace, name, key string) (string, error) {
+	secret, err := m.GetSecret(ctx, namespace, name)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", &k8s.KeyNotFoundError{Secret: name, Key: key}
+	}
+	return string(value), nil
+}
+
+// ListSecrets returns secrets ordered by namespace and name. The continue
+// token of a page is the position of its last secret.
+func (m *Memory) ListSecrets(ctx context.Context, namespace string, opts k8s.ListOptions) (*k8s.SecretList, error) {
+	labelSelector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, &k8s.ValidationError{Field: "labelSelector", Message: err.Error()}
+	}
+	fieldSelector, err := fields.ParseSelector(opts.FieldSelector)
+	if err != nil {
+		return nil, &k8s.ValidationError{Field: "fieldSelector", Message: err.Error()}
+	}
+	var after string
+	if opts.Continue != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(opts.Continue)
+		if err != nil {
+			return nil, &k8s.ValidationError{Field: "continue", Message: "invalid continue token"}
+		}
+		after = string(decoded)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]string, 0, len(m.state.Secrets))
+	for key, secret := range m.state.Secrets {
+		if (namespace == "" || secret.Namespace == namespace) && key > after &&
+			labelSelector.Matches(labels.Set(secret.Labels)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	items := make([]corev1.Secret, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, *m.state.Secrets[key].DeepCopy())
+	}
+	items = k8s.FilterByFields(items, fieldSelector)
+
+	list := &k8s.SecretList{Items: items}
+	if opts.Limit > 0 && int64(len(items)) > opts.Limit {
+		remaining := int64(len(items)) - opts.Limit
+		list.Items = items[:opts.Limit]
+		last := list.Items[len(list.Items)-1]
+		list.Continue = base64.RawURLEncoding.EncodeToString([]byte(secretKey(last.Namespace, last.Name)))
+		list.RemainingItemCount = &remaining
+	}
+	return list, nil
+}
+
+// ListNamespaces returns the namespaces holding secrets. Like on a cluster,
+// each carries the kubernetes.io/metadata.name label selectors can match.
+func (m *Memory) ListNamespaces(ctx context.Context, selector string) ([]string, error) {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, &k8s.ValidationError{Field: "labelSelector", Message: err.Error()}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, secret := range m.state.Secrets {
+		if seen[secret.Namespace] || !parsed.Matches(labels.Set{corev1.LabelMetadataName: secret.Namespace}) {
+			continue
+		}
+		seen[secret.Namespace] = true
+		names = append(names, secret.Namespace)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ListRevisions returns the recorded revisions of a secret, oldest first
+func (m *Memory) ListRevisions(ctx context.Context, namespace, name string) ([]k8s.Revision, error) {
+	if !m.history {
+		return nil, errHistoryDisabled
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored := m.state.Revisions[secretKey(namespace, name)]
+	revisions := make([]k8s.Revision, 0, len(stored))
+	for _, rev := range stored {
+		revisions = append(revisions, rev.summary())
+	}
+	return revisions, nil
+}
+
+func (m *Memory) GetRevision(ctx context.Context, namespace, name string, revision int64) (*k8s.Revision, error) {
+	if !m.history {
+		return nil, errHistoryDisabled
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rev, err := m.state.revision(namespace, name, revision)
+	if err != nil {
+		return nil, err
+	}
+	summary := rev.summary()
+	summary.Secret = rev.Secret.DeepCopy()
+	return &summary, nil
+}
+
+// Rollback restores the type, data, labels and annotations of a secret from
+// a revision, recording the replaced version as a new revision
+func (m *Memory) Rollback(ctx context.Context, namespace, name string, revision int64) (*corev1.Secret, error) {
+	if !m.history {
+		return nil, errHistoryDisabled
+	}
+
+	var updated *corev1.Secret
+	err := m.write(func(s *state) error {
+		rev, err := s.revision(namespace, name, revision)
+		if err != nil {
+			return err
+		}
+		existing, err := s.get(namespace, name)
+		if err != nil {
+			return err
+		}
+
+		previous := existing.DeepCopy()
+		if err := k8s.ApplySecretData(existing, k8s.NewSecretData(rev.Secret)); err != nil {
+			return err
+		}
+		existing.Labels = rev.Secret.Labels
+		existing.Annotations = rev.Secret.Annotations
+		updated = m.update(s, previous, existing).DeepCopy()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// write runs fn under the write lock. With persistence fn works on a copy,
+// which only replaces the state once it has been saved.
+func (m *Memory) write(fn func(*state) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.persist == nil {
+		return fn(m.state)
+	}
+
+	next := m.state.deepCopy()
+	if err := fn(next); err != nil {
+		return err
+	}
+	if err := m.persist(next); err != nil {
+		return err
+	}
+	m.state = next
+	return nil
+}
+
+// update stores updated, first recording previous as a revision when history
+// is enabled
+func (m *Memory) update(s *state, previous, updated *corev1.Secret) *corev1.Secret {
+	if m.history && m.limitFor(previous) > 0 {
+		key := secretKey(previous.Namespace, previous.Name)
+		revisions := s.Revisions[key]
+
+		var next int64 = 1
+		if len(revisions) > 0 {
+			next = revisions[len(revisions)-1].Revision + 1
+		}
+		revisions = append(revisions, revision{
+			Revision:  next,
+			CreatedAt: time.Now().UTC(),
+			Secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            previous.Name,
+					Namespace:       previous.Namespace,
+					Labels:          previous.Labels,
+					Annotations:     previous.Annotations,
+					ResourceVersion: previous.ResourceVersion,
+				},
+				Type: previous.Type,
+				Data: previous.Data,
+			},
+		})
+		if limit := m.limitFor(updated); len(revisions) > limit {
+			revisions = revisions[len(revisions)-limit:]
+		}
+		s.Revisions[key] = revisions
+	}
+
+	return s.store(updated)
+}
+
+func (m *Memory) limitFor(secret *corev1.Secret) int {
+	if value, ok := secret.Annotations[k8s.HistoryLimitAnnotation]; ok {
+		if limit, err := strconv.Atoi(value); err == nil && limit >= 0 {
+			return limit
+		}
+	}
+	return m.limit
+}
+
+// get returns a copy of a stored secret
+func (s *state) get(namespace, name string) (*corev1.Secret, error) {
+	secret, ok := s.Secrets[secretKey(namespace, name)]
+	if !ok {
+		return nil, &k8s.NotFoundError{
+			Resource:  "secret",
+			Name:      name,
+			Namespace: namespace,
+			Err:       apierrors.NewNotFound(corev1.Resource("secrets"), name),
+		}
+	}
+	return secret.DeepCopy(), nil
+}
+
+// store saves a copy of secret under the next resourceVersion and returns
+// the stored secret
+func (s *state) store(secret *corev1.Secret) *corev1.Secret {
+	s.Version++
+	stored := secret.DeepCopy()
+	stored.ResourceVersion = strconv.FormatInt(s.Version, 10)
+	s.Secrets[secretKey(stored.Namespace, stored.Name)] = stored
+	return stored
+}
+
+func (s *state) revision(namespace, name string, number int64) (*revision, error) {
+	for _, rev := range s.Revisions[secretKey(namespace, name)] {
+		if rev.Revision == number {
+			return &rev, nil
+		}
+	}
+	return nil, &k8s.NotFoundError{Resource: "revision", Name: fmt.Sprintf("%d of secret %s", number, name), Namespace: namespace}
+}
+
+// deepCopy copies the secrets map and revision lists. Stored secrets and
+// revisions are never modified in place, so they are shared.
+func (s *state) deepCopy() *state {
+	c := &state{
+		Version:   s.Version,
+		Secrets:   make(map[string]*corev1.Secret, len(s.Secrets)),
+		Revisions: make(map[string][]revision, len(s.Revisions)),
+	}
+	for key, secret := range s.Secrets {
+		c.Secrets[key] = secret
+	}
+	for key, revisions := range s.Revisions {
+		c.Revisions[key] = append([]revision(nil), revisions...)
+	}
+	return c
+}
+
+func (r revision) summary() k8s.Revision {
+	return k8s.Revision{
+		Revision:        r.Revision,
+		CreatedAt:       r.CreatedAt,
+		ResourceVersion: r.Secret.ResourceVersion,
+	}
+}
+
+func secretKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func validateKey(namespace, name string) error {
+	if namespace == "" {
+		return &k8s.ValidationError{Field: "namespace", Message: "namespace is required"}
+	}
+	if name == "" {
+		return &k8s.ValidationError{Field: "name", Message: "name is required"}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package backend
+
+import (
+	"context"
+	"testing"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+)
+
+func TestMemory_Secrets(t *testing.T) {
+	ctx := context.TODO()
+	m := NewMemory()
+
+	db := &k8s.SecretData{Name: "db", Namespace: "default", Data: map[string]string{"password": "v1"}, Labels: map[string]string{"app": "db"}}
+	if err := m.CreateSecret(ctx, db); err != nil {
+		t.Fatalf("CreateSecret() error = %v", err)
+	}
+	m.CreateSecret(ctx, &k8s.SecretData{Name: "api", Namespace: "default", Data: map[string]string{"token": "t"}, Immutable: true})
+	m.CreateSecret(ctx, &k8s.SecretData{Name: "db", Namespace: "other", Data: map[string]string{"password": "o"}})
+
+	tests := []struct {
+		name string
+		run  func() error
+		want string
+	}{
+		{
+			name: "create existing",
+			run:  func() error { return m.CreateSecret(ctx, db) },
+			want: apperrors.CodeAlreadyExists,
+		},
+		{
+			name: "get missing",
+			run: func() error {
+				_, err := m.GetSecret(ctx, "default", "missing")
+				return err
+			},
+			want: apperrors.CodeNotFound,
+		},
+		{
+			name: "update stale version",
+			run: func() error {
+				return m.UpdateSecret(ctx, &k8s.SecretData{Name: "db", Namespace: "default", Data: map[string]string{"password": "v2"}, ResourceVersion: "99"})
+			},
+			want: apperrors.CodeConflict,
+		},
+		{
+			name: "update immutable",
+			run: func() error {
+				return m.UpdateSecret(ctx, &k8s.SecretData{Name: "api", Namespace: "default", Data: map[string]string{"token": "changed"}})
+			},
+			want: apperrors.CodeImmutable,
+		},
+		{
+			name: "delete stale version",
+			run: func() error {
+				return m.DeleteSecret(ctx, "default", "db", k8s.DeleteOptions{ResourceVersion: "99"})
+			},
+			want: apperrors.CodeConflict,
+		},
+		{
+			name: "history disabled",
+			run: func() error {
+				_, err := m.ListRevisions(ctx, "default", "db")
+				return err
+			},
+			want: apperrors.CodeNotImplemented,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(); apperrors.CodeOf(err) != tt.want {
+				t.Errorf("error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+
+	current, _ := m.GetSecret(ctx, "default", "db")
+	update := k8s.NewSecretData(current)
+	update.Data["password"] = "v2"
+	if err := m.UpdateSecret(ctx, update); err != nil {
+		t.Fatalf("UpdateSecret() error = %v", err)
+	}
+	if update.ResourceVersion == current.ResourceVersion {
+		t.Errorf("UpdateSecret() kept resourceVersion %s", update.ResourceVersion)
+	}
+
+	patched, err := m.PatchSecret(ctx, "default", "db", &k8s.SecretPatch{Set: map[string]string{"user": "admin"}})
+	if err != nil {
+		t.Fatalf("PatchSecret() error = %v", err)
+	}
+	if string(patched.Data["password"]) != "v2" || string(patched.Data["user"]) != "admin" {
+		t.Errorf("PatchSecret() data = %v", patched.Data)
+	}
+
+	list, err := m.ListSecrets(ctx, "", k8s.ListOptions{LabelSelector: "app=db"})
+	if err != nil || len(list.Items) != 1 || list.Items[0].Namespace != "default" {
+		t.Errorf("ListSecrets() by label = %v, %v", list, err)
+	}
+
+	var names []string
+	opts := k8s.ListOptions{Limit: 2}
+	for {
+		page, err := m.ListSecrets(ctx, "", opts)
+		if err != nil {
+			t.Fatalf("ListSecrets() error = %v", err)
+		}
+		for _, secret := range page.Items {
+			names = append(names, secret.Namespace+"/"+secret.Name)
+		}
+		if page.Continue == "" {
+			break
+		}
+		opts.Continue = page.Continue
+	}
+	if len(names) != 3 || names[0] != "default/api" || names[2] != "other/db" {
+		t.Errorf("paged ListSecrets() = %v", names)
+	}
+
+	namespaces, _ := m.ListNamespaces(ctx, "kubernetes.io/metadata.name!=other")
+	if len(namespaces) != 1 || namespaces[0] != "default" {
+		t.Errorf("ListNamespaces() = %v, want [default]", namespaces)
+	}
+
+	if err := m.DeleteSecret(ctx, "default", "db"); err != nil {
+		t.Fatalf("DeleteSecret() error = %v", err)
+	}
+	if _, err := m.GetSecret(ctx, "default", "db"); apperrors.CodeOf(err) != apperrors.CodeNotFound {
+		t.Errorf("GetSecret() after delete error = %v", err)
+	}
+}
+
+func TestMemory_History(t *testing.T) {
+	ctx := context.TODO()
+	m := NewMemory()
+	if err := m.EnableHistory(2); err != nil {
+		t.Fatal(err)
+	}
+
+	m.CreateSecret(ctx, &k8s.SecretData{Name: "db", Namespace: "default", Data: map[string]string{"password": "v1"}})
+	for _, password := range []string{"v2", "v3", "v4"} {
+		if err := m.UpdateSecret(ctx, &k8s.SecretData{Name: "db", Namespace: "default", Data: map[string]string{"password": password}}); err != nil {
+			t.Fatalf("UpdateSecret() error = %v", err)
+		}
+	}
+
+	revisions, err := m.ListRevisions(ctx, "default", "db")
+	if err != nil || len(revisions) != 2 || revisions[0].Revision != 2 || revisions[1].Revision != 3 {
+		t.Fatalf("ListRevisions() = %v, %v, want revisions 2 and 3", revisions, err)
+	}
+
+	if _, err := m.Rollback(ctx, "default", "db", 2); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if value, _ := m.GetSecretString(ctx, "default", "db", "password"); value != "v2" {
+		t.Errorf("password after rollback = %s, want v2", value)
+	}
+	if _, err := m.GetRevision(ctx, "default", "db", 1); apperrors.CodeOf(err) != apperrors.CodeNotFound {
+		t.Errorf("GetRevision() of a pruned revision error = %v", err)
+	}
+}
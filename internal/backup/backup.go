@@ -0,0 +1,152 @@
+// Package backup writes secrets into encrypted archives and restores them.
+//
+// An archive is an age encrypted gzip compressed tar holding one v1/Secret
+// manifest per secret, under secrets/<namespace>/<name>.yaml, followed by
+// manifest.json listing every entry with its SHA-256.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"filippo.io/age"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// FormatVersion is the version of the archive layout
+	FormatVersion = 1
+
+	manifestFile = "manifest.json"
+	secretsDir   = "secrets"
+	pageSize     = 500
+)
+
+// Manifest describes the content of an archive
+type Manifest struct {
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Namespaces []string  `json:"namespaces"`
+	Secrets    []Entry   `json:"secrets"`
+}
+
+// Entry is a secret stored in an archive
+type Entry struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	File      string `json:"file"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+}
+
+// Options select the secrets to back up
+type Options struct {
+	// Namespaces to back up; empty means every namespace
+	Namespaces    []string
+	LabelSelector string
+}
+
+// Backup streams the selected secrets into an archive encrypted to
+// recipients. Service account tokens and revision history are skipped.
+func Backup(ctx context.Context, manager k8s.SecretManager, w io.Writer, recipients []age.Recipient, opts Options) (*Manifest, error) {
+	encrypted, err := age.Encrypt(w, recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("error starting encryption: %w", err)
+	}
+	compressed := gzip.NewWriter(encrypted)
+	archive := tar.NewWriter(compressed)
+
+	manifest := &Manifest{Version: FormatVersion, CreatedAt: time.Now().UTC(), Namespaces: opts.Namespaces, Secrets: []Entry{}}
+	if len(opts.Namespaces) == 0 {
+		// An empty namespace lists every namespace
+		opts.Namespaces = []string{""}
+	}
+
+	for _, namespace := range opts.Namespaces {
+		list := k8s.ListOptions{LabelSelector: opts.LabelSelector, Limit: pageSize}
+		for {
+			page, err := manager.ListSecrets(ctx, namespace, list)
+			if err != nil {
+				return nil, err
+			}
+			for i := range page.Items {
+				secret := &page.Items[i]
+				if secret.Type == corev1.SecretTypeServiceAccountToken || secret.Type == k8s.HistorySecretType {
+					continue
+				}
+				entry, err := writeSecret(archive, secret)
+				if err != nil {
+					return nil, err
+				}
+				manifest.Secrets = append(manifest.Secrets, entry)
+			}
+			if page.Continue == "" {
+				break
+			}
+			list.Continue = page.Continue
+		}
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding manifest: %w", err)
+	}
+	if err := writeFile(archive, manifestFile, content); err != nil {
+		return nil, err
+	}
+
+	for _, closer := range []io.Closer{archive, compressed, encrypted} {
+		if err := closer.Close(); err != nil {
+			return nil, fmt.Errorf("error finishing archive: %w", err)
+		}
+	}
+	return manifest, nil
+}
+
+func writeSecret(archive *tar.Writer, secret *corev1.Secret) (Entry, error) {
+	var content bytes.Buffer
+	if err := secretio.WriteManifests(&content, []corev1.Secret{*secret}); err != nil {
+		return Entry{}, err
+	}
+
+	entry := Entry{
+		Namespace: secret.Namespace,
+		Name:      secret.Name,
+		File:      path.Join(secretsDir, secret.Namespace, secret.Name+".yaml"),
+		Size:      int64(content.Len()),
+		SHA256:    checksum(content.Bytes()),
+	}
+	return entry, writeFile(archive, entry.File, content.Bytes())
+}
+
+func writeFile(archive *tar.Writer, name string, content []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    int64(len(content)),
+		ModTime: time.Now().UTC(),
+	}
+	if err := archive.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	if _, err := archive.Write(content); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	return nil
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,200 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/mpalu/k8s-secrets-manager/internal/crypto"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newManager() *k8s.Client {
+	secret := func(namespace, name, value string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, ResourceVersion: "7"},
+			Type:       corev1.SecretTypeOpaque,
+			Data:       map[string][]byte{"value": []byte(value), "raw": {0xff, 0x00}},
+		}
+	}
+	return k8s.NewClientForClientset(fake.NewSimpleClientset(
+		secret("prod", "db", "prod-db"),
+		secret("prod", "api", "prod-api"),
+		secret("dev", "db", "dev-db"),
+	))
+}
+
+func backup(t *testing.T, recipients []age.Recipient, opts Options) []byte {
+	t.Helper()
+
+	var archive bytes.Buffer
+	if _, err := Backup(context.TODO(), newManager(), &archive, recipients, opts); err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+	return archive.Bytes()
+}
+
+func TestPassphrase(t *testing.T) {
+	recipients, _ := crypto.Recipients("correct horse battery staple", nil)
+	archive := backup(t, recipients, Options{Namespaces: []string{"dev"}})
+
+	identities, _ := crypto.Identities("correct horse battery staple", nil)
+	if _, secrets, err := Read(bytes.NewReader(archive), identities); err != nil || len(secrets) != 1 {
+		t.Errorf("Read() = %d secrets, %v", len(secrets), err)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	identities, err := crypto.Identities("", strings.NewReader(identity.String()+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := backup(t, []age.Recipient{identity.Recipient()}, Options{Namespaces: []string{"prod"}})
+
+	if bytes.Contains(archive, []byte("prod-db")) {
+		t.Fatal("archive is not encrypted")
+	}
+
+	manifest, secrets, err := Read(bytes.NewReader(archive), identities)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(manifest.Secrets) != 2 || len(secrets) != 2 || manifest.Secrets[0].SHA256 == "" {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+
+	tests := []struct {
+		name    string
+		opts    RestoreOptions
+		want    secretio.ImportResult
+		written bool
+	}{
+		{
+			name: "dry run",
+			opts: RestoreOptions{NamespaceMap: map[string]string{"prod": "prod-restored"}, DryRun: true},
+			want: secretio.ImportResult{Created: []string{"prod-restored/api", "prod-restored/db"}},
+		},
+		{
+			name:    "remapped",
+			opts:    RestoreOptions{NamespaceMap: map[string]string{"prod": "prod-restored"}},
+			want:    secretio.ImportResult{Created: []string{"prod-restored/api", "prod-restored/db"}},
+			written: true,
+		},
+		{
+			name: "skip existing",
+			opts: RestoreOptions{Conflict: secretio.ConflictSkip},
+			want: secretio.ImportResult{Skipped: []string{"prod/api", "prod/db"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newManager()
+			result, err := Restore(context.TODO(), manager, bytes.NewReader(archive), identities, tt.opts)
+			if err != nil {
+				t.Fatalf("Restore() error = %v", err)
+			}
+			if strings.Join(result.Created, ",") != strings.Join(tt.want.Created, ",") ||
+				strings.Join(result.Skipped, ",") != strings.Join(tt.want.Skipped, ",") {
+				t.Errorf("Restore() = %+v, want %+v", result.ImportResult, tt.want)
+			}
+
+			restored, err := manager.GetSecret(context.TODO(), "prod-restored", "db")
+			if tt.written != (err == nil) {
+				t.Fatalf("restored secret: %v, want written %v", err, tt.written)
+			}
+			if tt.written && (string(restored.Data["value"]) != "prod-db" || !bytes.Equal(restored.Data["raw"], []byte{0xff, 0x00})) {
+				t.Errorf("restored data = %v", restored.Data)
+			}
+		})
+	}
+}
+
+func TestRestoreRejects(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	recipients, err := crypto.Recipients("", []string{identity.Recipient().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := backup(t, recipients, Options{})
+
+	tampered := append([]byte(nil), archive...)
+	tampered[len(tampered)-20] ^= 0x01
+
+	other, _ := age.GenerateX25519Identity()
+
+	tests := []struct {
+		name       string
+		archive    []byte
+		identities []age.Identity
+		wantCode   string
+	}{
+		{"wrong key", archive, []age.Identity{other}, apperrors.CodeForbidden},
+		{"tampered", tampered, []age.Identity{identity}, apperrors.CodeInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := k8s.NewClientForClientset(fake.NewSimpleClientset())
+			_, err := Restore(context.TODO(), manager, bytes.NewReader(tt.archive), tt.identities, RestoreOptions{})
+			if apperrors.CodeOf(err) != tt.wantCode {
+				t.Errorf("Restore() error = %v, want %s", err, tt.wantCode)
+			}
+			list, _ := manager.ListSecrets(context.TODO(), "", k8s.ListOptions{})
+			if len(list.Items) != 0 {
+				t.Errorf("Restore() wrote %d secrets from a rejected archive", len(list.Items))
+			}
+		})
+	}
+}
+
+func TestRead_Limits(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	recipients := []age.Recipient{identity.Recipient()}
+	defer func(size int64, entries int) { maxArchiveSize, maxEntries = size, entries }(maxArchiveSize, maxEntries)
+	maxArchiveSize, maxEntries = 1<<20, 3
+
+	// Zeros compress well: a small request expands past the bound
+	var oversized bytes.Buffer
+	encrypted, err := age.Encrypt(&oversized, recipients...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := gzip.NewWriter(encrypted)
+	archive := tar.NewWriter(compressed)
+	for _, name := range []string{"a.yaml", "b.yaml"} {
+		if err := writeFile(archive, name, make([]byte, 600<<10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archive.Close()
+	compressed.Close()
+	encrypted.Close()
+
+	tests := []struct {
+		name    string
+		archive []byte
+	}{
+		{"decompressed size", oversized.Bytes()},
+		{"entry count", backup(t, recipients, Options{})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Read(bytes.NewReader(tt.archive), []age.Identity{identity})
+			if apperrors.CodeOf(err) != apperrors.CodeTooLarge {
+				t.Errorf("Read() error = %v, want %s", err, apperrors.CodeTooLarge)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
+)
+
+// maxEntrySize bounds the size of a single archive entry read into memory
+const maxEntrySize = 16 << 20
+
+// Bounds of a whole archive once decompressed, so that a small compressed
+// request cannot expand into more than Read holds in memory
+var (
+	maxArchiveSize int64 = 512 << 20
+	maxEntries           = 65536
+)
+
+// RestoreOptions control a restore
+type RestoreOptions struct {
+	// Namespaces restricts the restore to these source namespaces
+	Namespaces []string
+	// NamespaceMap renames source namespaces, e.g. prod to prod-restored
+	NamespaceMap map[string]string
+	Conflict     secretio.ConflictPolicy
+	DryRun       bool
+}
+
+// RestoreResult reports a restore
+type RestoreResult struct {
+	Manifest *Manifest `json:"manifest"`
+	secretio.ImportResult
+}
+
+// Read decrypts an archive and checks it against its manifest: every entry
+// must be listed with a matching size and checksum and every listed entry
+// must be present. It returns the manifest and the secrets in manifest
+// order.
+func Read(r io.Reader, identities []age.Identity) (*Manifest, []*k8s.SecretData, error) {
+	decrypted, err := age.Decrypt(r, identities...)
+	if err != nil {
+		return nil, nil, apperrors.Wrap(apperrors.CodeForbidden, "error decrypting archive", err)
+	}
+	uncompressed, err := gzip.NewReader(decrypted)
+	if err != nil {
+		return nil, nil, corrupt("%v", err)
+	}
+	archive := tar.NewReader(uncompressed)
+
+	files := make(map[string][]byte)
+	var total int64
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, corrupt("%v", err)
+		}
+		if header.Typeflag != tar.TypeReg || header.Size > maxEntrySize {
+			return nil, nil, corrupt("unexpected entry %s", header.Name)
+		}
+		if _, duplicate := files[header.Name]; duplicate {
+			return nil, nil, corrupt("duplicate entry %s", header.Name)
+		}
+		if total += header.Size; total > maxArchiveSize || len(files) >= maxEntries {
+			return nil, nil, apperrors.New(apperrors.CodeTooLarge,
+				fmt.Sprintf("archive holds more than %d entries or %d bytes", maxEntries, maxArchiveSize))
+		}
+		content, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, nil, corrupt("%v", err)
+		}
+		files[header.Name] = content
+	}
+
+	raw, ok := files[manifestFile]
+	if !ok {
+		return nil, nil, corrupt("%s is missing", manifestFile)
+	}
+	delete(files, manifestFile)
+	var manifest Manifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, nil, corrupt("invalid %s: %v", manifestFile, err)
+	}
+	if manifest.Version != FormatVersion {
+		return nil, nil, corrupt("unsupported archive version %d", manifest.Version)
+	}
+
+	secrets := make([]*k8s.SecretData, 0, len(manifest.Secrets))
+	for _, entry := range manifest.Secrets {
+		content, ok := files[entry.File]
+		if !ok {
+			return nil, nil, corrupt("%s is missing", entry.File)
+		}
+		delete(files, entry.File)
+		if int64(len(content)) != entry.Size || checksum(content) != entry.SHA256 {
+			return nil, nil, corrupt("checksum mismatch for %s", entry.File)
+		}
+
+		manifests, err := secretio.ReadManifests(bytes.NewReader(content))
+		if err != nil || len(manifests) != 1 ||
+			manifests[0].Namespace != entry.Namespace || manifests[0].Name != entry.Name {
+			return nil, nil, corrupt("%s does not hold secret %s/%s", entry.File, entry.Namespace, entry.Name)
+		}
+		secrets = append(secrets, secretio.FromManifest(&manifests[0]))
+	}
+	if len(files) > 0 {
+		extra := make([]string, 0, len(files))
+		for name := range files {
+			extra = append(extra, name)
+		}
+		sort.Strings(extra)
+		return nil, nil, corrupt("entries not listed in the manifest: %v", extra)
+	}
+
+	return &manifest, secrets, nil
+}
+
+// Restore verifies an archive completely, then writes its secrets through
+// manager
+func Restore(ctx context.Context, manager k8s.SecretManager, r io.Reader, identities []age.Identity, opts RestoreOptions) (*RestoreResult, error) {
+	manifest, secrets, err := Read(r, identities)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]bool, len(opts.Namespaces))
+	for _, namespace := range opts.Namespaces {
+		selected[namespace] = true
+	}
+	var restore []*k8s.SecretData
+	for _, secret := range secrets {
+		if len(selected) > 0 && !selected[secret.Namespace] {
+			continue
+		}
+		if target, ok := opts.NamespaceMap[secret.Namespace]; ok {
+			secret.Namespace = target
+		}
+		restore = append(restore, secret)
+	}
+
+	result, err := secretio.WriteSecrets(ctx, manager, restore, opts.Conflict, opts.DryRun)
+	if result == nil {
+		return nil, err
+	}
+	return &RestoreResult{Manifest: manifest, ImportResult: *result}, err
+}
+
+// ParseNamespaceMap parses comma separated from=to namespace renames
+func ParseNamespaceMap(s string) (map[string]string, error) {
+	namespaces := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok || from == "" || to == "" {
+			return nil, apperrors.New(apperrors.CodeInvalid, fmt.Sprintf("invalid namespace mapping %q, expected from=to", pair))
+		}
+		namespaces[from] = to
+	}
+	return namespaces, nil
+}
+
+func corrupt(format string, args ...interface{}) error {
+	return apperrors.New(apperrors.CodeInvalid, "corrupt archive: "+fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/apply"
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
+	"github.com/spf13/cobra"
+)
+
+var (
+	applyDir    string
+	applySource string
+	applyPrune  bool
+	applyDryRun bool
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Apply the secret definitions of a directory",
+	Long: `Apply creates or updates the secrets defined in the manifests (.yaml, .yml,
+.json) and env files (.env, one secret named after the file) below a
+directory, decrypting the files made by the encrypt command. Applied
+secrets are labeled as managed by this tool and --source; existing secrets
+without those labels are never changed. With --prune the managed secrets of
+the source that are no longer defined are deleted.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		identities, err := decryptIdentities()
+		if err != nil {
+			return err
+		}
+		desired, err := apply.LoadDir(applyDir, secretio.ImportOptions{Namespace: namespace, Identities: identities})
+		if err != nil {
+			return err
+		}
+		client, err := newWriteClient()
+		if err != nil {
+			return err
+		}
+
+		steps, err := apply.Apply(context.Background(), client, desired, apply.Options{
+			Source: applySource,
+			Prune:  applyPrune,
+			DryRun: applyDryRun,
+		})
+		for _, step := range steps {
+			line := fmt.Sprintf("- %s/%s %s", step.Namespace, step.Name, step.Action)
+			switch {
+			case step.Error != "":
+				line += " failed: " + step.Error
+			case step.Reason != "":
+				line += ": " + step.Reason
+			case applyDryRun && step.Action != apply.ActionUnchanged && step.Action != apply.ActionSkip:
+				line += " (dry run)"
+			}
+			fmt.Println(line)
+			for _, change := range step.Changes {
+				printChange(change)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("error applying secrets: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+	applyCmd.Flags().StringVarP(&applyDir, "filename", "f", "", "directory of secret definitions")
+	applyCmd.Flags().StringVar(&applySource, "source", apply.DefaultSource, "name of the set of definitions, scopes pruning")
+	applyCmd.Flags().BoolVar(&applyPrune, "prune", false, "delete managed secrets of the source that are no longer defined")
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "print the plan without changing anything")
+	addDecryptFlags(applyCmd)
+	applyCmd.MarkFlagRequired("filename")
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/backup"
+	"github.com/mpalu/k8s-secrets-manager/internal/crypto"
+	"github.com/spf13/cobra"
+)
+
+// backupPassphraseEnv holds the archive passphrase when no file is given
+const backupPassphraseEnv = "SECRETS_MANAGER_BACKUP_PASSPHRASE"
+
+var (
+	backupNamespaces     []string
+	backupSelector       string
+	backupOutput         string
+	backupRecipients     []string
+	backupPassphraseFile string
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Write the secrets of namespaces to an encrypted archive",
+	Long: `Backup writes every secret of the given namespaces (all namespaces by
+default) into an age encrypted archive with a checksummed manifest. The
+archive is encrypted to --recipient age public keys, or with a passphrase
+read from --passphrase-file or $` + backupPassphraseEnv + `.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		passphrase, err := readPassphrase(backupPassphraseFile, backupPassphraseEnv)
+		if err != nil {
+			return err
+		}
+		recipients, err := crypto.Recipients(passphrase, backupRecipients)
+		if err != nil {
+			return err
+		}
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(backupOutput, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return fmt.Errorf("error creating %s: %w", backupOutput, err)
+		}
+		manifest, err := backup.Backup(context.Background(), client, f, recipients, backup.Options{
+			Namespaces:    backupNamespaces,
+			LabelSelector: backupSelector,
+		})
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(backupOutput)
+			return fmt.Errorf("error writing backup: %w", err)
+		}
+
+		fmt.Printf("%d secrets written to %s\n", len(manifest.Secrets), backupOutput)
+		return nil
+	},
+}
+
+// readPassphrase reads a passphrase from file or, without one, the
+// environment variable env; never from the command line
+func readPassphrase(file, env string) (string, error) {
+	if file == "" {
+		return os.Getenv(env), nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("error reading passphrase: %w", err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	backupCmd.Flags().StringSliceVar(&backupNamespaces, "namespaces", nil, "namespaces to back up (default all)")
+	backupCmd.Flags().StringVarP(&backupSelector, "selector", "l", "", "label selector of the secrets to back up")
+	backupCmd.Flags().StringVarP(&backupOutput, "output", "o", "", "archive to create")
+	backupCmd.Flags().StringArrayVar(&backupRecipients, "recipient", nil, "age public key to encrypt to (repeatable)")
+	backupCmd.Flags().StringVar(&backupPassphraseFile, "passphrase-file", "", "file holding the passphrase")
+	backupCmd.MarkFlagRequired("output")
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/replication"
+	"github.com/spf13/cobra"
+)
+
+var (
+	copyTargetNamespace string
+	copyTargetName      string
+	copyOverwrite       bool
+)
+
+var copyCmd = &cobra.Command{
+	Use:   "copy",
+	Short: "Copy a secret to another namespace or name",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newWriteClient()
+		if err != nil {
+			return err
+		}
+
+		copied, err := replication.Copy(context.Background(), client, &replication.CopyRequest{
+			Namespace:       namespace,
+			Name:            secretName,
+			TargetNamespace: copyTargetNamespace,
+			TargetName:      copyTargetName,
+			Overwrite:       copyOverwrite,
+		})
+		if err != nil {
+			return fmt.Errorf("error copying secret: %w", err)
+		}
+
+		fmt.Printf("Secret %s/%s copied to %s/%s\n", namespace, secretName, copied.Namespace, copied.Name)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(copyCmd)
+	copyCmd.Flags().StringVar(&secretName, "name", "", "name of the secret to copy")
+	copyCmd.Flags().StringVar(&copyTargetNamespace, "to-namespace", "", "target namespace (default: the source namespace)")
+	copyCmd.Flags().StringVar(&copyTargetName, "to-name", "", "target name (default: the source name)")
+	copyCmd.Flags().BoolVar(&copyOverwrite, "overwrite", false, "replace the target when it exists")
+	copyCmd.MarkFlagRequired("name")
+}
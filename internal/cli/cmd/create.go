@@ -3,57 +3,155 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
+	"github.com/mpalu/k8s-secrets-manager/internal/validator"
 	"github.com/spf13/cobra"
 )
 
 var (
-	secretName string
-	secretType string
-	secretData string
+	secretName        string
+	secretType        string
+	secretData        string
+	secretLabels      []string
+	secretAnnotations []string
+	secretImmutable   bool
+	secretFile        string
 )
 
 var createCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Create a new secret",
+	Long: `Create a secret from --data and the --from-* flags, or from a SecretData
+JSON or YAML document given with --file, which may be encrypted (see the
+encrypt command). --name and --namespace override those of the document.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := k8s.NewClient(kubeconfig)
-		if err != nil {
-			return fmt.Errorf("error creating k8s client: %w", err)
-		}
-
-		data := make(map[string]string)
-		pairs := strings.Split(secretData, ",")
-		for _, pair := range pairs {
-			kv := strings.SplitN(pair, "=", 2)
-			if len(kv) == 2 {
-				data[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		if secretFile != "" {
+			secret, err := readSecretFile(secretFile)
+			if err != nil {
+				return err
 			}
+			if secretName != "" {
+				secret.Name = secretName
+			}
+			if cmd.Flags().Changed("namespace") || secret.Namespace == "" {
+				secret.Namespace = namespace
+			}
+			return createSecret(secret)
 		}
-
-		secret := &k8s.SecretData{
-			Name:      secretName,
-			Namespace: namespace,
-			Type:      secretType,
-			Data:      data,
+		if secretName == "" {
+			return fmt.Errorf(`required flag(s) "name" not set`)
 		}
 
-		if err := client.CreateSecret(context.Background(), secret); err != nil {
-			return fmt.Errorf("error creating secret: %w", err)
+		sources, err := readSources()
+		if err != nil {
+			return err
 		}
 
-		fmt.Printf("Secret %s successfully created in namespace %s\n", secretName, namespace)
-		return nil
+		return createSecret(&k8s.SecretData{
+			Name:       secretName,
+			Namespace:  namespace,
+			Type:       secretType,
+			Data:       sources.data,
+			BinaryData: sources.binaryData,
+		})
 	},
 }
 
+// createSecret completes secret with the metadata flags shared by every
+// create command, validates it and creates it
+func createSecret(secret *k8s.SecretData) error {
+	client, err := newWriteClient()
+	if err != nil {
+		return err
+	}
+
+	labels, err := parsePairs(secretLabels, "--label")
+	if err != nil {
+		return err
+	}
+	annotations, err := parsePairs(secretAnnotations, "--annotation")
+	if err != nil {
+		return err
+	}
+	if len(labels) > 0 {
+		secret.Labels = labels
+	}
+	if len(annotations) > 0 {
+		secret.Annotations = annotations
+	}
+	if secretImmutable {
+		secret.Immutable = true
+	}
+
+	if err := validator.ValidateSecretData(secret); err != nil {
+		return err
+	}
+
+	if err := client.CreateSecret(context.Background(), secret); err != nil {
+		return fmt.Errorf("error creating secret: %w", err)
+	}
+
+	fmt.Printf("Secret %s successfully created in namespace %s\n", secret.Name, secret.Namespace)
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(createCmd)
-	createCmd.Flags().StringVar(&secretName, "name", "", "secret name")
+	addCreateFlags(createCmd)
 	createCmd.Flags().StringVar(&secretType, "type", "Opaque", "secret type")
-	createCmd.Flags().StringVar(&secretData, "data", "", "secret data (format: key1=value1,key2=value2)")
-	createCmd.MarkFlagRequired("name")
-	createCmd.MarkFlagRequired("data")
+	createCmd.Flags().StringVar(&secretData, "data", "", "secret data (format: key1=value1,key2=value2; use --from-literal for values containing commas)")
+	addSourceFlags(createCmd)
+	createCmd.Flags().StringVar(&secretFile, "file", "", "SecretData JSON or YAML file, optionally encrypted")
+	addDecryptFlags(createCmd)
+}
+
+// addCreateFlags registers the flags shared by create and its typed
+// subcommands
+func addCreateFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&secretName, "name", "", "secret name")
+	cmd.Flags().StringArrayVar(&secretLabels, "label", nil, "secret label (format: key=value, repeatable)")
+	cmd.Flags().StringArrayVar(&secretAnnotations, "annotation", nil, "secret annotation (format: key=value, repeatable)")
+	cmd.Flags().BoolVar(&secretImmutable, "immutable", false, "prevent later changes to the secret data")
+}
+
+// readSecretFile reads a single, possibly encrypted, SecretData document
+func readSecretFile(path string) (*k8s.SecretData, error) {
+	identities, err := decryptIdentities()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer f.Close()
+
+	secrets, err := secretio.Read(f, secretio.ImportOptions{Format: secretio.FormatSecretData, Identities: identities})
+	if err != nil {
+		return nil, err
+	}
+	if len(secrets) != 1 {
+		return nil, fmt.Errorf("%s holds %d secrets, expected one", path, len(secrets))
+	}
+	return secrets[0], nil
+}
+
+// parseKeyValues reads the comma separated key=value pairs of --data. A
+// pair without "=" usually is the rest of a value cut at a comma, which
+// only --from-literal can pass.
+func parseKeyValues(s string) (map[string]string, error) {
+	data := make(map[string]string)
+	pairs := strings.Split(s, ",")
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); !ok || key == "" {
+			return nil, fmt.Errorf("invalid --data entry %q, expected key=value; use --from-literal key=value for values containing commas", pair)
+		}
+		data[key] = strings.TrimSpace(value)
+	}
+	return data, nil
 }
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKeyValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"pairs", "user=admin, password=s3cr3t", map[string]string{"user": "admin", "password": "s3cr3t"}, false},
+		{"value with equals", "dsn=host=db", map[string]string{"dsn": "host=db"}, false},
+		{"value with comma", "hosts=a,b", nil, true},
+		{"empty key", "=value", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseKeyValues(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseKeyValues(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "--from-literal") {
+					t.Errorf("parseKeyValues(%q) error = %v, want it to point to --from-literal", tt.input, err)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseKeyValues(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/validator"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tlsCertFile string
+	tlsKeyFile  string
+
+	registryServer   string
+	registryUsername string
+	registryPassword string
+	registryEmail    string
+
+	basicAuthUsername string
+	basicAuthPassword string
+
+	sshPrivateKeyFile string
+)
+
+var createTLSCmd = &cobra.Command{
+	Use:   "tls",
+	Short: "Create a kubernetes.io/tls secret from a certificate and key",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cert, err := os.ReadFile(tlsCertFile)
+		if err != nil {
+			return fmt.Errorf("error reading certificate: %w", err)
+		}
+		key, err := os.ReadFile(tlsKeyFile)
+		if err != nil {
+			return fmt.Errorf("error reading key: %w", err)
+		}
+
+		secret, err := validator.NewTLSSecret(namespace, secretName, cert, key)
+		if err != nil {
+			return err
+		}
+		return createSecret(secret)
+	},
+}
+
+var createDockerRegistryCmd = &cobra.Command{
+	Use:   "docker-registry",
+	Short: "Create a kubernetes.io/dockerconfigjson secret for a registry",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		secret, err := validator.NewDockerRegistrySecret(namespace, secretName,
+			registryServer, registryUsername, registryPassword, registryEmail)
+		if err != nil {
+			return err
+		}
+		return createSecret(secret)
+	},
+}
+
+var createBasicAuthCmd = &cobra.Command{
+	Use:   "basic-auth",
+	Short: "Create a kubernetes.io/basic-auth secret",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		secret, err := validator.NewBasicAuthSecret(namespace, secretName, basicAuthUsername, basicAuthPassword)
+		if err != nil {
+			return err
+		}
+		return createSecret(secret)
+	},
+}
+
+var createSSHAuthCmd = &cobra.Command{
+	Use:   "ssh-auth",
+	Short: "Create a kubernetes.io/ssh-auth secret from a private key",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := os.ReadFile(sshPrivateKeyFile)
+		if err != nil {
+			return fmt.Errorf("error reading private key: %w", err)
+		}
+
+		secret, err := validator.NewSSHAuthSecret(namespace, secretName, key)
+		if err != nil {
+			return err
+		}
+		return createSecret(secret)
+	},
+}
+
+func init() {
+	createCmd.AddCommand(createTLSCmd, createDockerRegistryCmd, createBasicAuthCmd, createSSHAuthCmd)
+
+	addCreateFlags(createTLSCmd)
+	createTLSCmd.MarkFlagRequired("name")
+	createTLSCmd.Flags().StringVar(&tlsCertFile, "cert", "", "path to the PEM encoded certificate chain")
+	createTLSCmd.Flags().StringVar(&tlsKeyFile, "key", "", "path to the PEM encoded private key")
+	createTLSCmd.MarkFlagRequired("cert")
+	createTLSCmd.MarkFlagRequired("key")
+
+	addCreateFlags(createDockerRegistryCmd)
+	createDockerRegistryCmd.MarkFlagRequired("name")
+	createDockerRegistryCmd.Flags().StringVar(&registryServer, "server", "https://index.docker.io/v1/", "registry server")
+	createDockerRegistryCmd.Flags().StringVar(&registryUsername, "username", "", "registry username")
+	createDockerRegistryCmd.Flags().StringVar(&registryPassword, "password", "", "registry password")
+	createDockerRegistryCmd.Flags().StringVar(&registryEmail, "email", "", "registry email")
+	createDockerRegistryCmd.MarkFlagRequired("username")
+	createDockerRegistryCmd.MarkFlagRequired("password")
+
+	addCreateFlags(createBasicAuthCmd)
+	createBasicAuthCmd.MarkFlagRequired("name")
+	createBasicAuthCmd.Flags().StringVar(&basicAuthUsername, "username", "", "username")
+	createBasicAuthCmd.Flags().StringVar(&basicAuthPassword, "password", "", "password")
+
+	addCreateFlags(createSSHAuthCmd)
+	createSSHAuthCmd.MarkFlagRequired("name")
+	createSSHAuthCmd.Flags().StringVar(&sshPrivateKeyFile, "ssh-privatekey", "", "path to the private key")
+	createSSHAuthCmd.MarkFlagRequired("ssh-privatekey")
+}
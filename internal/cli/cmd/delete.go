@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
 	"github.com/spf13/cobra"
 )
 
@@ -12,9 +11,9 @@ var deleteCmd = &cobra.Command{
 	Use:   "delete",
 	Short: "Deleta um secret",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := k8s.NewClient(kubeconfig)
+		client, err := newClient()
 		if err != nil {
-			return fmt.Errorf("error creating k8s client: %w", err)
+			return err
 		}
 
 		if err := client.DeleteSecret(context.Background(), namespace, secretName); err != nil {
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/diff"
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
+	"github.com/spf13/cobra"
+)
+
+// ErrDrift is returned by the diff command when secrets differ from their
+// definitions
+var ErrDrift = errors.New("secrets differ from their definitions")
+
+// Exit statuses of the command line, as kubectl diff uses them
+const (
+	ExitDrift = 1
+	ExitError = 2
+)
+
+// ExitCode maps the error of Execute to the exit status: 0 on success,
+// ExitDrift when the diff command found drift and ExitError otherwise
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, ErrDrift):
+		return ExitDrift
+	default:
+		return ExitError
+	}
+}
+
+var (
+	diffFile   string
+	diffFormat string
+	diffType   string
+	diffReveal bool
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare secret definitions with the cluster",
+	Long: `Diff compares the secrets defined in a manifest, env, json, yaml or
+secretdata (the JSON body of the create endpoint) file with the live
+secrets and lists added (+), removed (-) and changed (~) keys, labels,
+annotations and types. Values are shown as SHA-256 hashes unless --reveal is
+given. The command exits with status 1 when anything differs and 2 when it
+fails.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := secretio.ParseFormat(diffFormat)
+		if err != nil {
+			return err
+		}
+		identities, err := decryptIdentities()
+		if err != nil {
+			return err
+		}
+
+		var in io.Reader = os.Stdin
+		if diffFile != "-" {
+			f, err := os.Open(diffFile)
+			if err != nil {
+				return fmt.Errorf("error opening %s: %w", diffFile, err)
+			}
+			defer f.Close()
+			in = f
+		}
+
+		desired, err := secretio.Read(in, secretio.ImportOptions{
+			Namespace:         namespace,
+			OverrideNamespace: cmd.Flags().Changed("namespace"),
+			Name:              secretName,
+			Type:              diffType,
+			Format:            format,
+			Identities:        identities,
+		})
+		if err != nil {
+			return err
+		}
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		results, err := diff.Secrets(context.Background(), client, desired, diff.Options{Reveal: diffReveal})
+		if err != nil {
+			return fmt.Errorf("error comparing secrets: %w", err)
+		}
+		for _, result := range results {
+			fmt.Printf("%s/%s: %s\n", result.Namespace, result.Name, result.Status)
+			for _, change := range result.Changes {
+				printChange(change)
+			}
+		}
+
+		if diff.Drift(results) {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+			return ErrDrift
+		}
+		return nil
+	},
+}
+
+func printChange(change diff.Change) {
+	field := change.Field
+	if change.Key != "" {
+		field += "." + change.Key
+	}
+	switch change.Op {
+	case diff.OpAdded:
+		fmt.Printf("  + %s: %s\n", field, change.New)
+	case diff.OpRemoved:
+		fmt.Printf("  - %s: %s\n", field, change.Old)
+	default:
+		fmt.Printf("  ~ %s: %s -> %s\n", field, change.Old, change.New)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringVar(&diffFile, "file", "-", "file to read, - for stdin")
+	diffCmd.Flags().StringVarP(&diffFormat, "format", "f", string(secretio.FormatManifest), "env, json, yaml, manifest or secretdata")
+	diffCmd.Flags().StringVar(&secretName, "name", "", "secret name for env input, or to read json/yaml as a single secret")
+	diffCmd.Flags().StringVar(&diffType, "type", "", "type of secrets read from env, json or yaml")
+	diffCmd.Flags().BoolVar(&diffReveal, "reveal", false, "show values instead of their hashes")
+	addDecryptFlags(diffCmd)
+}
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/mpalu/k8s-secrets-manager/internal/crypto"
+	"github.com/mpalu/k8s-secrets-manager/internal/encfile"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// filePassphraseEnv holds the passphrase of encrypted files when no
+	// --passphrase-file is given
+	filePassphraseEnv = "SECRETS_MANAGER_PASSPHRASE"
+	// identityFileEnv names a file of age secret keys when no
+	// --identity-file is given
+	identityFileEnv = "SECRETS_MANAGER_AGE_KEY_FILE"
+)
+
+var (
+	identityFile   string
+	passphraseFile string
+	encryptFile    string
+	encryptOutput  string
+	encryptInPlace bool
+	encryptTo      []string
+)
+
+var encryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt the values of a secret definition file",
+	Long: `Encrypt seals the values of a SecretData, manifest, JSON or YAML file
+while keeping its keys and metadata readable, so it can be committed. The
+file is encrypted to --recipient age public keys, or with a passphrase read
+from --passphrase-file or $` + filePassphraseEnv + `. A MAC over the whole
+document detects any later change.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		passphrase, err := readPassphrase(passphraseFile, filePassphraseEnv)
+		if err != nil {
+			return err
+		}
+		recipients, err := crypto.Recipients(passphrase, encryptTo)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(encryptFile)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", encryptFile, err)
+		}
+
+		encrypted, err := encfile.Encrypt(content, recipients)
+		if err != nil {
+			return err
+		}
+		return writeOutput(encrypted)
+	},
+}
+
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Decrypt an encrypted secret definition file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		identities, err := decryptIdentities()
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(encryptFile)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", encryptFile, err)
+		}
+
+		decrypted, err := encfile.Decrypt(content, identities)
+		if err != nil {
+			return err
+		}
+		return writeOutput(decrypted)
+	},
+}
+
+var editCmd = &cobra.Command{
+	Use:   "edit FILE",
+	Short: "Edit an encrypted secret definition file in $EDITOR",
+	Long: `Edit decrypts a file into a private temporary file, opens it in $EDITOR
+(vi by default) and encrypts the result again with the same data key, so
+the recipients of the file do not change.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+		identities, err := decryptIdentities()
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", path, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		key, err := encfile.OpenKey(content, identities)
+		if err != nil {
+			return err
+		}
+		plaintext, err := key.Decrypt(content)
+		if err != nil {
+			return err
+		}
+
+		tmp, err := os.CreateTemp("", "secret-*"+filepath.Ext(path))
+		if err != nil {
+			return fmt.Errorf("error creating temporary file: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+		_, err = tmp.Write(plaintext)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("error writing temporary file: %w", err)
+		}
+
+		editor := strings.Fields(os.Getenv("EDITOR"))
+		if len(editor) == 0 {
+			editor = []string{"vi"}
+		}
+		run := exec.Command(editor[0], append(editor[1:], tmp.Name())...)
+		run.Stdin, run.Stdout, run.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := run.Run(); err != nil {
+			return fmt.Errorf("error running editor: %w", err)
+		}
+
+		edited, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return fmt.Errorf("error reading temporary file: %w", err)
+		}
+		if bytes.Equal(edited, plaintext) {
+			fmt.Printf("%s unchanged\n", path)
+			return nil
+		}
+		encrypted, err := key.Encrypt(edited)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, encrypted, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("error writing %s: %w", path, err)
+		}
+		fmt.Printf("%s encrypted\n", path)
+		return nil
+	},
+}
+
+// writeOutput writes the result of encrypt or decrypt to --output, over
+// --file with --in-place, or to stdout
+func writeOutput(content []byte) error {
+	path := encryptOutput
+	if encryptInPlace {
+		path = encryptFile
+	}
+	if path == "" {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// addDecryptFlags registers the flags giving the keys of encrypted files
+func addDecryptFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&identityFile, "identity-file", "", "file of age secret keys for encrypted files (default $"+identityFileEnv+")")
+	cmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "file holding the passphrase of encrypted files (default $"+filePassphraseEnv+")")
+}
+
+// decryptIdentities returns the identities for encrypted files given by
+// flags, the environment or the config, or none when no key is configured
+func decryptIdentities() ([]age.Identity, error) {
+	file := passphraseFile
+	if file == "" && os.Getenv(filePassphraseEnv) == "" && cfg != nil {
+		file = cfg.Decryption.PassphraseFile
+	}
+	passphrase, err := readPassphrase(file, filePassphraseEnv)
+	if err != nil {
+		return nil, err
+	}
+	path := identityFile
+	if path == "" {
+		path = os.Getenv(identityFileEnv)
+	}
+	if path == "" && cfg != nil {
+		path = cfg.Decryption.IdentityFile
+	}
+	if passphrase == "" && path == "" {
+		return nil, nil
+	}
+
+	var keys io.Reader
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("error opening identity file: %w", err)
+		}
+		defer f.Close()
+		keys = f
+	}
+	return crypto.Identities(passphrase, keys)
+}
+
+func init() {
+	rootCmd.AddCommand(encryptCmd, decryptCmd, editCmd)
+
+	for _, cmd := range []*cobra.Command{encryptCmd, decryptCmd} {
+		cmd.Flags().StringVar(&encryptFile, "file", "", "file to read")
+		cmd.Flags().StringVarP(&encryptOutput, "output", "o", "", "file to write (default stdout)")
+		cmd.Flags().BoolVarP(&encryptInPlace, "in-place", "i", false, "replace --file")
+		cmd.MarkFlagRequired("file")
+	}
+	encryptCmd.Flags().StringArrayVar(&encryptTo, "recipient", nil, "age public key to encrypt to (repeatable)")
+	encryptCmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "file holding the passphrase (default $"+filePassphraseEnv+")")
+	addDecryptFlags(decryptCmd)
+	addDecryptFlags(editCmd)
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat        string
+	exportOutput        string
+	exportSelector      string
+	exportAllNamespaces bool
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export a secret, or the secrets of a namespace, to a file",
+	Long: `Export writes a secret (--name) or every secret of the namespace matching
+--selector as env, json, yaml or manifest. Manifests leave out server managed
+fields so they can be applied to another cluster.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := secretio.ParseFormat(exportFormat)
+		if err != nil {
+			return err
+		}
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		var out io.Writer = os.Stdout
+		if exportOutput != "" {
+			f, err := os.OpenFile(exportOutput, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+			if err != nil {
+				return fmt.Errorf("error creating %s: %w", exportOutput, err)
+			}
+			defer f.Close()
+			out = f
+		}
+
+		ns := namespace
+		if exportAllNamespaces {
+			ns = ""
+		}
+		if err := secretio.Export(context.Background(), client, out, secretio.ExportOptions{
+			Namespace:     ns,
+			Name:          secretName,
+			LabelSelector: exportSelector,
+			Format:        format,
+		}); err != nil {
+			return fmt.Errorf("error exporting secrets: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVar(&secretName, "name", "", "export only this secret")
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", string(secretio.FormatManifest), "env, json, yaml, manifest or secretdata")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "file to write, created with mode 0600 (default stdout)")
+	exportCmd.Flags().StringVarP(&exportSelector, "selector", "l", "", "label selector of the secrets to export")
+	exportCmd.Flags().BoolVarP(&exportAllNamespaces, "all-namespaces", "A", false, "export secrets of all namespaces (manifest format only)")
+}
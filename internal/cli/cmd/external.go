@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/external"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/logging"
+)
+
+// newExternalSyncer builds the syncer of the external section, writing
+// through manager
+func newExternalSyncer(manager k8s.SecretManager) (*external.Syncer, error) {
+	vc := cfg.External.Vault
+	address := vc.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	token := vc.Token
+	switch {
+	case vc.TokenFile != "":
+		content, err := os.ReadFile(vc.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading vault token: %w", err)
+		}
+		token = strings.TrimSpace(string(content))
+	case token == "":
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	provider, err := external.NewVault(external.VaultOptions{
+		Address:   address,
+		Token:     token,
+		Mount:     vc.Mount,
+		KVVersion: vc.KVVersion,
+		Namespace: vc.Namespace,
+		Timeout:   vc.Timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mappings := make([]external.Mapping, 0, len(cfg.External.Secrets))
+	for _, sc := range cfg.External.Secrets {
+		mapping := external.Mapping{Namespace: sc.Namespace, Name: sc.Name}
+		if mapping.Namespace == "" {
+			mapping.Namespace = "default"
+		}
+		for _, dc := range sc.Data {
+			mapping.Data = append(mapping.Data, external.FieldRef{Key: dc.Key, Path: dc.Path, Field: dc.Field})
+		}
+		if err := mapping.Validate(); err != nil {
+			return nil, fmt.Errorf("external secret %s/%s: %w", mapping.Namespace, mapping.Name, err)
+		}
+		mappings = append(mappings, mapping)
+	}
+
+	return external.NewSyncer(manager, provider, mappings, external.Options{
+		Namespace:       cfg.External.Namespace,
+		AnnotationPaths: cfg.External.AnnotationPaths,
+		Logger:          logging.GetLogger(),
+	}), nil
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/generate"
+	"github.com/spf13/cobra"
+)
+
+var (
+	generateSpecs     []string
+	generateType      string
+	generateOverwrite bool
+)
+
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Create or extend a secret with generated values",
+	Long: `Generate stores random values in a secret without printing them.
+Each --generator is a generator name optionally followed by parameters:
+
+  k8s-secrets-manager generate --name db \
+    --generator password:key=db-password,length=40,charset=ascii \
+    --generator htpasswd:username=admin
+
+Generators: password, token, uuid, rsa, ecdsa, ssh-keypair, htpasswd and
+self-signed-cert.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newWriteClient()
+		if err != nil {
+			return err
+		}
+
+		req := &generate.Request{
+			Namespace: namespace,
+			Name:      secretName,
+			Type:      generateType,
+			Overwrite: generateOverwrite,
+		}
+		for _, spec := range generateSpecs {
+			name, rawParams, _ := strings.Cut(spec, ":")
+			params, err := generate.ParseParams(rawParams)
+			if err != nil {
+				return err
+			}
+			req.Generators = append(req.Generators, generate.Spec{Generator: name, Params: params})
+		}
+
+		result, err := generate.NewRegistry().GenerateSecret(context.Background(), client, req)
+		if err != nil {
+			return fmt.Errorf("error generating secret: %w", err)
+		}
+
+		action := "updated"
+		if result.Created {
+			action = "created"
+		}
+		fmt.Printf("Secret %s %s in namespace %s with generated keys: %s\n",
+			secretName, action, namespace, strings.Join(result.Keys, ", "))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(generateCmd)
+	generateCmd.Flags().StringVar(&secretName, "name", "", "secret name")
+	generateCmd.Flags().StringArrayVarP(&generateSpecs, "generator", "g", nil, "generator and parameters (format: name[:key=value,...], repeatable)")
+	generateCmd.Flags().StringVar(&generateType, "type", "", "secret type when the secret is created (default Opaque)")
+	generateCmd.Flags().BoolVar(&generateOverwrite, "overwrite", false, "replace keys that already exist")
+	generateCmd.MarkFlagRequired("name")
+	generateCmd.MarkFlagRequired("generator")
+}
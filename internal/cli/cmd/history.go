@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the recorded revisions of a secret",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		revisions, err := client.ListRevisions(context.Background(), namespace, secretName)
+		if err != nil {
+			return fmt.Errorf("error listing revisions: %w", err)
+		}
+		if len(revisions) == 0 {
+			fmt.Printf("No revisions recorded for secret %s\n", secretName)
+			return nil
+		}
+
+		fmt.Printf("Revisions of secret %s in namespace %s:\n", secretName, namespace)
+		for _, revision := range revisions {
+			fmt.Printf("- %d (created %s, resourceVersion %s)\n",
+				revision.Revision, revision.CreatedAt.Format(time.RFC3339), revision.ResourceVersion)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().StringVar(&secretName, "name", "", "secret name")
+	historyCmd.MarkFlagRequired("name")
+}
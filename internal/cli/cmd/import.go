@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importFile     string
+	importFormat   string
+	importConflict string
+	importType     string
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import secrets from a file",
+	Long: `Import creates the secrets read from an env, json, yaml, manifest or
+secretdata file, decrypting files made by the encrypt command. Existing
+secrets are skipped, overwritten or fail the import before anything is
+written, depending on --conflict. Manifests keep their namespace unless
+--namespace is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := secretio.ParseFormat(importFormat)
+		if err != nil {
+			return err
+		}
+		conflict, err := secretio.ParseConflictPolicy(importConflict)
+		if err != nil {
+			return err
+		}
+		identities, err := decryptIdentities()
+		if err != nil {
+			return err
+		}
+		client, err := newWriteClient()
+		if err != nil {
+			return err
+		}
+
+		var in io.Reader = os.Stdin
+		if importFile != "-" {
+			f, err := os.Open(importFile)
+			if err != nil {
+				return fmt.Errorf("error opening %s: %w", importFile, err)
+			}
+			defer f.Close()
+			in = f
+		}
+
+		result, err := secretio.Import(context.Background(), client, in, secretio.ImportOptions{
+			Namespace:         namespace,
+			OverrideNamespace: cmd.Flags().Changed("namespace"),
+			Name:              secretName,
+			Type:              importType,
+			Format:            format,
+			Conflict:          conflict,
+			Identities:        identities,
+		})
+		if result != nil {
+			for _, ref := range result.Created {
+				fmt.Printf("- %s created\n", ref)
+			}
+			for _, ref := range result.Updated {
+				fmt.Printf("- %s updated\n", ref)
+			}
+			for _, ref := range result.Skipped {
+				fmt.Printf("- %s skipped, it already exists\n", ref)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("error importing secrets: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringVar(&importFile, "file", "-", "file to read, - for stdin")
+	importCmd.Flags().StringVarP(&importFormat, "format", "f", string(secretio.FormatManifest), "env, json, yaml, manifest or secretdata")
+	importCmd.Flags().StringVar(&importConflict, "conflict", string(secretio.ConflictSkip), "what to do with existing secrets: skip, overwrite or fail")
+	importCmd.Flags().StringVar(&secretName, "name", "", "secret name for env input, or to read json/yaml as a single secret")
+	importCmd.Flags().StringVar(&importType, "type", "", "type of secrets read from env, json or yaml (default Opaque)")
+	addDecryptFlags(importCmd)
+}
@@ -8,29 +8,61 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	listSelector      string
+	listFieldSelector string
+	listAllNamespaces bool
+	listChunkSize     int64
+)
+
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List secrets in a namespace",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := k8s.NewClient(kubeconfig)
+		client, err := newClient()
 		if err != nil {
-			return fmt.Errorf("error creating k8s client: %w", err)
+			return err
 		}
 
-		secrets, err := client.ListSecrets(context.Background(), namespace)
-		if err != nil {
-			return fmt.Errorf("error listing secrets: %w", err)
+		ns := namespace
+		if listAllNamespaces {
+			ns = ""
+			fmt.Println("Secrets in all namespaces:")
+		} else {
+			fmt.Printf("Secrets in namespace %s:\n", namespace)
 		}
 
-		fmt.Printf("Secrets in namespace %s:\n", namespace)
-		for _, secret := range secrets {
-			fmt.Printf("- %s (Type: %s)\n", secret.Name, secret.Type)
+		opts := k8s.ListOptions{
+			LabelSelector: listSelector,
+			FieldSelector: listFieldSelector,
+			Limit:         listChunkSize,
 		}
+		for {
+			secrets, err := client.ListSecrets(context.Background(), ns, opts)
+			if err != nil {
+				return fmt.Errorf("error listing secrets: %w", err)
+			}
 
-		return nil
+			for _, secret := range secrets.Items {
+				if listAllNamespaces {
+					fmt.Printf("- %s/%s (Type: %s)\n", secret.Namespace, secret.Name, secret.Type)
+				} else {
+					fmt.Printf("- %s (Type: %s)\n", secret.Name, secret.Type)
+				}
+			}
+
+			if secrets.Continue == "" {
+				return nil
+			}
+			opts.Continue = secrets.Continue
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().StringVarP(&listSelector, "selector", "l", "", "label selector (e.g. app=api,env!=dev)")
+	listCmd.Flags().StringVar(&listFieldSelector, "field-selector", "", "field selector (e.g. type=kubernetes.io/tls)")
+	listCmd.Flags().BoolVarP(&listAllNamespaces, "all-namespaces", "A", false, "list secrets across all namespaces")
+	listCmd.Flags().Int64Var(&listChunkSize, "chunk-size", 500, "number of secrets fetched per request, 0 to disable paging")
 }
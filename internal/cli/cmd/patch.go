@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/validator"
+	"github.com/spf13/cobra"
+)
+
+var (
+	patchSet              []string
+	patchUnset            []string
+	patchRename           []string
+	patchLabels           []string
+	patchUnsetLabels      []string
+	patchAnnotations      []string
+	patchUnsetAnnotations []string
+)
+
+var patchCmd = &cobra.Command{
+	Use:   "patch",
+	Short: "Change individual keys, labels or annotations of a secret",
+	Example: `  k8s-secrets-manager patch --name db --set password=s3cr3t --unset legacy-password
+  k8s-secrets-manager patch --name db --rename user=username --label team=payments`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		patch := &k8s.SecretPatch{
+			Unset:            patchUnset,
+			UnsetLabels:      patchUnsetLabels,
+			UnsetAnnotations: patchUnsetAnnotations,
+		}
+
+		var err error
+		if patch.Set, err = parsePairs(patchSet, "--set"); err != nil {
+			return err
+		}
+		if patch.Rename, err = parsePairs(patchRename, "--rename"); err != nil {
+			return err
+		}
+		if patch.SetLabels, err = parsePairs(patchLabels, "--label"); err != nil {
+			return err
+		}
+		if patch.SetAnnotations, err = parsePairs(patchAnnotations, "--annotation"); err != nil {
+			return err
+		}
+
+		if err := validator.ValidateSecretPatch(patch); err != nil {
+			return err
+		}
+
+		client, err := newWriteClient()
+		if err != nil {
+			return err
+		}
+
+		if _, err := client.PatchSecret(context.Background(), namespace, secretName, patch); err != nil {
+			return fmt.Errorf("error patching secret: %w", err)
+		}
+
+		fmt.Printf("Secret %s successfully patched in namespace %s\n", secretName, namespace)
+		return nil
+	},
+}
+
+// parsePairs parses repeated key=value flag values. Unlike --data the value
+// is taken verbatim, so it may contain commas or further '=' signs.
+func parsePairs(pairs []string, flag string) (map[string]string, error) {
+	result := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid %s value %q, expected key=value", flag, pair)
+		}
+		result[kv[0]] = kv[1]
+	}
+	return result, nil
+}
+
+func init() {
+	rootCmd.AddCommand(patchCmd)
+	patchCmd.Flags().StringVar(&secretName, "name", "", "secret name")
+	patchCmd.Flags().StringArrayVar(&patchSet, "set", nil, "set a key (format: key=value, repeatable)")
+	patchCmd.Flags().StringArrayVar(&patchUnset, "unset", nil, "remove a key (repeatable)")
+	patchCmd.Flags().StringArrayVar(&patchRename, "rename", nil, "rename a key (format: old=new, repeatable)")
+	patchCmd.Flags().StringArrayVar(&patchLabels, "label", nil, "set a label (format: key=value, repeatable)")
+	patchCmd.Flags().StringArrayVar(&patchUnsetLabels, "unset-label", nil, "remove a label (repeatable)")
+	patchCmd.Flags().StringArrayVar(&patchAnnotations, "annotation", nil, "set an annotation (format: key=value, repeatable)")
+	patchCmd.Flags().StringArrayVar(&patchUnsetAnnotations, "unset-annotation", nil, "remove an annotation (repeatable)")
+	patchCmd.MarkFlagRequired("name")
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/backup"
+	"github.com/mpalu/k8s-secrets-manager/internal/crypto"
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
+	"github.com/spf13/cobra"
+)
+
+var (
+	restoreFile         string
+	restoreIdentityFile string
+	restoreNamespaces   []string
+	restoreNamespaceMap string
+	restoreConflict     string
+	restoreDryRun       bool
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore secrets from an encrypted archive",
+	Long: `Restore verifies the whole archive against its manifest before writing
+anything. It is decrypted with the age keys of --identity-file or the
+passphrase read from --passphrase-file or $` + backupPassphraseEnv + `.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		passphrase, err := readPassphrase(backupPassphraseFile, backupPassphraseEnv)
+		if err != nil {
+			return err
+		}
+		var keys io.Reader
+		if restoreIdentityFile != "" {
+			f, err := os.Open(restoreIdentityFile)
+			if err != nil {
+				return fmt.Errorf("error opening identity file: %w", err)
+			}
+			defer f.Close()
+			keys = f
+		}
+		identities, err := crypto.Identities(passphrase, keys)
+		if err != nil {
+			return err
+		}
+		conflict, err := secretio.ParseConflictPolicy(restoreConflict)
+		if err != nil {
+			return err
+		}
+		namespaceMap, err := backup.ParseNamespaceMap(restoreNamespaceMap)
+		if err != nil {
+			return err
+		}
+		client, err := newWriteClient()
+		if err != nil {
+			return err
+		}
+
+		archive, err := os.Open(restoreFile)
+		if err != nil {
+			return fmt.Errorf("error opening %s: %w", restoreFile, err)
+		}
+		defer archive.Close()
+
+		result, err := backup.Restore(context.Background(), client, archive, identities, backup.RestoreOptions{
+			Namespaces:   restoreNamespaces,
+			NamespaceMap: namespaceMap,
+			Conflict:     conflict,
+			DryRun:       restoreDryRun,
+		})
+		if result != nil {
+			verb := ""
+			if restoreDryRun {
+				verb = "would be "
+			}
+			for _, ref := range result.Created {
+				fmt.Printf("- %s %screated\n", ref, verb)
+			}
+			for _, ref := range result.Updated {
+				fmt.Printf("- %s %supdated\n", ref, verb)
+			}
+			for _, ref := range result.Skipped {
+				fmt.Printf("- %s skipped, it already exists\n", ref)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("error restoring backup: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().StringVar(&restoreFile, "file", "", "archive to restore")
+	restoreCmd.Flags().StringVar(&restoreIdentityFile, "identity-file", "", "file of age secret keys")
+	restoreCmd.Flags().StringVar(&backupPassphraseFile, "passphrase-file", "", "file holding the passphrase")
+	restoreCmd.Flags().StringSliceVar(&restoreNamespaces, "namespaces", nil, "restore only these namespaces of the archive")
+	restoreCmd.Flags().StringVar(&restoreNamespaceMap, "namespace-map", "", "rename namespaces (format: from=to,...)")
+	restoreCmd.Flags().StringVar(&restoreConflict, "conflict", string(secretio.ConflictSkip), "what to do with existing secrets: skip, overwrite or fail")
+	restoreCmd.Flags().BoolVar(&restoreDryRun, "dry-run", false, "verify the archive and report what would be restored")
+	restoreCmd.MarkFlagRequired("file")
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"k8s.io/client-go/util/retry"
+)
+
+// updateWithRetry runs a read-modify-write cycle on a secret. mutate receives
+// the current state, and the write is conditional on that version; when the
+// secret changed in between, the whole cycle is retried with backoff.
+func updateWithRetry(ctx context.Context, client k8s.SecretManager, namespace, name string, mutate func(*k8s.SecretData) error) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := client.GetSecret(ctx, namespace, name)
+		if err != nil {
+			return err
+		}
+
+		data := k8s.NewSecretData(secret)
+		if err := mutate(data); err != nil {
+			return err
+		}
+		return client.UpdateSecret(ctx, data)
+	})
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var rollbackRevision int64
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Restore a secret from one of its revisions",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newWriteClient()
+		if err != nil {
+			return err
+		}
+
+		if _, err := client.Rollback(context.Background(), namespace, secretName, rollbackRevision); err != nil {
+			return fmt.Errorf("error rolling back secret: %w", err)
+		}
+
+		fmt.Printf("Secret %s rolled back to revision %d in namespace %s\n", secretName, rollbackRevision, namespace)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+	rollbackCmd.Flags().StringVar(&secretName, "name", "", "secret name")
+	rollbackCmd.Flags().Int64Var(&rollbackRevision, "to-revision", 0, "revision to restore")
+	rollbackCmd.MarkFlagRequired("name")
+	rollbackCmd.MarkFlagRequired("to-revision")
+}
@@ -1,14 +1,28 @@
 package cmd
 
 import (
+	"fmt"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/backend"
 	"github.com/mpalu/k8s-secrets-manager/internal/config"
+	"github.com/mpalu/k8s-secrets-manager/internal/crypto"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/policy"
 	"github.com/spf13/cobra"
 )
 
 var (
-	cfgFile    string
-	kubeconfig string
-	namespace  string
+	cfgFile     string
+	backendType string
+	kubeconfig  string
+	kubeContext string
+	kubeCluster string
+	kubeUser    string
+	inCluster   bool
+	clusterName string
+	namespace   string
+
+	cfg *config.Config
 )
 
 var rootCmd = &cobra.Command{
@@ -16,8 +30,9 @@ var rootCmd = &cobra.Command{
 	Short: "Kubernetes Secret Manager - Manage Kubernetes Secrets",
 }
 
-func Execute(cfg *config.Config) error {
+func Execute(c *config.Config) error {
 	// Store config in package-level variable
+	cfg = c
 	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
 		cmd.Root().SetContext(cmd.Context())
 	}
@@ -28,12 +43,233 @@ func init() {
 	cobra.OnInitialize(initConfig)
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file path")
+	rootCmd.PersistentFlags().StringVar(&backendType, "backend", "", "storage backend: kubernetes, memory or file (default from config)")
 	rootCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", "", "kubeconfig file path")
+	rootCmd.PersistentFlags().StringVar(&kubeContext, "context", "", "kubeconfig context to use")
+	rootCmd.PersistentFlags().StringVar(&clusterName, "cluster", "", "name of the cluster from the config registry")
+	rootCmd.PersistentFlags().StringVar(&kubeCluster, "kube-cluster", "", "kubeconfig cluster to use")
+	rootCmd.PersistentFlags().StringVar(&kubeUser, "user", "", "kubeconfig user to use")
+	rootCmd.PersistentFlags().BoolVar(&inCluster, "in-cluster", false, "use the in-cluster ServiceAccount credentials")
 	rootCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "default", "kubernetes namespace")
 }
 
 func initConfig() {
 	if cfgFile != "" {
 		config.SetConfigFile(cfgFile)
+		loaded, err := config.Load()
+		if err != nil {
+			cobra.CheckErr(err)
+		}
+		cfg = loaded
+	}
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	if backendType != "" {
+		cfg.Backend.Type = backendType
+	}
+	cobra.CheckErr(cfg.Validate())
+}
+
+func configOptions(kc config.KubernetesConfig) k8s.ClientOptions {
+	return k8s.ClientOptions{
+		InCluster:  kc.InCluster,
+		Kubeconfig: kc.Kubeconfig,
+		Context:    kc.Context,
+		Cluster:    kc.Cluster,
+		User:       kc.User,
+		QPS:        kc.QPS,
+		Burst:      kc.Burst,
+		Timeout:    kc.Timeout,
+	}
+}
+
+// clientOptions merges a kubernetes config section with the command line
+// flags, flags taking precedence
+func clientOptions(kc config.KubernetesConfig) k8s.ClientOptions {
+	opts := configOptions(kc)
+	opts.InCluster = opts.InCluster || inCluster
+	if kubeconfig != "" {
+		opts.Kubeconfig = kubeconfig
+	}
+	if kubeContext != "" {
+		opts.Context = kubeContext
+	}
+	if kubeCluster != "" {
+		opts.Cluster = kubeCluster
+	}
+	if kubeUser != "" {
+		opts.User = kubeUser
+	}
+	return opts
+}
+
+// clusterConfig resolves the kubernetes settings of a registry entry, falling
+// back to the global kubernetes section for unset connection limits
+func clusterConfig(cc config.ClusterConfig) config.KubernetesConfig {
+	kc := cc.KubernetesConfig
+	if kc.QPS == 0 {
+		kc.QPS = cfg.Kubernetes.QPS
+	}
+	if kc.Burst == 0 {
+		kc.Burst = cfg.Kubernetes.Burst
+	}
+	if kc.Timeout == 0 {
+		kc.Timeout = cfg.Kubernetes.Timeout
+	}
+	return kc
+}
+
+// newClient returns the storage backend. For the kubernetes backend it
+// connects to the cluster selected with --cluster, or to the default cluster
+// of the registry.
+func newClient() (k8s.SecretManager, error) {
+	kc := cfg.Kubernetes
+	if len(cfg.Clusters) > 0 {
+		name := clusterName
+		if name == "" {
+			name = cfg.DefaultCluster
+		}
+		found := false
+		for _, cc := range cfg.Clusters {
+			if name == "" || cc.Name == name {
+				kc, found = clusterConfig(cc), true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("cluster %s is not defined in the config", name)
+		}
+	} else if clusterName != "" && clusterName != k8s.DefaultClusterName {
+		return nil, fmt.Errorf("cluster %s is not defined in the config", clusterName)
+	}
+
+	return newBackend(clientOptions(kc))
+}
+
+// newWriteClient is newClient enforcing the configured policy on writes
+func newWriteClient() (k8s.SecretManager, error) {
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	return enforcePolicy(client)
+}
+
+// enforcePolicy wraps client so that its writes follow the configured
+// policy, if any
+func enforcePolicy(client k8s.SecretManager) (k8s.SecretManager, error) {
+	p, err := loadPolicy()
+	if err != nil || p == nil {
+		return client, err
+	}
+	return policy.Enforce(client, p), nil
+}
+
+// loadPolicy reads the policy file of the config, nil when there is none
+func loadPolicy() (*policy.Policy, error) {
+	if cfg.Policy.File == "" {
+		return nil, nil
+	}
+	return policy.Load(cfg.Policy.File)
+}
+
+// newRegistry connects to every configured cluster. Without a clusters
+// section a single default cluster is built from the kubernetes settings,
+// or from the backend when it is not kubernetes.
+func newRegistry() (*k8s.Registry, error) {
+	registry := k8s.NewRegistry()
+
+	if len(cfg.Clusters) == 0 {
+		manager, err := newBackend(clientOptions(cfg.Kubernetes))
+		if err != nil {
+			return nil, err
+		}
+		if err := registry.Register(k8s.DefaultClusterName, manager); err != nil {
+			return nil, err
+		}
+		return registry, nil
+	}
+
+	// Connection flags only make sense for a single cluster, so registry
+	// entries are built from the config file alone
+	for _, cc := range cfg.Clusters {
+		client, err := k8s.NewClientWithOptions(configOptions(clusterConfig(cc)))
+		if err != nil {
+			return nil, fmt.Errorf("error creating k8s client for cluster %s: %w", cc.Name, err)
+		}
+		if err := enableHistory(client); err != nil {
+			return nil, err
+		}
+		if err := registry.Register(cc.Name, client); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.DefaultCluster != "" {
+		if err := registry.SetDefault(cfg.DefaultCluster); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// newBackend builds the SecretManager of the configured backend, connecting
+// with opts when it is kubernetes
+func newBackend(opts k8s.ClientOptions) (k8s.SecretManager, error) {
+	var manager k8s.SecretManager
+	switch cfg.Backend.Type {
+	case config.BackendMemory:
+		manager = backend.NewMemory()
+	case config.BackendFile:
+		key, err := readKey(cfg.Backend.Key, cfg.Backend.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading backend key: %w", err)
+		}
+		store, err := backend.OpenFile(cfg.Backend.Path, key)
+		if err != nil {
+			return nil, err
+		}
+		manager = store
+	default:
+		client, err := k8s.NewClientWithOptions(opts)
+		if err != nil {
+			return nil, fmt.Errorf("error creating k8s client: %w", err)
+		}
+		manager = client
+	}
+
+	if err := enableHistory(manager); err != nil {
+		return nil, err
+	}
+	return manager, nil
+}
+
+// enableHistory turns on the revision history of manager when the config
+// asks for it. Local backends keep revisions with the secrets and need no
+// key of their own.
+func enableHistory(manager k8s.SecretManager) error {
+	if !cfg.History.Enabled {
+		return nil
+	}
+
+	switch m := manager.(type) {
+	case *backend.Memory:
+		return m.EnableHistory(cfg.History.Limit)
+	case *k8s.Client:
+		key, err := readKey(cfg.History.Key, cfg.History.KeyFile)
+		if err != nil {
+			return fmt.Errorf("error reading history key: %w", err)
+		}
+		return m.EnableHistory(k8s.HistoryOptions{Key: key, Limit: cfg.History.Limit})
+	}
+	return nil
+}
+
+// readKey decodes a base64 encoded AES key given inline or as a file
+func readKey(key, keyFile string) ([]byte, error) {
+	if keyFile != "" {
+		return crypto.ReadKeyFile(keyFile)
 	}
+	return crypto.ParseKey(key)
 }
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/rotation"
+	"github.com/spf13/cobra"
+)
+
+// eventComponent is the source reported on emitted Kubernetes Events
+const eventComponent = "k8s-secrets-manager"
+
+var rotateAllNamespaces bool
+
+var rotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Rotate the secrets whose rotation is due, or one secret with --name",
+	Long: `Rotate regenerates the values of secrets annotated with
+secrets-manager.io/rotate-every (e.g. "30d"). The generator is chosen with
+secrets-manager.io/rotation-generator and configured with
+secrets-manager.io/rotation-params (e.g. "length=32,key=password").`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		var opts rotation.Options
+		if c, ok := client.(*k8s.Client); ok {
+			recorder, stop := c.EventRecorder(eventComponent)
+			defer stop()
+			opts.Recorder = recorder
+		}
+		client, err = enforcePolicy(client)
+		if err != nil {
+			return err
+		}
+		rotator := rotation.NewRotator(client, opts)
+
+		if secretName != "" {
+			if err := rotator.Rotate(context.Background(), namespace, secretName); err != nil {
+				return fmt.Errorf("error rotating secret: %w", err)
+			}
+			fmt.Printf("Secret %s rotated in namespace %s\n", secretName, namespace)
+			return nil
+		}
+
+		ns := namespace
+		if rotateAllNamespaces {
+			ns = ""
+		}
+		rotated, err := rotator.RotateDue(context.Background(), ns)
+		for _, name := range rotated {
+			fmt.Printf("- %s rotated\n", name)
+		}
+		if err != nil {
+			return fmt.Errorf("error rotating secrets: %w", err)
+		}
+		if len(rotated) == 0 {
+			fmt.Println("No secret is due for rotation")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rotateCmd)
+	rotateCmd.Flags().StringVar(&secretName, "name", "", "rotate this secret now, whether or not it is due")
+	rotateCmd.Flags().BoolVarP(&rotateAllNamespaces, "all-namespaces", "A", false, "rotate due secrets across all namespaces")
+}
@@ -1,27 +1,176 @@
 package cmd
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
+	"time"
 
+	"github.com/mpalu/k8s-secrets-manager/internal/api/handlers"
 	"github.com/mpalu/k8s-secrets-manager/internal/api/server"
+	"github.com/mpalu/k8s-secrets-manager/internal/api/server/middleware"
+	"github.com/mpalu/k8s-secrets-manager/internal/apply"
+	"github.com/mpalu/k8s-secrets-manager/internal/config"
 	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/logging"
+	"github.com/mpalu/k8s-secrets-manager/internal/policy"
+	"github.com/mpalu/k8s-secrets-manager/internal/replication"
+	"github.com/mpalu/k8s-secrets-manager/internal/rotation"
+	"github.com/mpalu/k8s-secrets-manager/internal/secretio"
 	"github.com/spf13/cobra"
 )
 
 var (
-	port string
+	port        string
+	enableCache bool
+	allowReveal bool
+	rotate      bool
+	replicate   bool
+	serveApply  string
+	syncExt     bool
 )
 
 var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Start HTTP server",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := k8s.NewClient(kubeconfig)
+		clusters, err := newRegistry()
 		if err != nil {
-			return fmt.Errorf("error creating k8s client: %w", err)
+			return err
 		}
 
-		srv := server.New(client)
+		// Controllers write with the policy enforced, like API requests
+		secretPolicy, err := loadPolicy()
+		if err != nil {
+			return err
+		}
+
+		if enableCache || cfg.Cache.Enabled {
+			for _, name := range clusters.Names() {
+				client, _ := clusters.Get(name)
+				if c, ok := client.(*k8s.Client); ok {
+					c.EnableCache(cmd.Context(), k8s.CacheOptions{
+						Namespace:    cfg.Cache.Namespace,
+						ResyncPeriod: cfg.Cache.ResyncPeriod,
+					})
+				}
+			}
+		}
+
+		if rotate || cfg.Rotation.Enabled {
+			interval := cfg.Rotation.Interval
+			if interval <= 0 {
+				interval = time.Minute
+			}
+			for _, name := range clusters.Names() {
+				client, _ := clusters.Get(name)
+				rotatorOpts := rotation.Options{Logger: logging.GetLogger()}
+				if c, ok := client.(*k8s.Client); ok {
+					recorder, stop := c.EventRecorder(eventComponent)
+					defer stop()
+					rotatorOpts.Recorder = recorder
+				}
+				if secretPolicy != nil {
+					client = policy.Enforce(client, secretPolicy)
+				}
+				go rotation.NewRotator(client, rotatorOpts).Run(cmd.Context(), cfg.Rotation.Namespace, interval)
+			}
+		}
+
+		if replicate || cfg.Replication.Enabled {
+			interval := cfg.Replication.Interval
+			if interval <= 0 {
+				interval = 30 * time.Second
+			}
+			for _, name := range clusters.Names() {
+				client, _ := clusters.Get(name)
+				cluster, ok := client.(replication.Cluster)
+				if !ok {
+					continue
+				}
+				if secretPolicy != nil {
+					cluster = enforcedCluster{policy.Enforce(cluster, secretPolicy), cluster}
+				}
+				go replication.NewController(cluster, logging.GetLogger()).Run(cmd.Context(), interval)
+			}
+		}
+
+		identities, err := decryptIdentities()
+		if err != nil {
+			return err
+		}
+
+		if serveApply != "" || cfg.Apply.Enabled {
+			dir := cfg.Apply.Dir
+			if serveApply != "" {
+				dir = serveApply
+			}
+			interval := cfg.Apply.Interval
+			if interval <= 0 {
+				interval = time.Minute
+			}
+			client, err := clusters.Get(cfg.Apply.Cluster)
+			if err != nil {
+				return err
+			}
+			if secretPolicy != nil {
+				client = policy.Enforce(client, secretPolicy)
+			}
+			load := secretio.ImportOptions{Namespace: cfg.Apply.Namespace, Identities: identities}
+			reconciler := apply.NewReconciler(client, dir, load, apply.Options{
+				Source: cfg.Apply.Source,
+				Prune:  cfg.Apply.Prune,
+			}, logging.GetLogger())
+			go reconciler.Run(cmd.Context(), interval)
+		}
+
+		opts := []handlers.Option{
+			handlers.WithAuditLogger(logging.GetLogger()),
+			handlers.WithDecryptIdentities(identities),
+		}
+
+		if syncExt || cfg.External.Enabled {
+			interval := cfg.External.Interval
+			if interval <= 0 {
+				interval = time.Minute
+			}
+			client, err := clusters.Get(cfg.External.Cluster)
+			if err != nil {
+				return err
+			}
+			if secretPolicy != nil {
+				client = policy.Enforce(client, secretPolicy)
+			}
+			syncer, err := newExternalSyncer(client)
+			if err != nil {
+				return err
+			}
+			go syncer.Run(cmd.Context(), interval)
+			opts = append(opts, handlers.WithExternalStatus(syncer))
+		}
+		if secretPolicy != nil {
+			opts = append(opts, handlers.WithPolicy(secretPolicy))
+		}
+		if allowReveal || cfg.Server.AllowReveal {
+			opts = append(opts, handlers.WithRevealAuthorizer(handlers.AllowReveal))
+		}
+		switch cfg.Server.Auth.Authorization {
+		case config.AuthorizationAccessReview:
+			opts = append(opts, handlers.WithAuthorizer(handlers.AccessReview))
+		case config.AuthorizationImpersonate:
+			opts = append(opts, handlers.WithAuthorizer(handlers.Impersonate))
+		}
+
+		serverConfig, err := newServerConfig(clusters)
+		if err != nil {
+			return err
+		}
+		if !serverConfig.API.EnableAuth {
+			logging.GetLogger().Warn().Msg("authentication is disabled, anyone reaching the server can manage secrets")
+		}
+
+		srv := server.New(clusters, serverConfig, opts...)
 		return srv.Run(":" + port)
 	},
 }
@@ -29,4 +178,74 @@ var serverCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(serverCmd)
 	serverCmd.Flags().StringVarP(&port, "port", "p", "8080", "HTTP server port")
+	serverCmd.Flags().BoolVar(&enableCache, "cache", false, "serve reads from an informer cache")
+	serverCmd.Flags().BoolVar(&rotate, "rotate", false, "rotate annotated secrets when they are due")
+	serverCmd.Flags().BoolVar(&replicate, "replicate", false, "keep replicas of annotated secrets in sync")
+	serverCmd.Flags().StringVar(&serveApply, "apply-dir", "", "keep the secrets defined in this directory applied")
+	serverCmd.Flags().BoolVar(&syncExt, "sync-external", false, "sync secrets from the external KV store")
+	serverCmd.Flags().BoolVar(&allowReveal, "allow-reveal", false, "allow API clients to read secret values")
+}
+
+// enforcedCluster is a replication cluster whose writes are checked by a
+// policy enforcer; namespaces are still listed by the cluster itself
+type enforcedCluster struct {
+	k8s.SecretManager
+	k8s.NamespaceLister
+}
+
+// newServerConfig sets up TLS and the authenticators of the server section.
+// TokenReview goes to the default cluster.
+func newServerConfig(clusters *k8s.Registry) (server.Config, error) {
+	var serverConfig server.Config
+	tc := cfg.Server.TLS
+
+	if tc.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+		if err != nil {
+			return serverConfig, fmt.Errorf("error loading server certificate: %w", err)
+		}
+		serverConfig.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+		if tc.ClientCAFile != "" {
+			pem, err := os.ReadFile(tc.ClientCAFile)
+			if err != nil {
+				return serverConfig, fmt.Errorf("error reading client CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return serverConfig, fmt.Errorf("no certificates found in %s", tc.ClientCAFile)
+			}
+			serverConfig.TLS.ClientCAs = pool
+			serverConfig.TLS.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	ac := cfg.Server.Auth
+	serverConfig.API.EnableAuth = ac.Enabled
+	if !ac.Enabled {
+		return serverConfig, nil
+	}
+	if tc.ClientCAFile != "" {
+		serverConfig.Authenticators = append(serverConfig.Authenticators, middleware.CertificateAuthenticator{})
+	}
+	if ac.TokenFile != "" {
+		tokens, err := middleware.NewTokenAuthenticator(ac.TokenFile)
+		if err != nil {
+			return serverConfig, err
+		}
+		serverConfig.Authenticators = append(serverConfig.Authenticators, tokens)
+	}
+	if ac.TokenReview {
+		client, err := clusters.Get("")
+		if err != nil {
+			return serverConfig, err
+		}
+		reviewer, ok := client.(k8s.TokenReviewer)
+		if !ok {
+			return serverConfig, fmt.Errorf("token review requires the kubernetes backend")
+		}
+		serverConfig.Authenticators = append(serverConfig.Authenticators,
+			middleware.NewTokenReviewAuthenticator(reviewer, ac.Audiences, ac.CacheTTL))
+	}
+	return serverConfig, nil
 }
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/dotenv"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	fromLiterals []string
+	fromFiles    []string
+	fromEnvFiles []string
+)
+
+// addSourceFlags registers the kubectl style data source flags
+func addSourceFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&fromLiterals, "from-literal", nil, "key and literal value (format: key=value, repeatable)")
+	cmd.Flags().StringArrayVar(&fromFiles, "from-file", nil, "file or directory to read values from (format: [key=]path, repeatable)")
+	cmd.Flags().StringArrayVar(&fromEnvFiles, "from-env-file", nil, "file of KEY=VALUE lines (repeatable)")
+}
+
+// secretSources holds values read from the command line. Values that are
+// valid UTF-8 go into data, anything else into binaryData.
+type secretSources struct {
+	data       map[string]string
+	binaryData map[string][]byte
+}
+
+// readSources collects the values given through --data and the --from-*
+// flags. A key given twice is an error.
+func readSources() (*secretSources, error) {
+	sources := &secretSources{
+		data:       make(map[string]string),
+		binaryData: make(map[string][]byte),
+	}
+
+	if secretData != "" {
+		data, err := parseKeyValues(secretData)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range data {
+			if err := sources.add(key, []byte(value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, literal := range fromLiterals {
+		key, value, ok := strings.Cut(literal, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --from-literal value %q, expected key=value", literal)
+		}
+		if err := sources.add(key, []byte(value)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, source := range fromFiles {
+		if err := sources.addFile(source); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range fromEnvFiles {
+		env, err := dotenv.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range env {
+			if err := sources.add(key, []byte(value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return sources, nil
+}
+
+func (s *secretSources) add(key string, value []byte) error {
+	_, inData := s.data[key]
+	_, inBinary := s.binaryData[key]
+	if inData || inBinary {
+		return fmt.Errorf("cannot add key %s, another key by that name already exists", key)
+	}
+
+	if utf8.Valid(value) {
+		s.data[key] = string(value)
+	} else {
+		s.binaryData[key] = value
+	}
+	return nil
+}
+
+// addFile reads a --from-file source. A directory contributes each regular
+// file whose name is a valid key.
+func (s *secretSources) addFile(source string) error {
+	key, path, hasKey := strings.Cut(source, "=")
+	if !hasKey {
+		path = source
+		key = filepath.Base(source)
+	}
+	if key == "" || path == "" {
+		return fmt.Errorf("invalid --from-file value %q, expected [key=]path", source)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	if !info.IsDir() {
+		value, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", path, err)
+		}
+		return s.add(key, value)
+	}
+
+	if hasKey {
+		return fmt.Errorf("cannot give a key for directory %s", path)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || len(validation.IsConfigMapKey(entry.Name())) > 0 {
+			continue
+		}
+		value, err := os.ReadFile(filepath.Join(path, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", entry.Name(), err)
+		}
+		if err := s.add(entry.Name(), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/validator"
+	"github.com/spf13/cobra"
+)
+
+var replaceData bool
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update the data of an existing secret",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newWriteClient()
+		if err != nil {
+			return err
+		}
+
+		sources, err := readSources()
+		if err != nil {
+			return err
+		}
+		if replaceData && len(sources.data)+len(sources.binaryData) == 0 {
+			return fmt.Errorf("--replace requires --data or a --from-* source")
+		}
+
+		labels, err := parsePairs(secretLabels, "--label")
+		if err != nil {
+			return err
+		}
+		annotations, err := parsePairs(secretAnnotations, "--annotation")
+		if err != nil {
+			return err
+		}
+
+		err = updateWithRetry(context.Background(), client, namespace, secretName, func(secret *k8s.SecretData) error {
+			if replaceData {
+				secret.Data = sources.data
+				secret.BinaryData = sources.binaryData
+			} else {
+				if secret.BinaryData == nil {
+					secret.BinaryData = make(map[string][]byte)
+				}
+				for key, value := range sources.data {
+					secret.Data[key] = value
+					delete(secret.BinaryData, key)
+				}
+				for key, value := range sources.binaryData {
+					secret.BinaryData[key] = value
+					delete(secret.Data, key)
+				}
+			}
+
+			secret.Labels = mergeMaps(secret.Labels, labels)
+			secret.Annotations = mergeMaps(secret.Annotations, annotations)
+			secret.Immutable = secret.Immutable || secretImmutable
+
+			return validator.ValidateSecretMetadata(secret)
+		})
+		if err != nil {
+			return fmt.Errorf("error updating secret: %w", err)
+		}
+
+		fmt.Printf("Secret %s successfully updated in namespace %s\n", secretName, namespace)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(updateCmd)
+	updateCmd.Flags().StringVar(&secretName, "name", "", "secret name")
+	updateCmd.Flags().StringVar(&secretData, "data", "", "secret data (format: key1=value1,key2=value2)")
+	addSourceFlags(updateCmd)
+	updateCmd.Flags().BoolVar(&replaceData, "replace", false, "replace all keys instead of merging into the existing data")
+	updateCmd.Flags().StringArrayVar(&secretLabels, "label", nil, "add or change a label (format: key=value, repeatable)")
+	updateCmd.Flags().StringArrayVar(&secretAnnotations, "annotation", nil, "add or change an annotation (format: key=value, repeatable)")
+	updateCmd.Flags().BoolVar(&secretImmutable, "immutable", false, "mark the secret immutable")
+	updateCmd.MarkFlagRequired("name")
+}
+
+func mergeMaps(base, overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return base
+	}
+	if base == nil {
+		base = make(map[string]string, len(overrides))
+	}
+	for key, value := range overrides {
+		base[key] = value
+	}
+	return base
+}
@@ -2,24 +2,328 @@ package config
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	KubeConfig string       `mapstructure:"kubeconfig"`
-	Server     ServerConfig `mapstructure:"server"`
+	// KubeConfig is read into Kubernetes.Kubeconfig by Load.
+	//
+	// Deprecated: use Kubernetes.Kubeconfig (kubernetes.kubeconfig).
+	KubeConfig     string            `mapstructure:"kubeconfig"`
+	Backend        BackendConfig     `mapstructure:"backend"`
+	Kubernetes     KubernetesConfig  `mapstructure:"kubernetes"`
+	Clusters       []ClusterConfig   `mapstructure:"clusters"`
+	DefaultCluster string            `mapstructure:"defaultCluster"`
+	Server         ServerConfig      `mapstructure:"server"`
+	Cache          CacheConfig       `mapstructure:"cache"`
+	History        HistoryConfig     `mapstructure:"history"`
+	Rotation       RotationConfig    `mapstructure:"rotation"`
+	Replication    ReplicationConfig `mapstructure:"replication"`
+	Apply          ApplyConfig       `mapstructure:"apply"`
+	Decryption     DecryptionConfig  `mapstructure:"decryption"`
+	External       ExternalConfig    `mapstructure:"external"`
+	Policy         PolicyConfig      `mapstructure:"policy"`
+}
+
+// Storage backends selectable in BackendConfig
+const (
+	BackendKubernetes = "kubernetes"
+	BackendMemory     = "memory"
+	BackendFile       = "file"
+)
+
+// BackendConfig selects where secrets are stored. The memory backend keeps
+// them until the process exits. The file backend keeps them in a local file
+// sealed with a base64 encoded 32 byte AES key, given inline or as a file.
+type BackendConfig struct {
+	Type    string `mapstructure:"type"`
+	Path    string `mapstructure:"path"`
+	Key     string `mapstructure:"key"`
+	KeyFile string `mapstructure:"keyFile"`
 }
 
 type ServerConfig struct {
 	Port string `mapstructure:"port"`
 	Host string `mapstructure:"host"`
+	// AllowReveal enables ?reveal=true and the per-key endpoint, which
+	// return secret values
+	AllowReveal bool       `mapstructure:"allowReveal"`
+	TLS         TLSConfig  `mapstructure:"tls"`
+	Auth        AuthConfig `mapstructure:"auth"`
+}
+
+// TLSConfig serves HTTPS. With ClientCAFile, client certificates signed by
+// those CAs are verified when presented.
+type TLSConfig struct {
+	CertFile     string `mapstructure:"certFile"`
+	KeyFile      string `mapstructure:"keyFile"`
+	ClientCAFile string `mapstructure:"clientCAFile"`
+}
+
+// AuthConfig authenticates API requests with static tokens, Kubernetes
+// TokenReview and, when tls.clientCAFile is set, client certificates
+type AuthConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// TokenFile holds token,user,uid,"groups" lines
+	TokenFile   string `mapstructure:"tokenFile"`
+	TokenReview bool   `mapstructure:"tokenReview"`
+	// Audiences a reviewed token must be issued for, any when empty
+	Audiences []string `mapstructure:"audiences"`
+	// CacheTTL is how long TokenReview results are reused
+	CacheTTL time.Duration `mapstructure:"cacheTTL"`
+	// Authorization is one of the Authorization modes, empty to let every
+	// authenticated caller act with the permissions of the server
+	Authorization string `mapstructure:"authorization"`
+}
+
+// Authorization modes of AuthConfig
+const (
+	// AuthorizationAccessReview checks every operation with a
+	// SubjectAccessReview of the caller
+	AuthorizationAccessReview = "subjectAccessReview"
+	// AuthorizationImpersonate sends every operation to the API server as
+	// the caller
+	AuthorizationImpersonate = "impersonate"
+)
+
+// KubernetesConfig controls how the API server connection is established
+type KubernetesConfig struct {
+	InCluster  bool          `mapstructure:"inCluster"`
+	Kubeconfig string        `mapstructure:"kubeconfig"`
+	Context    string        `mapstructure:"context"`
+	Cluster    string        `mapstructure:"cluster"`
+	User       string        `mapstructure:"user"`
+	QPS        float32       `mapstructure:"qps"`
+	Burst      int           `mapstructure:"burst"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+}
+
+// CacheConfig enables the informer-backed read cache for every cluster
+type CacheConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	Namespace    string        `mapstructure:"namespace"`
+	ResyncPeriod time.Duration `mapstructure:"resyncPeriod"`
+}
+
+// HistoryConfig keeps encrypted previous versions of every updated secret.
+// The key is a base64 encoded 32 byte AES key, given inline or as a file.
+type HistoryConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Limit   int    `mapstructure:"limit"`
+	Key     string `mapstructure:"key"`
+	KeyFile string `mapstructure:"keyFile"`
+}
+
+// RotationConfig runs the rotation of annotated secrets in the server
+type RotationConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Interval is how often secrets are checked for a due rotation
+	Interval  time.Duration `mapstructure:"interval"`
+	Namespace string        `mapstructure:"namespace"`
+}
+
+// ReplicationConfig runs the replication controller in the server
+type ReplicationConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// ApplyConfig runs the reconciliation of a directory of secret definitions
+// in the server
+type ApplyConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Dir     string `mapstructure:"dir"`
+	// Cluster receives the secrets, the default cluster when empty
+	Cluster string `mapstructure:"cluster"`
+	// Namespace is used for definitions without one
+	Namespace string        `mapstructure:"namespace"`
+	Source    string        `mapstructure:"source"`
+	Prune     bool          `mapstructure:"prune"`
+	Interval  time.Duration `mapstructure:"interval"`
+}
+
+// DecryptionConfig gives the keys that decrypt encrypted secret files on
+// create, import, diff and apply
+type DecryptionConfig struct {
+	// IdentityFile holds age secret keys
+	IdentityFile string `mapstructure:"identityFile"`
+	// PassphraseFile holds a passphrase
+	PassphraseFile string `mapstructure:"passphraseFile"`
+}
+
+// PolicyConfig names the policy file whose rules creates, updates and
+// patches of secrets must satisfy
+type PolicyConfig struct {
+	File string `mapstructure:"file"`
+}
+
+// ExternalConfig syncs fields of a Vault compatible KV store into secrets,
+// for the mappings listed here and for secrets annotated with
+// secrets-manager.io/external-data
+type ExternalConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
+	// Cluster receives the secrets, the default cluster when empty
+	Cluster string `mapstructure:"cluster"`
+	// Namespace limits the annotated secrets that are synced
+	Namespace string `mapstructure:"namespace"`
+	// AnnotationPaths lists, per namespace, the path prefixes annotated
+	// secrets may read. Annotations are ignored when it is empty.
+	AnnotationPaths map[string][]string    `mapstructure:"annotationPaths"`
+	Vault           VaultConfig            `mapstructure:"vault"`
+	Secrets         []ExternalSecretConfig `mapstructure:"secrets"`
+}
+
+// VaultConfig connects to the KV API. Address and token default to
+// $VAULT_ADDR and $VAULT_TOKEN.
+type VaultConfig struct {
+	Address   string `mapstructure:"address"`
+	Token     string `mapstructure:"token"`
+	TokenFile string `mapstructure:"tokenFile"`
+	// Mount is the path of the KV engine, "secret" by default
+	Mount     string        `mapstructure:"mount"`
+	KVVersion int           `mapstructure:"kvVersion"`
+	Namespace string        `mapstructure:"namespace"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+}
+
+// ExternalSecretConfig fills keys of one secret, created when missing, from
+// fields of the store
+type ExternalSecretConfig struct {
+	Name      string               `mapstructure:"name"`
+	Namespace string               `mapstructure:"namespace"`
+	Data      []ExternalDataConfig `mapstructure:"data"`
+}
+
+// ExternalDataConfig copies the field at path into key. The field defaults
+// to the key.
+type ExternalDataConfig struct {
+	Key   string `mapstructure:"key"`
+	Path  string `mapstructure:"path"`
+	Field string `mapstructure:"field"`
+}
+
+// ClusterConfig is a named entry of the cluster registry. Connection
+// settings left empty fall back to the kubernetes section.
+type ClusterConfig struct {
+	Name             string `mapstructure:"name"`
+	KubernetesConfig `mapstructure:",squash"`
 }
 
 func (c *Config) Validate() error {
 	if c.Server.Port == "" {
 		return fmt.Errorf("server port is required")
 	}
+	if (c.Server.TLS.CertFile == "") != (c.Server.TLS.KeyFile == "") {
+		return fmt.Errorf("server tls requires both certFile and keyFile")
+	}
+	if c.Server.TLS.ClientCAFile != "" && c.Server.TLS.CertFile == "" {
+		return fmt.Errorf("server tls clientCAFile requires certFile and keyFile")
+	}
+	if auth := c.Server.Auth; auth.Enabled && auth.TokenFile == "" && !auth.TokenReview && c.Server.TLS.ClientCAFile == "" {
+		return fmt.Errorf("server auth requires a tokenFile, tokenReview or tls clientCAFile")
+	}
+	if c.Server.Auth.TokenReview && c.Backend.Type != "" && c.Backend.Type != BackendKubernetes {
+		return fmt.Errorf("server auth tokenReview requires the kubernetes backend")
+	}
+	switch c.Server.Auth.Authorization {
+	case "":
+	case AuthorizationAccessReview, AuthorizationImpersonate:
+		if !c.Server.Auth.Enabled {
+			return fmt.Errorf("server auth authorization requires auth to be enabled")
+		}
+		if c.Backend.Type != "" && c.Backend.Type != BackendKubernetes {
+			return fmt.Errorf("server auth authorization requires the kubernetes backend")
+		}
+	default:
+		return fmt.Errorf("unknown server auth authorization %q", c.Server.Auth.Authorization)
+	}
+	if c.KubeConfig != "" && c.Kubernetes.Kubeconfig != "" && c.KubeConfig != c.Kubernetes.Kubeconfig {
+		return fmt.Errorf("kubeconfig is deprecated and conflicts with kubernetes.kubeconfig, keep only kubernetes.kubeconfig")
+	}
+	if c.Kubernetes.InCluster && (c.Kubernetes.Kubeconfig != "" || c.Kubernetes.Context != "") {
+		return fmt.Errorf("kubernetes.inCluster cannot be combined with kubeconfig or context")
+	}
+	if c.Kubernetes.QPS < 0 || c.Kubernetes.Burst < 0 {
+		return fmt.Errorf("kubernetes qps and burst must not be negative")
+	}
+
+	switch c.Backend.Type {
+	case "", BackendKubernetes, BackendMemory:
+	case BackendFile:
+		if c.Backend.Path == "" {
+			return fmt.Errorf("the file backend requires a path")
+		}
+		if (c.Backend.Key == "") == (c.Backend.KeyFile == "") {
+			return fmt.Errorf("the file backend requires exactly one of key or keyFile")
+		}
+	default:
+		return fmt.Errorf("unknown backend %s", c.Backend.Type)
+	}
+	if len(c.Clusters) > 0 && c.Backend.Type != "" && c.Backend.Type != BackendKubernetes {
+		return fmt.Errorf("clusters require the kubernetes backend")
+	}
+
+	seen := make(map[string]bool)
+	for i, cluster := range c.Clusters {
+		if cluster.Name == "" {
+			return fmt.Errorf("clusters[%d]: name is required", i)
+		}
+		if seen[cluster.Name] {
+			return fmt.Errorf("clusters[%d]: duplicate cluster name %s", i, cluster.Name)
+		}
+		if cluster.InCluster && (cluster.Kubeconfig != "" || cluster.Context != "") {
+			return fmt.Errorf("clusters[%d]: inCluster cannot be combined with kubeconfig or context", i)
+		}
+		seen[cluster.Name] = true
+	}
+	if c.DefaultCluster != "" && !seen[c.DefaultCluster] {
+		return fmt.Errorf("default cluster %s is not defined in clusters", c.DefaultCluster)
+	}
+
+	if c.History.Enabled {
+		// Local backends keep revisions with the secrets, unencrypted in
+		// memory or sealed in the backend file
+		local := c.Backend.Type == BackendMemory || c.Backend.Type == BackendFile
+		if !local && (c.History.Key == "") == (c.History.KeyFile == "") {
+			return fmt.Errorf("history requires exactly one of key or keyFile")
+		}
+		if c.History.Limit < 0 {
+			return fmt.Errorf("history limit must not be negative")
+		}
+	}
+	if c.Apply.Enabled && c.Apply.Dir == "" {
+		return fmt.Errorf("apply requires a dir")
+	}
+	if v := c.External.Vault.KVVersion; v != 0 && v != 1 && v != 2 {
+		return fmt.Errorf("external vault kvVersion must be 1 or 2")
+	}
+	if c.External.Vault.Token != "" && c.External.Vault.TokenFile != "" {
+		return fmt.Errorf("external vault accepts only one of token or tokenFile")
+	}
+	for namespace, prefixes := range c.External.AnnotationPaths {
+		for _, prefix := range prefixes {
+			if strings.Trim(prefix, "/") == "" {
+				return fmt.Errorf("external.annotationPaths.%s: prefix is required", namespace)
+			}
+		}
+	}
+	for i, secret := range c.External.Secrets {
+		if secret.Name == "" {
+			return fmt.Errorf("external.secrets[%d]: name is required", i)
+		}
+		if len(secret.Data) == 0 {
+			return fmt.Errorf("external.secrets[%d]: data is required", i)
+		}
+		for j, data := range secret.Data {
+			if data.Key == "" || data.Path == "" {
+				return fmt.Errorf("external.secrets[%d].data[%d]: key and path are required", i, j)
+			}
+		}
+	}
 	return nil
 }
 
@@ -28,8 +332,20 @@ func Load() (*Config, error) {
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
 
+	viper.SetDefault("backend.type", BackendKubernetes)
 	viper.SetDefault("server.port", "8080")
 	viper.SetDefault("server.host", "0.0.0.0")
+	viper.SetDefault("server.auth.cacheTTL", "10s")
+	viper.SetDefault("kubernetes.timeout", "30s")
+	viper.SetDefault("cache.resyncPeriod", "10m")
+	viper.SetDefault("history.limit", 10)
+	viper.SetDefault("rotation.interval", "1m")
+	viper.SetDefault("replication.interval", "30s")
+	viper.SetDefault("apply.namespace", "default")
+	viper.SetDefault("apply.interval", "1m")
+	viper.SetDefault("external.interval", "1m")
+	viper.SetDefault("external.vault.mount", "secret")
+	viper.SetDefault("external.vault.kvVersion", 2)
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -41,6 +357,9 @@ func Load() (*Config, error) {
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
+	if config.Kubernetes.Kubeconfig == "" {
+		config.Kubernetes.Kubeconfig = config.KubeConfig
+	}
 
 	return &config, nil
 }
@@ -0,0 +1,61 @@
+package crypto
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+)
+
+// Recipients returns the age recipients to encrypt to: either a passphrase or
+// age public keys (age1...), which age does not allow to mix
+func Recipients(passphrase string, publicKeys []string) ([]age.Recipient, error) {
+	switch {
+	case passphrase != "" && len(publicKeys) > 0:
+		return nil, apperrors.New(apperrors.CodeInvalid, "use either a passphrase or recipients, not both")
+	case passphrase != "":
+		recipient, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, apperrors.Wrap(apperrors.CodeInvalid, "invalid passphrase", err)
+		}
+		return []age.Recipient{recipient}, nil
+	case len(publicKeys) == 0:
+		return nil, apperrors.New(apperrors.CodeInvalid, "a passphrase or at least one recipient is required")
+	}
+
+	recipients := make([]age.Recipient, 0, len(publicKeys))
+	for _, key := range publicKeys {
+		recipient, err := age.ParseX25519Recipient(strings.TrimSpace(key))
+		if err != nil {
+			return nil, apperrors.Wrap(apperrors.CodeInvalid, fmt.Sprintf("invalid recipient %q", key), err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// Identities returns the age identities to decrypt with: a passphrase and/or
+// the age secret keys (AGE-SECRET-KEY-1...) read from keys
+func Identities(passphrase string, keys io.Reader) ([]age.Identity, error) {
+	var identities []age.Identity
+	if passphrase != "" {
+		identity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, apperrors.Wrap(apperrors.CodeInvalid, "invalid passphrase", err)
+		}
+		identities = append(identities, identity)
+	}
+	if keys != nil {
+		parsed, err := age.ParseIdentities(keys)
+		if err != nil {
+			return nil, apperrors.Wrap(apperrors.CodeInvalid, "invalid identity", err)
+		}
+		identities = append(identities, parsed...)
+	}
+	if len(identities) == 0 {
+		return nil, apperrors.New(apperrors.CodeInvalid, "a passphrase or an identity is required")
+	}
+	return identities, nil
+}
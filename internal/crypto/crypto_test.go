@@ -0,0 +1,72 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestCipher(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte("s3cr3t")
+	sealed, err := c.Encrypt(plaintext, []byte("default/db"))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Fatal("Encrypt() output contains the plaintext")
+	}
+
+	opened, err := c.Decrypt(sealed, []byte("default/db"))
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Fatalf("Decrypt() = %q, %v", opened, err)
+	}
+
+	otherKey, _ := GenerateKey()
+	other, _ := NewCipher(otherKey)
+
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name       string
+		cipher     *Cipher
+		ciphertext []byte
+		ad         string
+	}{
+		{name: "wrong additional data", cipher: c, ciphertext: sealed, ad: "default/other"},
+		{name: "wrong key", cipher: other, ciphertext: sealed, ad: "default/db"},
+		{name: "tampered", cipher: c, ciphertext: tampered, ad: "default/db"},
+		{name: "truncated", cipher: c, ciphertext: sealed[:4], ad: "default/db"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.cipher.Decrypt(tt.ciphertext, []byte(tt.ad)); !errors.Is(err, ErrDecrypt) {
+				t.Errorf("Decrypt() error = %v, want ErrDecrypt", err)
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key, _ := GenerateKey()
+
+	if got, err := ParseKey(base64.StdEncoding.EncodeToString(key) + "\n"); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("ParseKey() = %v, %v", got, err)
+	}
+	if _, err := ParseKey(base64.StdEncoding.EncodeToString(key[:16])); err == nil {
+		t.Error("ParseKey() accepted a 16 byte key")
+	}
+	if _, err := ParseKey("not base64!"); err == nil {
+		t.Error("ParseKey() accepted invalid base64")
+	}
+}
@@ -0,0 +1,199 @@
+// Package diff compares desired secret definitions with the live secrets of
+// a cluster.
+package diff
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Op is the kind of a change
+type Op string
+
+const (
+	OpAdded   Op = "added"
+	OpRemoved Op = "removed"
+	OpChanged Op = "changed"
+)
+
+// Status summarizes the comparison of a secret
+type Status string
+
+const (
+	StatusInSync Status = "in-sync"
+	StatusDrift  Status = "drift"
+	// StatusMissing means the secret does not exist in the cluster
+	StatusMissing Status = "missing"
+)
+
+// Change is a difference between the live and the desired secret. Old is the
+// live value and New the desired one; data values are masked unless revealed.
+type Change struct {
+	// Field is data, type, immutable, labels or annotations
+	Field string `json:"field"`
+	Key   string `json:"key,omitempty"`
+	Op    Op     `json:"op"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// Result is the comparison of one secret
+type Result struct {
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Status    Status   `json:"status"`
+	Changes   []Change `json:"changes"`
+}
+
+// Options control how values are shown
+type Options struct {
+	// Reveal shows data values instead of their hashes
+	Reveal bool
+}
+
+// Drift reports whether any of results differs from the cluster
+func Drift(results []Result) bool {
+	for _, result := range results {
+		if result.Status != StatusInSync {
+			return true
+		}
+	}
+	return false
+}
+
+// Secrets compares every desired secret with its live version
+func Secrets(ctx context.Context, manager k8s.SecretManager, desired []*k8s.SecretData, opts Options) ([]Result, error) {
+	results := make([]Result, 0, len(desired))
+	for _, data := range desired {
+		live, err := manager.GetSecret(ctx, data.Namespace, data.Name)
+		if err != nil && apperrors.CodeOf(err) != apperrors.CodeNotFound {
+			return nil, err
+		}
+		results = append(results, Compare(data, live, opts))
+	}
+	return results, nil
+}
+
+// Compare compares desired with live, which is nil when the secret does not
+// exist. Like an update, it only considers the type, labels and annotations
+// when desired sets them.
+func Compare(desired *k8s.SecretData, live *corev1.Secret, opts Options) Result {
+	result := Result{Namespace: desired.Namespace, Name: desired.Name, Changes: []Change{}}
+	if live == nil {
+		live = &corev1.Secret{}
+		result.Status = StatusMissing
+	}
+
+	result.Changes = append(result.Changes,
+		compareMaps("data", live.Data, desired.Values(), equalBytes, valueShower(opts.Reveal))...)
+
+	if desired.Type != "" && corev1.SecretType(desired.Type) != live.Type {
+		result.Changes = append(result.Changes, Change{Field: "type", Op: OpChanged, Old: string(live.Type), New: desired.Type})
+	}
+	if desired.Immutable && (live.Immutable == nil || !*live.Immutable) {
+		result.Changes = append(result.Changes, Change{Field: "immutable", Op: OpChanged, Old: "false", New: "true"})
+	}
+	if desired.Labels != nil {
+		result.Changes = append(result.Changes,
+			compareMaps("labels", live.Labels, desired.Labels, equalStrings, showString)...)
+	}
+	if desired.Annotations != nil {
+		liveAnnotations, desiredAnnotations := live.Annotations, desired.Annotations
+		if !opts.Reveal {
+			liveAnnotations, desiredAnnotations = MaskAnnotations(liveAnnotations), MaskAnnotations(desiredAnnotations)
+		}
+		result.Changes = append(result.Changes,
+			compareMaps("annotations", liveAnnotations, desiredAnnotations, equalStrings, showString)...)
+	}
+
+	if result.Status == "" {
+		result.Status = StatusInSync
+		if len(result.Changes) > 0 {
+			result.Status = StatusDrift
+		}
+	}
+	return result
+}
+
+// compareMaps lists the keys added, removed or changed from live to desired,
+// showing values through show
+func compareMaps[V any](field string, live, desired map[string]V, equal func(a, b V) bool, show func(V) string) []Change {
+	var changes []Change
+	for _, key := range sortedKeys(live, desired) {
+		old, inLive := live[key]
+		value, inDesired := desired[key]
+		switch {
+		case !inLive:
+			changes = append(changes, Change{Field: field, Key: key, Op: OpAdded, New: show(value)})
+		case !inDesired:
+			changes = append(changes, Change{Field: field, Key: key, Op: OpRemoved, Old: show(old)})
+		case !equal(old, value):
+			changes = append(changes, Change{Field: field, Key: key, Op: OpChanged, Old: show(old), New: show(value)})
+		}
+	}
+	return changes
+}
+
+func equalBytes(a, b []byte) bool { return string(a) == string(b) }
+
+func equalStrings(a, b string) bool { return a == b }
+
+func showString(value string) string { return value }
+
+// valueShower shows data values as hashes, or as they are when revealed
+func valueShower(reveal bool) func([]byte) string {
+	return func(value []byte) string {
+		if !reveal {
+			return Hash(value)
+		}
+		if utf8.Valid(value) {
+			return string(value)
+		}
+		return strconv.Quote(string(value))
+	}
+}
+
+// Hash masks a value as its SHA-256, the digest the API shows for every key
+func Hash(value []byte) string {
+	sum := sha256.Sum256(value)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// MaskAnnotations returns annotations with the values of those that copy
+// secret data, such as kubectl's last applied configuration, masked like
+// data values. annotations is returned as is when there is nothing to mask.
+func MaskAnnotations(annotations map[string]string) map[string]string {
+	value, ok := annotations[corev1.LastAppliedConfigAnnotation]
+	if !ok {
+		return annotations
+	}
+	masked := make(map[string]string, len(annotations))
+	for key, v := range annotations {
+		masked[key] = v
+	}
+	masked[corev1.LastAppliedConfigAnnotation] = Hash([]byte(value))
+	return masked
+}
+
+func sortedKeys[V any](maps ...map[string]V) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, m := range maps {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
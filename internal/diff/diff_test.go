@@ -0,0 +1,109 @@
+package diff
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// lastApplied is what kubectl apply records for a secret, values included
+const lastApplied = `{"apiVersion":"v1","kind":"Secret","data":{"PASSWORD":"czNjcjN0"}}`
+
+func TestSecrets(t *testing.T) {
+	manager := k8s.NewClientForClientset(fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "db",
+			Namespace:   "default",
+			Labels:      map[string]string{"app": "api", "tier": "db"},
+			Annotations: map[string]string{"owner": "team-a"},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{"USER": []byte("admin"), "PASSWORD": []byte("s3cr3t"), "HOST": []byte("db")},
+	}))
+
+	tests := []struct {
+		name       string
+		desired    *k8s.SecretData
+		opts       Options
+		wantStatus Status
+		want       []Change
+	}{
+		{
+			name: "in sync",
+			desired: &k8s.SecretData{Name: "db", Namespace: "default",
+				Data: map[string]string{"USER": "admin", "PASSWORD": "s3cr3t", "HOST": "db"}},
+			wantStatus: StatusInSync,
+			want:       []Change{},
+		},
+		{
+			name: "keys and metadata",
+			desired: &k8s.SecretData{Name: "db", Namespace: "default", Type: "kubernetes.io/basic-auth",
+				Data:   map[string]string{"USER": "admin", "PASSWORD": "changed", "PORT": "5432"},
+				Labels: map[string]string{"app": "api", "tier": "cache"}},
+			wantStatus: StatusDrift,
+			want: []Change{
+				{Field: "data", Key: "HOST", Op: OpRemoved, Old: Hash([]byte("db"))},
+				{Field: "data", Key: "PASSWORD", Op: OpChanged, Old: Hash([]byte("s3cr3t")), New: Hash([]byte("changed"))},
+				{Field: "data", Key: "PORT", Op: OpAdded, New: Hash([]byte("5432"))},
+				{Field: "type", Op: OpChanged, Old: "Opaque", New: "kubernetes.io/basic-auth"},
+				{Field: "labels", Key: "tier", Op: OpChanged, Old: "db", New: "cache"},
+			},
+		},
+		{
+			name: "revealed",
+			desired: &k8s.SecretData{Name: "db", Namespace: "default",
+				Data:        map[string]string{"USER": "root", "PASSWORD": "s3cr3t", "HOST": "db"},
+				Annotations: map[string]string{}},
+			opts:       Options{Reveal: true},
+			wantStatus: StatusDrift,
+			want: []Change{
+				{Field: "data", Key: "USER", Op: OpChanged, Old: "admin", New: "root"},
+				{Field: "annotations", Key: "owner", Op: OpRemoved, Old: "team-a"},
+			},
+		},
+		{
+			name: "last applied configuration masked",
+			desired: &k8s.SecretData{Name: "db", Namespace: "default",
+				Data:        map[string]string{"USER": "admin", "PASSWORD": "s3cr3t", "HOST": "db"},
+				Annotations: map[string]string{"owner": "team-a", corev1.LastAppliedConfigAnnotation: lastApplied}},
+			wantStatus: StatusDrift,
+			want: []Change{
+				{Field: "annotations", Key: corev1.LastAppliedConfigAnnotation, Op: OpAdded, New: Hash([]byte(lastApplied))},
+			},
+		},
+		{
+			name:       "missing",
+			desired:    &k8s.SecretData{Name: "api", Namespace: "default", Data: map[string]string{"TOKEN": "t"}},
+			wantStatus: StatusMissing,
+			want:       []Change{{Field: "data", Key: "TOKEN", Op: OpAdded, New: Hash([]byte("t"))}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := Secrets(context.Background(), manager, []*k8s.SecretData{tt.desired}, tt.opts)
+			if err != nil {
+				t.Fatalf("Secrets() error = %v", err)
+			}
+			result := results[0]
+			if result.Status != tt.wantStatus {
+				t.Errorf("Status = %s, want %s", result.Status, tt.wantStatus)
+			}
+			if Drift(results) != (tt.wantStatus != StatusInSync) {
+				t.Errorf("Drift() = %v", Drift(results))
+			}
+			if len(result.Changes) != len(tt.want) {
+				t.Fatalf("Changes = %+v, want %+v", result.Changes, tt.want)
+			}
+			for i := range tt.want {
+				if result.Changes[i] != tt.want[i] {
+					t.Errorf("Changes[%d] = %+v, want %+v", i, result.Changes[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Package dotenv reads env files with the semantics of kubectl's
+// --from-env-file: one KEY=VALUE per line, values taken verbatim.
+package dotenv
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// Parse reads KEY=VALUE lines from r. Blank lines and lines starting with #
+// are skipped, leading whitespace is trimmed from keys, and values are kept
+// as written, quotes included. A line holding only a key takes its value
+// from the environment and is skipped when the variable is not set. Later
+// lines win over earlier ones.
+func Parse(r io.Reader) (map[string]string, error) {
+	env := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Bytes()
+		if lineNum == 1 {
+			line = bytes.TrimPrefix(line, utf8BOM)
+		}
+		if !utf8.Valid(line) {
+			return nil, fmt.Errorf("line %d is not valid UTF-8", lineNum)
+		}
+
+		text := strings.TrimLeftFunc(string(line), unicode.IsSpace)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(text, "=")
+		if errs := validation.IsEnvVarName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("line %d: invalid key %q: %s", lineNum, key, strings.Join(errs, "; "))
+		}
+
+		if !hasValue {
+			var ok bool
+			if value, ok = os.LookupEnv(key); !ok {
+				continue
+			}
+		}
+		env[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading env file: %w", err)
+	}
+
+	return env, nil
+}
+
+// ReadFile parses the env file at path
+func ReadFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening env file: %w", err)
+	}
+	defer f.Close()
+
+	env, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return env, nil
+}
+
+// Write writes env as KEY=VALUE lines sorted by key, in the form Parse reads
+// back. Keys must be valid variable names and values single lines.
+func Write(w io.Writer, env map[string]string) error {
+	keys := make([]string, 0, len(env))
+	for key, value := range env {
+		if errs := validation.IsEnvVarName(key); len(errs) > 0 {
+			return fmt.Errorf("key %q cannot be written to an env file: %s", key, strings.Join(errs, "; "))
+		}
+		if strings.ContainsAny(value, "\r\n") || !utf8.ValidString(value) {
+			return fmt.Errorf("value of key %s cannot be written to an env file", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "%s=%s\n", key, env[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package dotenv
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Setenv("FROM_ENV", "inherited")
+
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "plain pairs",
+			input: "USER=admin\nPASSWORD=a,b=c\n",
+			want:  map[string]string{"USER": "admin", "PASSWORD": "a,b=c"},
+		},
+		{
+			name:  "comments, blank lines and indentation",
+			input: "# comment\n\n   HOST=db.local\n\t# indented comment\n",
+			want:  map[string]string{"HOST": "db.local"},
+		},
+		{
+			name:  "values are verbatim",
+			input: "QUOTED=\"x y\" \nEMPTY=\n",
+			want:  map[string]string{"QUOTED": "\"x y\" ", "EMPTY": ""},
+		},
+		{
+			name:  "key only reads the environment",
+			input: "FROM_ENV\nNOT_SET_ANYWHERE_XYZ\n",
+			want:  map[string]string{"FROM_ENV": "inherited"},
+		},
+		{
+			name:  "byte order mark",
+			input: "\xEF\xBB\xBFKEY=value\n",
+			want:  map[string]string{"KEY": "value"},
+		},
+		{
+			name:  "later lines win",
+			input: "KEY=first\nKEY=second\n",
+			want:  map[string]string{"KEY": "second"},
+		},
+		{
+			name:    "invalid key",
+			input:   "1KEY=value\n",
+			wantErr: true,
+		},
+		{
+			name:    "space before equals",
+			input:   "KEY =value\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	env := map[string]string{"USER": "admin", "PASSWORD": "a,b=c \"quoted\""}
+
+	var b strings.Builder
+	if err := Write(&b, env); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if b.String() != "PASSWORD=a,b=c \"quoted\"\nUSER=admin\n" {
+		t.Errorf("Write() = %q", b.String())
+	}
+
+	parsed, err := Parse(strings.NewReader(b.String()))
+	if err != nil || !reflect.DeepEqual(parsed, env) {
+		t.Errorf("Parse(Write()) = %v, %v", parsed, err)
+	}
+
+	for _, invalid := range []map[string]string{{"1KEY": "x"}, {"KEY": "two\nlines"}} {
+		if err := Write(&b, invalid); err == nil {
+			t.Errorf("Write(%v) succeeded", invalid)
+		}
+	}
+}
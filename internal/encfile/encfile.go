@@ -0,0 +1,373 @@
+// Package encfile encrypts the values of secret definition files while
+// keeping their keys and metadata readable, so the files can live in git.
+//
+// Every value is sealed with AES-256-GCM under a random data key, bound to
+// its path in the document. The data key is encrypted with age to X25519
+// recipients or a passphrase and stored, with an HMAC-SHA256 over the whole
+// document, under MetadataKey.
+package encfile
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/mpalu/k8s-secrets-manager/internal/crypto"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"golang.org/x/crypto/hkdf"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// MetadataKey holds the encryption metadata at the top of a document
+	MetadataKey = "secrets-manager"
+
+	formatVersion = 1
+	valuePrefix   = "ENC[AES256_GCM,"
+	valueSuffix   = "]"
+)
+
+// valueFields hold the secret values of Secret manifests and SecretData
+// documents; elsewhere in such documents values stay readable
+var valueFields = map[string]bool{"data": true, "stringData": true, "binaryData": true}
+
+type metadata struct {
+	Version int `json:"version"`
+	// DataKey is the data key encrypted with age, ASCII armored
+	DataKey string `json:"dataKey"`
+	MAC     string `json:"mac"`
+}
+
+// Key is the data key of an encrypted file
+type Key struct {
+	key     []byte
+	wrapped string
+	cipher  *crypto.Cipher
+}
+
+// NewKey generates a data key and encrypts it to recipients
+func NewKey(recipients []age.Recipient) (*Key, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var wrapped bytes.Buffer
+	armored := armor.NewWriter(&wrapped)
+	w, err := age.Encrypt(armored, recipients...)
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.CodeInvalid, "error encrypting data key", err)
+	}
+	if _, err := w.Write(key); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := armored.Close(); err != nil {
+		return nil, err
+	}
+	return newKey(key, wrapped.String())
+}
+
+// OpenKey decrypts the data key of an encrypted file with identities
+func OpenKey(content []byte, identities []age.Identity) (*Key, error) {
+	_, meta, _, err := parse(content)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, apperrors.New(apperrors.CodeInvalid, "file is not encrypted")
+	}
+	if len(identities) == 0 {
+		return nil, apperrors.New(apperrors.CodeInvalid, "file is encrypted, an identity or passphrase is required")
+	}
+
+	r, err := age.Decrypt(armor.NewReader(strings.NewReader(meta.DataKey)), identities...)
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.CodeForbidden, "error decrypting data key", err)
+	}
+	key, err := io.ReadAll(r)
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.CodeForbidden, "error decrypting data key", err)
+	}
+	return newKey(key, meta.DataKey)
+}
+
+func newKey(key []byte, wrapped string) (*Key, error) {
+	cipher, err := crypto.NewCipher(key)
+	if err != nil {
+		return nil, tampered("%v", err)
+	}
+	return &Key{key: key, wrapped: wrapped, cipher: cipher}, nil
+}
+
+// Encrypt encrypts a plaintext document, see the package documentation
+func Encrypt(content []byte, recipients []age.Recipient) ([]byte, error) {
+	key, err := NewKey(recipients)
+	if err != nil {
+		return nil, err
+	}
+	return key.Encrypt(content)
+}
+
+// Decrypt verifies and decrypts an encrypted document
+func Decrypt(content []byte, identities []age.Identity) ([]byte, error) {
+	key, err := OpenKey(content, identities)
+	if err != nil {
+		return nil, err
+	}
+	return key.Decrypt(content)
+}
+
+// IsEncrypted reports whether content is an encrypted document
+func IsEncrypted(content []byte) bool {
+	if !bytes.Contains(content, []byte(MetadataKey)) {
+		return false
+	}
+	_, meta, _, err := parse(content)
+	return err == nil && meta != nil
+}
+
+// DecryptReader returns the decrypted content of r when it is an encrypted
+// document, and its content unchanged otherwise
+func DecryptReader(r io.Reader, identities []age.Identity) (io.Reader, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading input: %w", err)
+	}
+	if !IsEncrypted(content) {
+		return bytes.NewReader(content), nil
+	}
+	plaintext, err := Decrypt(content, identities)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(plaintext), nil
+}
+
+// Encrypt encrypts the values of a plaintext document with k
+func (k *Key) Encrypt(content []byte) ([]byte, error) {
+	doc, meta, isJSON, err := parse(content)
+	if err != nil {
+		return nil, err
+	}
+	if meta != nil {
+		return nil, apperrors.New(apperrors.CodeInvalid, "file is already encrypted")
+	}
+
+	err = walk(doc, "", !isStructured(doc), func(path, value string) (string, error) {
+		sealed, err := k.cipher.Encrypt([]byte(value), []byte(path))
+		if err != nil {
+			return "", err
+		}
+		return valuePrefix + base64.StdEncoding.EncodeToString(sealed) + valueSuffix, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	meta = &metadata{Version: formatVersion, DataKey: k.wrapped}
+	if meta.MAC, err = k.mac(doc, meta); err != nil {
+		return nil, err
+	}
+	doc[MetadataKey] = meta
+	return encode(doc, isJSON)
+}
+
+// Decrypt verifies the MAC of an encrypted document and decrypts its values
+// with k. Nothing is decrypted from a document that fails verification.
+func (k *Key) Decrypt(content []byte) ([]byte, error) {
+	doc, meta, isJSON, err := parse(content)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, apperrors.New(apperrors.CodeInvalid, "file is not encrypted")
+	}
+	if meta.Version != formatVersion {
+		return nil, apperrors.New(apperrors.CodeInvalid, fmt.Sprintf("unsupported encrypted file version %d", meta.Version))
+	}
+
+	want, err := k.mac(doc, meta)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(meta.MAC), []byte(want)) {
+		return nil, tampered("MAC mismatch")
+	}
+
+	err = walk(doc, "", !isStructured(doc), func(path, value string) (string, error) {
+		if !strings.HasPrefix(value, valuePrefix) || !strings.HasSuffix(value, valueSuffix) {
+			return "", tampered("value at %s is not encrypted", path)
+		}
+		sealed, err := base64.StdEncoding.DecodeString(value[len(valuePrefix) : len(value)-len(valueSuffix)])
+		if err != nil {
+			return "", tampered("value at %s: %v", path, err)
+		}
+		plaintext, err := k.cipher.Decrypt(sealed, []byte(path))
+		if err != nil {
+			return "", tampered("value at %s: %v", path, err)
+		}
+		return string(plaintext), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return encode(doc, isJSON)
+}
+
+// mac authenticates the document without its MAC. Map keys are sorted by
+// json.Marshal, which makes the encoding canonical.
+func (k *Key) mac(doc map[string]interface{}, meta *metadata) (string, error) {
+	unsigned := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		unsigned[key] = value
+	}
+	unsigned[MetadataKey] = metadata{Version: meta.Version, DataKey: meta.DataKey}
+	canonical, err := json.Marshal(unsigned)
+	if err != nil {
+		return "", fmt.Errorf("error encoding document: %w", err)
+	}
+
+	macKey := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, k.key, nil, []byte("mac")), macKey); err != nil {
+		return "", err
+	}
+	h := hmac.New(sha256.New, macKey)
+	h.Write(canonical)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// parse reads a single YAML or JSON object and splits off its metadata
+func parse(content []byte) (map[string]interface{}, *metadata, bool, error) {
+	trimmed := bytes.TrimSpace(content)
+	isJSON := bytes.HasPrefix(trimmed, []byte("{"))
+
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(trimmed), 4096)
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, nil, false, apperrors.New(apperrors.CodeBadRequest, fmt.Sprintf("error reading document: %v", err))
+	}
+	var extra interface{}
+	if err := decoder.Decode(&extra); err != io.EOF || extra != nil {
+		return nil, nil, false, apperrors.New(apperrors.CodeBadRequest,
+			"encrypted files hold a single document, use a v1/List for several secrets")
+	}
+	if doc == nil {
+		return nil, nil, false, apperrors.New(apperrors.CodeBadRequest, "document is empty")
+	}
+
+	raw, ok := doc[MetadataKey]
+	if !ok {
+		return doc, nil, isJSON, nil
+	}
+	delete(doc, MetadataKey)
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, nil, false, tampered("%v", err)
+	}
+	var meta metadata
+	if err := json.Unmarshal(encoded, &meta); err != nil {
+		return nil, nil, false, tampered("invalid %s: %v", MetadataKey, err)
+	}
+	return doc, &meta, isJSON, nil
+}
+
+func encode(doc map[string]interface{}, isJSON bool) ([]byte, error) {
+	if !isJSON {
+		return yaml.Marshal(doc)
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// isStructured tells Secret manifests, lists of them and SecretData
+// documents, whose values live in valueFields, from flat documents mapping
+// keys, or secret names and keys, to values. Everything in a flat document
+// is encrypted.
+func isStructured(doc map[string]interface{}) bool {
+	if _, ok := doc["kind"].(string); ok {
+		return true
+	}
+	if _, ok := doc["name"].(string); !ok {
+		return false
+	}
+	for field := range valueFields {
+		if _, ok := doc[field].(map[string]interface{}); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// walk replaces the string values below node with fn of their path and
+// value when node is secret or they are below a value field
+func walk(node interface{}, path string, secret bool, fn func(path, value string) (string, error)) error {
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			childPath := path + "/" + key
+			childSecret := secret || valueFields[key]
+			if value, ok := typed[key].(string); ok {
+				if childSecret {
+					replaced, err := fn(childPath, value)
+					if err != nil {
+						return err
+					}
+					typed[key] = replaced
+				}
+				continue
+			}
+			if err := walk(typed[key], childPath, childSecret, fn); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i := range typed {
+			childPath := path + "/" + strconv.Itoa(i)
+			if value, ok := typed[i].(string); ok {
+				if secret {
+					replaced, err := fn(childPath, value)
+					if err != nil {
+						return err
+					}
+					typed[i] = replaced
+				}
+				continue
+			}
+			if err := walk(typed[i], childPath, secret, fn); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if secret {
+			return apperrors.New(apperrors.CodeInvalid, fmt.Sprintf("value at %s must be a string", path))
+		}
+	}
+	return nil
+}
+
+func tampered(format string, args ...interface{}) error {
+	return apperrors.New(apperrors.CodeInvalid, "encrypted file was tampered with: "+fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,180 @@
+package encfile
+
+import (
+	"bytes"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/mpalu/k8s-secrets-manager/internal/crypto"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"sigs.k8s.io/yaml"
+)
+
+const manifest = `apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+  namespace: prod
+  labels:
+    app: api
+type: Opaque
+stringData:
+  PASSWORD: s3cr3t
+data:
+  USER: YWRtaW4=
+`
+
+func TestRoundTrip(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	recipients := []age.Recipient{identity.Recipient()}
+	identities := []age.Identity{identity}
+
+	tests := []struct {
+		name       string
+		input      string
+		readable   []string
+		encrypted  []string
+		recipients []age.Recipient
+		identities []age.Identity
+	}{
+		{
+			name:      "manifest",
+			input:     manifest,
+			readable:  []string{"name: db", "namespace: prod", "app: api", "PASSWORD: ENC[", "USER: ENC["},
+			encrypted: []string{"s3cr3t", "YWRtaW4="},
+		},
+		{
+			name:      "secretdata json",
+			input:     `{"name": "db", "namespace": "prod", "data": {"PASSWORD": "s3cr3t"}}`,
+			readable:  []string{`"name": "db"`, `"PASSWORD": "ENC[`},
+			encrypted: []string{"s3cr3t"},
+		},
+		{
+			name:      "flat yaml",
+			input:     "db:\n  name: admin\n  PASSWORD: s3cr3t\n",
+			readable:  []string{"db:", "name: ENC[", "PASSWORD: ENC["},
+			encrypted: []string{"admin", "s3cr3t"},
+		},
+		{
+			name:       "passphrase",
+			input:      "PASSWORD: s3cr3t\n",
+			readable:   []string{"PASSWORD: ENC["},
+			encrypted:  []string{"s3cr3t"},
+			recipients: mustRecipients(t, "correct horse battery staple"),
+			identities: mustIdentities(t, "correct horse battery staple"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.recipients == nil {
+				tt.recipients, tt.identities = recipients, identities
+			}
+			encrypted, err := Encrypt([]byte(tt.input), tt.recipients)
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			for _, want := range tt.readable {
+				if !bytes.Contains(encrypted, []byte(want)) {
+					t.Errorf("encrypted file lacks %q:\n%s", want, encrypted)
+				}
+			}
+			for _, secret := range tt.encrypted {
+				if bytes.Contains(encrypted, []byte(secret)) {
+					t.Errorf("encrypted file contains %q", secret)
+				}
+			}
+			if !IsEncrypted(encrypted) || IsEncrypted([]byte(tt.input)) {
+				t.Error("IsEncrypted() does not tell the files apart")
+			}
+
+			decrypted, err := Decrypt(encrypted, tt.identities)
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			var want, got interface{}
+			yaml.Unmarshal([]byte(tt.input), &want)
+			yaml.Unmarshal(decrypted, &got)
+			if string(mustYAML(t, got)) != string(mustYAML(t, want)) {
+				t.Errorf("Decrypt() = %s, want %s", decrypted, tt.input)
+			}
+		})
+	}
+}
+
+func TestTampering(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	other, _ := age.GenerateX25519Identity()
+	encrypted, err := Encrypt([]byte("a: first\nb: second\n"), []age.Recipient{identity.Recipient()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(encrypted, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	swapped := map[string]interface{}{}
+	for key, value := range doc {
+		swapped[key] = value
+	}
+	swapped["a"], swapped["b"] = doc["b"], doc["a"]
+	removed := map[string]interface{}{}
+	for key, value := range doc {
+		removed[key] = value
+	}
+	delete(removed, "b")
+
+	tests := []struct {
+		name       string
+		content    []byte
+		identities []age.Identity
+		wantCode   string
+	}{
+		{"wrong key", encrypted, []age.Identity{other}, apperrors.CodeForbidden},
+		{"no key", encrypted, nil, apperrors.CodeInvalid},
+		{"swapped values", mustYAML(t, swapped), []age.Identity{identity}, apperrors.CodeInvalid},
+		{"removed key", mustYAML(t, removed), []age.Identity{identity}, apperrors.CodeInvalid},
+		{"edited plaintext", bytes.Replace(encrypted, []byte("a: ENC["), []byte("c: ENC["), 1), []age.Identity{identity}, apperrors.CodeInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decrypt(tt.content, tt.identities)
+			if code := apperrors.CodeOf(err); code != tt.wantCode {
+				t.Errorf("Decrypt() error = %v, want code %s", err, tt.wantCode)
+			}
+		})
+	}
+
+	if _, err := Encrypt(encrypted, []age.Recipient{identity.Recipient()}); err == nil {
+		t.Error("Encrypt() encrypted an encrypted file again")
+	}
+	if _, err := Encrypt([]byte("a: 1\n---\nb: 2\n"), []age.Recipient{identity.Recipient()}); err == nil {
+		t.Error("Encrypt() accepted several documents")
+	}
+}
+
+func mustRecipients(t *testing.T, passphrase string) []age.Recipient {
+	recipients, err := crypto.Recipients(passphrase, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recipients
+}
+
+func mustIdentities(t *testing.T, passphrase string) []age.Identity {
+	identities, err := crypto.Identities(passphrase, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identities
+}
+
+func mustYAML(t *testing.T, v interface{}) []byte {
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
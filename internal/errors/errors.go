@@ -1,6 +1,34 @@
 package errors
 
-import "fmt"
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Stable error codes returned to API clients
+const (
+	CodeBadRequest         = "BAD_REQUEST"
+	CodeInvalid            = "INVALID"
+	CodeNotFound           = "NOT_FOUND"
+	CodeAlreadyExists      = "ALREADY_EXISTS"
+	CodeConflict           = "CONFLICT"
+	CodePreconditionFailed = "PRECONDITION_FAILED"
+	CodeImmutable          = "IMMUTABLE"
+	CodeUnauthorized       = "UNAUTHORIZED"
+	CodeForbidden          = "FORBIDDEN"
+	CodeGone               = "GONE"
+	CodeUnsupportedMedia   = "UNSUPPORTED_MEDIA_TYPE"
+	CodeTooLarge           = "TOO_LARGE"
+	CodeTooManyRequests    = "TOO_MANY_REQUESTS"
+	CodeTimeout            = "TIMEOUT"
+	CodeUnavailable        = "UNAVAILABLE"
+	CodeNotImplemented     = "NOT_IMPLEMENTED"
+	CodeInternal           = "INTERNAL"
+)
 
 type Error struct {
 	Code    string
@@ -8,9 +36,107 @@ type Error struct {
 	Err     error
 }
 
+// New returns an error with the given code
+func New(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Wrap returns an error with the given code that keeps err in the chain
+func Wrap(code, message string, err error) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+// Error returns the human readable message; the code travels separately
 func (e *Error) Error() string {
 	if e.Err != nil {
-		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// coder is implemented by typed errors of other packages that map onto a code
+type coder interface {
+	ErrorCode() string
+}
+
+// CodeOf classifies err. The outermost *Error or typed error in the chain
+// wins, then the reason of a Kubernetes API status error.
+func CodeOf(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	for e := err; e != nil; e = stderrors.Unwrap(e) {
+		switch typed := e.(type) {
+		case *Error:
+			return typed.Code
+		case coder:
+			return typed.ErrorCode()
+		}
+	}
+
+	switch {
+	case apierrors.IsNotFound(err):
+		return CodeNotFound
+	case apierrors.IsAlreadyExists(err):
+		return CodeAlreadyExists
+	case apierrors.IsConflict(err):
+		return CodeConflict
+	case apierrors.IsInvalid(err):
+		return CodeInvalid
+	case apierrors.IsBadRequest(err):
+		return CodeBadRequest
+	case apierrors.IsUnauthorized(err):
+		return CodeUnauthorized
+	case apierrors.IsForbidden(err):
+		return CodeForbidden
+	case apierrors.IsResourceExpired(err), apierrors.IsGone(err):
+		return CodeGone
+	case apierrors.IsTooManyRequests(err):
+		return CodeTooManyRequests
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err), stderrors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case apierrors.IsServiceUnavailable(err):
+		return CodeUnavailable
+	}
+	return CodeInternal
+}
+
+// HTTPStatus returns the HTTP status answered for code
+func HTTPStatus(code string) int {
+	switch code {
+	case CodeBadRequest, CodeInvalid:
+		return http.StatusBadRequest
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeAlreadyExists, CodeConflict:
+		return http.StatusConflict
+	case CodePreconditionFailed:
+		return http.StatusPreconditionFailed
+	case CodeImmutable:
+		return http.StatusUnprocessableEntity
+	case CodeUnauthorized:
+		return http.StatusUnauthorized
+	case CodeForbidden:
+		return http.StatusForbidden
+	case CodeGone:
+		return http.StatusGone
+	case CodeUnsupportedMedia:
+		return http.StatusUnsupportedMediaType
+	case CodeTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case CodeTooManyRequests:
+		return http.StatusTooManyRequests
+	case CodeTimeout:
+		return http.StatusGatewayTimeout
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	case CodeNotImplemented:
+		return http.StatusNotImplemented
 	}
-	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	return http.StatusInternalServerError
 }
@@ -0,0 +1,119 @@
+// Package external syncs values from an external secret store into
+// Kubernetes secrets.
+package external
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DataAnnotation maps keys of the annotated secret to external fields as
+// comma separated key=path#field entries, e.g. "password=apps/db#pass". The
+// field defaults to the key.
+const DataAnnotation = "secrets-manager.io/external-data"
+
+// Provider reads secrets from an external store
+type Provider interface {
+	// Read returns the fields stored at path
+	Read(ctx context.Context, path string) (map[string]string, error)
+}
+
+// Mapping fills keys of one secret from external fields
+type Mapping struct {
+	Namespace string     `json:"namespace"`
+	Name      string     `json:"name"`
+	Data      []FieldRef `json:"data"`
+}
+
+// FieldRef names the external field copied into Key
+type FieldRef struct {
+	Key  string `json:"key"`
+	Path string `json:"path"`
+	// Field defaults to Key
+	Field string `json:"field,omitempty"`
+}
+
+// Validate checks that the mapping names a secret and valid, distinct keys
+func (m *Mapping) Validate() error {
+	if m.Namespace == "" || m.Name == "" {
+		return &k8s.ValidationError{Field: "name", Message: "namespace and name are required"}
+	}
+	if len(m.Data) == 0 {
+		return &k8s.ValidationError{Field: "data", Message: fmt.Sprintf("mapping of %s/%s has no data", m.Namespace, m.Name)}
+	}
+
+	seen := make(map[string]bool)
+	for _, ref := range m.Data {
+		if errs := validation.IsConfigMapKey(ref.Key); len(errs) > 0 {
+			return &k8s.ValidationError{Field: "data", Message: fmt.Sprintf("invalid key %q: %s", ref.Key, strings.Join(errs, ", "))}
+		}
+		if err := ValidatePath(ref.Path); err != nil {
+			return &k8s.ValidationError{Field: "data", Message: fmt.Sprintf("key %s: %v", ref.Key, err)}
+		}
+		if seen[ref.Key] {
+			return &k8s.ValidationError{Field: "data", Message: fmt.Sprintf("key %s is mapped twice", ref.Key)}
+		}
+		seen[ref.Key] = true
+	}
+	return nil
+}
+
+// ValidatePath checks that path names an entry below the mount: it may not
+// be empty or hold empty, "." or ".." segments
+func ValidatePath(path string) error {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return apperrors.New(apperrors.CodeInvalid, "path is required")
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return apperrors.New(apperrors.CodeInvalid, fmt.Sprintf("invalid path %q", path))
+		}
+	}
+	return nil
+}
+
+// allowed reports whether path is one of prefixes or below one of them
+func allowed(path string, prefixes []string) bool {
+	path = strings.Trim(path, "/")
+	for _, prefix := range prefixes {
+		prefix = strings.Trim(prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// MappingFor reads the DataAnnotation of secret. It returns nil when the
+// secret is not synced.
+func MappingFor(secret *corev1.Secret) (*Mapping, error) {
+	value, ok := secret.Annotations[DataAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	mapping := &Mapping{Namespace: secret.Namespace, Name: secret.Name}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, ref, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, &k8s.ValidationError{Field: "annotations", Message: fmt.Sprintf("invalid %s entry %q, expected key=path#field", DataAnnotation, entry)}
+		}
+		path, field, _ := strings.Cut(ref, "#")
+		mapping.Data = append(mapping.Data, FieldRef{Key: strings.TrimSpace(key), Path: strings.TrimSpace(path), Field: strings.TrimSpace(field)})
+	}
+	if err := mapping.Validate(); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
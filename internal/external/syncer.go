@@ -0,0 +1,322 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/rs/zerolog"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Sources of a mapping
+const (
+	SourceConfig     = "config"
+	SourceAnnotation = "annotation"
+)
+
+// State is the outcome of the last sync of a mapping
+type State string
+
+const (
+	StateSynced State = "synced"
+	StateFailed State = "failed"
+)
+
+// Status reports the sync of one mapping
+type Status struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Source    string `json:"source"`
+	State     State  `json:"state"`
+	Error     string `json:"error,omitempty"`
+	// LastSync is when the secret was last found in sync with the store
+	LastSync *time.Time `json:"lastSync,omitempty"`
+	// LastChange is when values from the store were last written
+	LastChange *time.Time `json:"lastChange,omitempty"`
+}
+
+// Options configure a Syncer
+type Options struct {
+	// Namespace limits the annotated secrets that are synced, all namespaces
+	// when empty
+	Namespace string
+	// AnnotationPaths lists, per namespace, the path prefixes DataAnnotation
+	// may read. Annotations are not synced without it, and fail in
+	// namespaces it does not list, since whoever can annotate a secret
+	// would otherwise read the store with the access of the syncer.
+	AnnotationPaths map[string][]string
+	Logger          *zerolog.Logger
+	// Now defaults to time.Now
+	Now func() time.Time
+}
+
+// Syncer keeps secrets in sync with the fields of an external store. Secrets
+// of configured mappings are created when missing; annotated secrets are
+// found by listing.
+type Syncer struct {
+	manager  k8s.SecretManager
+	provider Provider
+	mappings []Mapping
+	opts     Options
+
+	mu       sync.RWMutex
+	statuses map[string]Status
+}
+
+// NewSyncer returns a Syncer writing through manager. The mappings must be
+// valid.
+func NewSyncer(manager k8s.SecretManager, provider Provider, mappings []Mapping, opts Options) *Syncer {
+	if opts.Logger == nil {
+		nop := zerolog.Nop()
+		opts.Logger = &nop
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Syncer{
+		manager:  manager,
+		provider: provider,
+		mappings: mappings,
+		opts:     opts,
+		statuses: make(map[string]Status),
+	}
+}
+
+// Run syncs every interval until ctx is done
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Sync(ctx); err != nil {
+			s.opts.Logger.Error().Err(err).Msg("external secret sync failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync reads every mapped path once and writes the secrets whose values
+// differ. It returns the status of every mapping, and an error joining the
+// failures.
+func (s *Syncer) Sync(ctx context.Context) ([]Status, error) {
+	type target struct {
+		mapping Mapping
+		source  string
+	}
+	var targets []target
+	var errs []error
+	annotationErrs := make(map[string]Status)
+
+	configured := make(map[string]bool)
+	for _, mapping := range s.mappings {
+		configured[mapping.Namespace+"/"+mapping.Name] = true
+		targets = append(targets, target{mapping, SourceConfig})
+	}
+
+	var list *k8s.SecretList
+	var err error
+	if len(s.opts.AnnotationPaths) > 0 {
+		list, err = s.manager.ListSecrets(ctx, s.opts.Namespace, k8s.ListOptions{})
+	}
+	if err != nil {
+		errs = append(errs, fmt.Errorf("error listing annotated secrets: %w", err))
+	} else if list != nil {
+		for i := range list.Items {
+			secret := &list.Items[i]
+			ref := secret.Namespace + "/" + secret.Name
+			if configured[ref] {
+				continue
+			}
+			mapping, err := MappingFor(secret)
+			if err == nil && mapping != nil {
+				err = s.checkPaths(mapping)
+			}
+			if err != nil {
+				annotationErrs[ref] = Status{Namespace: secret.Namespace, Name: secret.Name, Source: SourceAnnotation, Error: err.Error()}
+				errs = append(errs, fmt.Errorf("%s: %w", ref, err))
+				continue
+			}
+			if mapping != nil {
+				targets = append(targets, target{*mapping, SourceAnnotation})
+			}
+		}
+	}
+
+	paths := make(map[string]map[string]string)
+	pathErrs := make(map[string]error)
+	read := func(path string) (map[string]string, error) {
+		if err, failed := pathErrs[path]; failed {
+			return nil, err
+		}
+		if fields, ok := paths[path]; ok {
+			return fields, nil
+		}
+		fields, err := s.provider.Read(ctx, path)
+		if err != nil {
+			pathErrs[path] = err
+			return nil, err
+		}
+		paths[path] = fields
+		return fields, nil
+	}
+
+	s.mu.RLock()
+	previous := s.statuses
+	s.mu.RUnlock()
+
+	statuses := make(map[string]Status, len(targets))
+	for ref, status := range annotationErrs {
+		statuses[ref] = s.record(previous[ref], status, false, nil)
+	}
+	for _, t := range targets {
+		ref := t.mapping.Namespace + "/" + t.mapping.Name
+		status := Status{Namespace: t.mapping.Namespace, Name: t.mapping.Name, Source: t.source}
+
+		changed, err := s.syncMapping(ctx, t.mapping, t.source == SourceConfig, read)
+		statuses[ref] = s.record(previous[ref], status, changed, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ref, err))
+			s.opts.Logger.Error().Err(err).Str("namespace", t.mapping.Namespace).Str("name", t.mapping.Name).Msg("external secret not synced")
+			continue
+		}
+		if changed {
+			s.opts.Logger.Info().Str("namespace", t.mapping.Namespace).Str("name", t.mapping.Name).Msg("external secret synced")
+		}
+	}
+	if list == nil && len(s.opts.AnnotationPaths) > 0 {
+		// Annotated secrets are unknown when listing failed, keep their last
+		// status
+		for ref, status := range previous {
+			if _, ok := statuses[ref]; !ok && status.Source == SourceAnnotation {
+				statuses[ref] = status
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.statuses = statuses
+	s.mu.Unlock()
+
+	return s.Status(), errors.Join(errs...)
+}
+
+// checkPaths refuses annotation mappings reading paths AnnotationPaths does
+// not allow for their namespace
+func (s *Syncer) checkPaths(mapping *Mapping) error {
+	prefixes := s.opts.AnnotationPaths[mapping.Namespace]
+	for _, ref := range mapping.Data {
+		if !allowed(ref.Path, prefixes) {
+			return apperrors.New(apperrors.CodeForbidden,
+				fmt.Sprintf("path %s is not allowed for annotated secrets of namespace %s", ref.Path, mapping.Namespace))
+		}
+	}
+	return nil
+}
+
+// Status returns the status of every mapping, ordered by namespace and name
+func (s *Syncer) Status() []Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	statuses := make([]Status, 0, len(s.statuses))
+	for _, status := range s.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Namespace != statuses[j].Namespace {
+			return statuses[i].Namespace < statuses[j].Namespace
+		}
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// syncMapping writes the external values of mapping into its secret when
+// they differ. A missing secret is created when create is set.
+func (s *Syncer) syncMapping(ctx context.Context, mapping Mapping, create bool, read func(string) (map[string]string, error)) (bool, error) {
+	values := make(map[string]string, len(mapping.Data))
+	for _, ref := range mapping.Data {
+		fields, err := read(ref.Path)
+		if err != nil {
+			return false, err
+		}
+		field := ref.Field
+		if field == "" {
+			field = ref.Key
+		}
+		value, ok := fields[field]
+		if !ok {
+			return false, apperrors.New(apperrors.CodeNotFound, fmt.Sprintf("field %s not found at path %s", field, ref.Path))
+		}
+		values[ref.Key] = value
+	}
+
+	secret, err := s.manager.GetSecret(ctx, mapping.Namespace, mapping.Name)
+	if apperrors.CodeOf(err) == apperrors.CodeNotFound && create {
+		data := &k8s.SecretData{
+			Name:      mapping.Name,
+			Namespace: mapping.Namespace,
+			Type:      string(corev1.SecretTypeOpaque),
+			Data:      values,
+		}
+		if err := s.manager.CreateSecret(ctx, data); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	data := k8s.NewSecretData(secret)
+	changed := false
+	for key, value := range values {
+		if current, ok := secret.Data[key]; ok && string(current) == value {
+			continue
+		}
+		delete(data.BinaryData, key)
+		data.Data[key] = value
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+	// The write is conditional on the version read, a concurrent change is
+	// picked up on the next sync
+	if err := s.manager.UpdateSecret(ctx, data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// record completes status with the outcome of a sync, keeping the times of
+// previous
+func (s *Syncer) record(previous, status Status, changed bool, err error) Status {
+	status.LastSync, status.LastChange = previous.LastSync, previous.LastChange
+	if err != nil {
+		status.Error = err.Error()
+	}
+	if status.Error != "" {
+		status.State = StateFailed
+		return status
+	}
+
+	now := s.opts.Now()
+	status.State = StateSynced
+	status.LastSync = &now
+	if changed {
+		status.LastChange = &now
+	}
+	return status
+}
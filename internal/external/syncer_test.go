@@ -0,0 +1,177 @@
+package external
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/backend"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSyncer(t *testing.T) {
+	ctx := context.TODO()
+	kv := newKVServer(t, 2, map[string]map[string]interface{}{
+		"apps/db":  {"username": "admin", "password": "v1"},
+		"apps/api": {"token": "t1"},
+	})
+	vault, err := NewVault(VaultOptions{Address: kv.URL, Token: testToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := backend.NewMemory()
+	store.CreateSecret(ctx, &k8s.SecretData{
+		Name:        "api",
+		Namespace:   "default",
+		Data:        map[string]string{"token": "old", "local": "kept"},
+		Annotations: map[string]string{DataAnnotation: "token=apps/api"},
+	})
+	store.CreateSecret(ctx, &k8s.SecretData{
+		Name:        "broken",
+		Namespace:   "default",
+		Data:        map[string]string{"a": "b"},
+		Annotations: map[string]string{DataAnnotation: "token"},
+	})
+	store.CreateSecret(ctx, &k8s.SecretData{
+		Name:        "outside",
+		Namespace:   "default",
+		Data:        map[string]string{"a": "b"},
+		Annotations: map[string]string{DataAnnotation: "password=apps/db"},
+	})
+	store.CreateSecret(ctx, &k8s.SecretData{
+		Name:        "other",
+		Namespace:   "team-b",
+		Data:        map[string]string{"a": "b"},
+		Annotations: map[string]string{DataAnnotation: "token=apps/api"},
+	})
+
+	syncer := NewSyncer(store, vault, []Mapping{{
+		Namespace: "default",
+		Name:      "db",
+		Data: []FieldRef{
+			{Key: "DB_USER", Path: "apps/db", Field: "username"},
+			{Key: "DB_PASSWORD", Path: "apps/db", Field: "password"},
+		},
+	}}, Options{AnnotationPaths: map[string][]string{"default": {"apps/api"}}})
+
+	statuses, err := syncer.Sync(ctx)
+	if err == nil {
+		t.Error("Sync() ignored the invalid annotation")
+	}
+	want := map[string]State{"api": StateSynced, "broken": StateFailed, "db": StateSynced, "outside": StateFailed, "other": StateFailed}
+	if len(statuses) != len(want) {
+		t.Fatalf("Sync() statuses = %+v", statuses)
+	}
+	for _, status := range statuses {
+		if status.State != want[status.Name] {
+			t.Errorf("status of %s = %s (%s), want %s", status.Name, status.State, status.Error, want[status.Name])
+		}
+	}
+	if kv.reads != 2 {
+		t.Errorf("KV reads = %d, want one per path", kv.reads)
+	}
+
+	for _, ref := range [][2]string{{"default", "outside"}, {"team-b", "other"}} {
+		if secret, _ := store.GetSecret(ctx, ref[0], ref[1]); len(secret.Data) != 1 {
+			t.Errorf("%s/%s read a path it is not allowed: %v", ref[0], ref[1], secret.Data)
+		}
+	}
+
+	if value, _ := store.GetSecretString(ctx, "default", "db", "DB_PASSWORD"); value != "v1" {
+		t.Errorf("DB_PASSWORD = %q, want v1", value)
+	}
+	api, _ := store.GetSecret(ctx, "default", "api")
+	if string(api.Data["token"]) != "t1" || string(api.Data["local"]) != "kept" {
+		t.Errorf("api data = %v, want token synced and local kept", api.Data)
+	}
+
+	// Unchanged values are not written again
+	db, _ := store.GetSecret(ctx, "default", "db")
+	syncer.Sync(ctx)
+	if again, _ := store.GetSecret(ctx, "default", "db"); again.ResourceVersion != db.ResourceVersion {
+		t.Errorf("unchanged secret was written: resourceVersion %s -> %s", db.ResourceVersion, again.ResourceVersion)
+	}
+
+	kv.set("apps/db", map[string]interface{}{"username": "admin", "password": "v2"})
+	syncer.Sync(ctx)
+	if value, _ := store.GetSecretString(ctx, "default", "db", "DB_PASSWORD"); value != "v2" {
+		t.Errorf("DB_PASSWORD after change = %q, want v2", value)
+	}
+
+	kv.set("apps/api", map[string]interface{}{"other": "x"})
+	syncer.Sync(ctx)
+	for _, status := range syncer.Status() {
+		if status.Name == "api" && (status.State != StateFailed || status.LastSync == nil) {
+			t.Errorf("status of api after losing its field = %+v, want failed with the last sync kept", status)
+		}
+	}
+}
+
+func TestSyncer_AnnotationsDisabled(t *testing.T) {
+	ctx := context.TODO()
+	kv := newKVServer(t, 2, map[string]map[string]interface{}{"apps/api": {"token": "t1"}})
+	vault, err := NewVault(VaultOptions{Address: kv.URL, Token: testToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := backend.NewMemory()
+	store.CreateSecret(ctx, &k8s.SecretData{
+		Name:        "api",
+		Namespace:   "default",
+		Data:        map[string]string{"token": "old"},
+		Annotations: map[string]string{DataAnnotation: "token=apps/api"},
+	})
+
+	statuses, err := NewSyncer(store, vault, nil, Options{}).Sync(ctx)
+	if err != nil || len(statuses) != 0 {
+		t.Errorf("Sync() = %+v, %v, want annotations ignored", statuses, err)
+	}
+	if value, _ := store.GetSecretString(ctx, "default", "api", "token"); value != "old" {
+		t.Errorf("token = %q, want it untouched", value)
+	}
+}
+
+func TestMappingFor(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		want       []FieldRef
+		wantErr    bool
+	}{
+		{"field defaults to key", "password=apps/db", []FieldRef{{Key: "password", Path: "apps/db"}}, false},
+		{"several entries", "user=apps/db#username, pass=apps/db#password", []FieldRef{
+			{Key: "user", Path: "apps/db", Field: "username"},
+			{Key: "pass", Path: "apps/db", Field: "password"},
+		}, false},
+		{"missing path", "password", nil, true},
+		{"duplicate key", "a=x,a=y", nil, true},
+		{"invalid key", "a b=x", nil, true},
+		{"parent segment", "a=apps/../sys", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping, err := MappingFor(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+				Name:        "db",
+				Namespace:   "default",
+				Annotations: map[string]string{DataAnnotation: tt.annotation},
+			}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MappingFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(mapping.Data) != len(tt.want) {
+				t.Fatalf("MappingFor() data = %+v, want %+v", mapping.Data, tt.want)
+			}
+			for i := range tt.want {
+				if mapping.Data[i] != tt.want[i] {
+					t.Errorf("MappingFor() data[%d] = %+v, want %+v", i, mapping.Data[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
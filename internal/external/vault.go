@@ -0,0 +1,156 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+)
+
+// maxResponseSize caps the body read from the KV API
+const maxResponseSize = 1 << 20
+
+// VaultOptions configure a Vault provider
+type VaultOptions struct {
+	// Address is the base URL of the server, e.g. https://vault:8200
+	Address string
+	Token   string
+	// Mount is the path the KV engine is mounted at, "secret" by default
+	Mount string
+	// KVVersion is the version of the KV engine, 1 or 2 (the default)
+	KVVersion int
+	// Namespace is sent as X-Vault-Namespace when set
+	Namespace string
+	Timeout   time.Duration
+}
+
+// Vault reads a KV secrets engine over the Vault HTTP API
+type Vault struct {
+	address   string
+	token     string
+	mount     string
+	version   int
+	namespace string
+	client    *http.Client
+}
+
+func NewVault(opts VaultOptions) (*Vault, error) {
+	address, err := url.Parse(opts.Address)
+	if err != nil || (address.Scheme != "http" && address.Scheme != "https") || address.Host == "" {
+		return nil, fmt.Errorf("invalid vault address %q", opts.Address)
+	}
+
+	v := &Vault{
+		address:   strings.TrimRight(opts.Address, "/"),
+		token:     opts.Token,
+		mount:     strings.Trim(opts.Mount, "/"),
+		version:   opts.KVVersion,
+		namespace: opts.Namespace,
+		client:    &http.Client{Timeout: opts.Timeout},
+	}
+	if v.mount == "" {
+		v.mount = "secret"
+	}
+	if v.version == 0 {
+		v.version = 2
+	}
+	if v.version != 1 && v.version != 2 {
+		return nil, fmt.Errorf("unsupported KV version %d", opts.KVVersion)
+	}
+	if v.client.Timeout == 0 {
+		v.client.Timeout = 30 * time.Second
+	}
+	return v, nil
+}
+
+// Read returns the fields of the latest version stored at path. Values that
+// are not strings are returned as JSON.
+func (v *Vault) Read(ctx context.Context, path string) (map[string]string, error) {
+	if err := ValidatePath(path); err != nil {
+		return nil, err
+	}
+	path = strings.Trim(path, "/")
+
+	endpoint := v.address + "/v1/" + v.mount + "/"
+	if v.version == 2 {
+		endpoint += "data/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	endpoint += strings.Join(segments, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.CodeUnavailable, "error reading "+path, err)
+	}
+	defer resp.Body.Close()
+
+	var payload struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []string        `json:"errors"`
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.CodeUnavailable, "error reading "+path, err)
+	}
+	json.Unmarshal(body, &payload)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, apperrors.New(apperrors.CodeNotFound, fmt.Sprintf("path %s not found", path))
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, apperrors.New(apperrors.CodeForbidden, fmt.Sprintf("access to path %s denied", path))
+	default:
+		return nil, apperrors.New(apperrors.CodeUnavailable,
+			fmt.Sprintf("error reading %s: status %d: %s", path, resp.StatusCode, strings.Join(payload.Errors, ", ")))
+	}
+
+	data := payload.Data
+	if v.version == 2 {
+		var versioned struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &versioned); err != nil {
+			return nil, fmt.Errorf("error decoding %s: %w", path, err)
+		}
+		data = versioned.Data
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("error decoding %s: %w", path, err)
+	}
+	if fields == nil {
+		// KV v2 answers null data for a deleted version
+		return nil, apperrors.New(apperrors.CodeNotFound, fmt.Sprintf("path %s not found", path))
+	}
+
+	values := make(map[string]string, len(fields))
+	for field, raw := range fields {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			values[field] = s
+			continue
+		}
+		values[field] = string(raw)
+	}
+	return values, nil
+}
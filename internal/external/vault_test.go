@@ -0,0 +1,163 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+)
+
+const testToken = "s.test"
+
+// kvServer is a stand-in for the KV API of a Vault server with the engine
+// mounted at "secret"
+type kvServer struct {
+	*httptest.Server
+	version int
+
+	mu    sync.Mutex
+	data  map[string]map[string]interface{}
+	reads int
+}
+
+func newKVServer(t *testing.T, version int, data map[string]map[string]interface{}) *kvServer {
+	t.Helper()
+
+	kv := &kvServer{version: version, data: data}
+	kv.Server = httptest.NewServer(http.HandlerFunc(kv.serve))
+	t.Cleanup(kv.Close)
+	return kv
+}
+
+func (kv *kvServer) set(path string, fields map[string]interface{}) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.data[path] = fields
+}
+
+func (kv *kvServer) serve(w http.ResponseWriter, r *http.Request) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.reads++
+
+	if r.Header.Get("X-Vault-Token") != testToken {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+		return
+	}
+
+	prefix := "/v1/secret/"
+	if kv.version == 2 {
+		prefix += "data/"
+	}
+	fields, ok := kv.data[strings.TrimPrefix(r.URL.Path, prefix)]
+	if !strings.HasPrefix(r.URL.Path, prefix) || !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string][]string{"errors": {}})
+		return
+	}
+
+	var data interface{} = fields
+	if kv.version == 2 {
+		data = map[string]interface{}{"data": fields, "metadata": map[string]interface{}{"version": 1}}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func TestVault_Read(t *testing.T) {
+	data := map[string]map[string]interface{}{
+		"apps/db": {"username": "admin", "port": 5432, "tls": map[string]interface{}{"enabled": true}},
+	}
+
+	tests := []struct {
+		name     string
+		version  int
+		token    string
+		path     string
+		want     map[string]string
+		wantCode string
+	}{
+		{
+			name:    "kv v2",
+			version: 2,
+			token:   testToken,
+			path:    "apps/db",
+			want:    map[string]string{"username": "admin", "port": "5432", "tls": `{"enabled":true}`},
+		},
+		{
+			name:    "kv v1",
+			version: 1,
+			token:   testToken,
+			path:    "/apps/db/",
+			want:    map[string]string{"username": "admin", "port": "5432", "tls": `{"enabled":true}`},
+		},
+		{
+			name:     "missing path",
+			version:  2,
+			token:    testToken,
+			path:     "apps/api",
+			wantCode: apperrors.CodeNotFound,
+		},
+		{
+			name:     "parent segment",
+			version:  2,
+			token:    testToken,
+			path:     "apps/../sys/db",
+			wantCode: apperrors.CodeInvalid,
+		},
+		{
+			name:     "empty segment",
+			version:  2,
+			token:    testToken,
+			path:     "apps//db",
+			wantCode: apperrors.CodeInvalid,
+		},
+		{
+			name:     "invalid token",
+			version:  2,
+			token:    "s.other",
+			path:     "apps/db",
+			wantCode: apperrors.CodeForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kv := newKVServer(t, tt.version, data)
+			vault, err := NewVault(VaultOptions{Address: kv.URL, Token: tt.token, KVVersion: tt.version})
+			if err != nil {
+				t.Fatalf("NewVault() error = %v", err)
+			}
+
+			got, err := vault.Read(context.TODO(), tt.path)
+			if tt.wantCode != "" {
+				if apperrors.CodeOf(err) != tt.wantCode {
+					t.Errorf("Read() error = %v, want %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			for key, value := range tt.want {
+				if got[key] != value {
+					t.Errorf("Read()[%s] = %q, want %q", key, got[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestNewVault(t *testing.T) {
+	if _, err := NewVault(VaultOptions{Address: "vault:8200"}); err == nil {
+		t.Error("NewVault() accepted an address without scheme")
+	}
+	if _, err := NewVault(VaultOptions{Address: "https://vault:8200", KVVersion: 3}); err == nil {
+		t.Error("NewVault() accepted KV version 3")
+	}
+}
@@ -0,0 +1,333 @@
+package generate
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var builtins = map[string]Generator{
+	"password":         GeneratorFunc(generatePassword),
+	"token":            GeneratorFunc(generateToken),
+	"rsa":              GeneratorFunc(generateRSA),
+	"ecdsa":            GeneratorFunc(generateECDSA),
+	"self-signed-cert": GeneratorFunc(generateSelfSignedCert),
+	"uuid":             GeneratorFunc(generateUUID),
+	"ssh-keypair":      GeneratorFunc(generateSSHKeyPair),
+	"htpasswd":         GeneratorFunc(generateHtpasswd),
+}
+
+var charsets = map[string]string{
+	"alphanumeric": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"ascii":        "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!#$%&()*+,-./:;<=>?@[]^_{|}~",
+	"hex":          "0123456789abcdef",
+	"numeric":      "0123456789",
+}
+
+func invalid(format string, args ...interface{}) error {
+	return apperrors.New(apperrors.CodeInvalid, fmt.Sprintf(format, args...))
+}
+
+// generatePassword returns a random password. Params: key (password),
+// length (32), charset (alphanumeric, ascii, hex or numeric).
+func generatePassword(params Params) (map[string][]byte, error) {
+	length, err := params.Int("length", 32)
+	if err != nil {
+		return nil, err
+	}
+	if length < 8 || length > 4096 {
+		return nil, invalid("password length must be between 8 and 4096")
+	}
+	charset, ok := charsets[params.String("charset", "alphanumeric")]
+	if !ok {
+		return nil, invalid("unknown charset %s", params["charset"])
+	}
+
+	password, err := randomString(length, charset)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{params.String("key", "password"): []byte(password)}, nil
+}
+
+func randomString(length int, charset string) (string, error) {
+	max := big.NewInt(int64(len(charset)))
+	var b strings.Builder
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("error reading random bytes: %w", err)
+		}
+		b.WriteByte(charset[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// generateToken returns random bytes in text form. Params: key (token),
+// bytes (32), encoding (base64url, base64 or hex).
+func generateToken(params Params) (map[string][]byte, error) {
+	size, err := params.Int("bytes", 32)
+	if err != nil {
+		return nil, err
+	}
+	if size < 16 || size > 1024 {
+		return nil, invalid("token size must be between 16 and 1024 bytes")
+	}
+
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("error reading random bytes: %w", err)
+	}
+
+	var token string
+	switch encoding := params.String("encoding", "base64url"); encoding {
+	case "base64url":
+		token = base64.RawURLEncoding.EncodeToString(raw)
+	case "base64":
+		token = base64.StdEncoding.EncodeToString(raw)
+	case "hex":
+		token = hex.EncodeToString(raw)
+	default:
+		return nil, invalid("unknown token encoding %s", encoding)
+	}
+	return map[string][]byte{params.String("key", "token"): []byte(token)}, nil
+}
+
+// generateRSA returns a PKCS#8 private key and its public key, both PEM
+// encoded. Params: key (private.pem), publicKey (public.pem), bits (2048).
+func generateRSA(params Params) (map[string][]byte, error) {
+	key, err := rsaKey(params)
+	if err != nil {
+		return nil, err
+	}
+	return keyPair(params, key)
+}
+
+// generateECDSA works like generateRSA. Params: key, publicKey and curve
+// (P256, P384 or P521).
+func generateECDSA(params Params) (map[string][]byte, error) {
+	key, err := ecdsaKey(params)
+	if err != nil {
+		return nil, err
+	}
+	return keyPair(params, key)
+}
+
+func rsaKey(params Params) (crypto.Signer, error) {
+	bits, err := params.Int("bits", 2048)
+	if err != nil {
+		return nil, err
+	}
+	if bits < 2048 || bits > 8192 {
+		return nil, invalid("rsa key size must be between 2048 and 8192 bits")
+	}
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, fmt.Errorf("error generating rsa key: %w", err)
+	}
+	return key, nil
+}
+
+func ecdsaKey(params Params) (crypto.Signer, error) {
+	var curve elliptic.Curve
+	switch name := params.String("curve", "P256"); name {
+	case "P256":
+		curve = elliptic.P256()
+	case "P384":
+		curve = elliptic.P384()
+	case "P521":
+		curve = elliptic.P521()
+	default:
+		return nil, invalid("unknown curve %s", name)
+	}
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating ecdsa key: %w", err)
+	}
+	return key, nil
+}
+
+func keyPair(params Params, key crypto.Signer) (map[string][]byte, error) {
+	private, err := encodePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, fmt.Errorf("error encoding public key: %w", err)
+	}
+	return map[string][]byte{
+		params.String("key", "private.pem"):      private,
+		params.String("publicKey", "public.pem"): pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}),
+	}, nil
+}
+
+func encodePrivateKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// generateSelfSignedCert returns tls.crt and tls.key. Params: commonName
+// (localhost), hosts (semicolon separated DNS names and IPs, defaults to the
+// common name), validity (8760h), keyAlgorithm (ecdsa or rsa) and the
+// parameters of the key generator.
+func generateSelfSignedCert(params Params) (map[string][]byte, error) {
+	var key crypto.Signer
+	var err error
+	switch algorithm := params.String("keyAlgorithm", "ecdsa"); algorithm {
+	case "ecdsa":
+		key, err = ecdsaKey(params)
+	case "rsa":
+		key, err = rsaKey(params)
+	default:
+		return nil, invalid("unknown key algorithm %s", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	validity, err := time.ParseDuration(params.String("validity", "8760h"))
+	if err != nil || validity <= 0 {
+		return nil, invalid("validity must be a positive duration")
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("error generating serial number: %w", err)
+	}
+
+	commonName := params.String("commonName", "localhost")
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range strings.Split(params.String("hosts", commonName), ";") {
+		if host = strings.TrimSpace(host); host == "" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate: %w", err)
+	}
+	private, err := encodePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		corev1.TLSCertKey:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		corev1.TLSPrivateKeyKey: private,
+	}, nil
+}
+
+// generateUUID returns a random (version 4) UUID. Params: key (uuid).
+func generateUUID(params Params) (map[string][]byte, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("error generating uuid: %w", err)
+	}
+	return map[string][]byte{params.String("key", "uuid"): []byte(id.String())}, nil
+}
+
+// generateSSHKeyPair returns an OpenSSH private key and its authorized_keys
+// line. Params: key (ssh-privatekey), publicKey (ssh-publickey), type
+// (ed25519 or rsa), bits (for rsa) and comment.
+func generateSSHKeyPair(params Params) (map[string][]byte, error) {
+	var key crypto.Signer
+	var err error
+	switch keyType := params.String("type", "ed25519"); keyType {
+	case "ed25519":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("error generating ed25519 key: %w", err)
+		}
+	case "rsa":
+		key, err = rsaKey(params)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, invalid("unknown ssh key type %s", keyType)
+	}
+
+	comment := params.String("comment", "")
+	block, err := ssh.MarshalPrivateKey(key, comment)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding ssh private key: %w", err)
+	}
+	public, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		return nil, fmt.Errorf("error encoding ssh public key: %w", err)
+	}
+	authorized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(public)))
+	if comment != "" {
+		authorized += " " + comment
+	}
+
+	return map[string][]byte{
+		params.String("key", corev1.SSHAuthPrivateKey): pem.EncodeToMemory(block),
+		params.String("publicKey", "ssh-publickey"):    []byte(authorized + "\n"),
+	}, nil
+}
+
+// generateHtpasswd returns a bcrypt htpasswd line and the password it was
+// made from. Params: username (required), password (generated when empty),
+// key (auth), passwordKey (password), length and charset of the generated
+// password.
+func generateHtpasswd(params Params) (map[string][]byte, error) {
+	username := params.String("username", "")
+	if username == "" || strings.Contains(username, ":") {
+		return nil, invalid("htpasswd requires a username without colons")
+	}
+
+	password := params.String("password", "")
+	if password == "" {
+		generated, err := generatePassword(Params{"length": params["length"], "charset": params["charset"]})
+		if err != nil {
+			return nil, err
+		}
+		password = string(generated["password"])
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing password: %w", err)
+	}
+	return map[string][]byte{
+		params.String("key", "auth"):             []byte(username + ":" + string(hash) + "\n"),
+		params.String("passwordKey", "password"): []byte(password),
+	}, nil
+}
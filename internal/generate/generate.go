@@ -0,0 +1,113 @@
+// Package generate produces fresh secret values such as passwords, tokens,
+// private keys and certificates.
+package generate
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+)
+
+// Params configure a generator, e.g. length=32
+type Params map[string]string
+
+// Generator produces new values for the keys of a secret
+type Generator interface {
+	Generate(params Params) (map[string][]byte, error)
+}
+
+// GeneratorFunc lets a plain function act as a Generator
+type GeneratorFunc func(params Params) (map[string][]byte, error)
+
+func (f GeneratorFunc) Generate(params Params) (map[string][]byte, error) {
+	return f(params)
+}
+
+// Registry maps generator names to generators
+type Registry struct {
+	mu         sync.RWMutex
+	generators map[string]Generator
+}
+
+// NewRegistry returns a registry holding the built-in generators
+func NewRegistry() *Registry {
+	r := &Registry{generators: make(map[string]Generator)}
+	for name, generator := range builtins {
+		r.Register(name, generator)
+	}
+	return r
+}
+
+// Register adds a generator, replacing any generator of the same name
+func (r *Registry) Register(name string, generator Generator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generators[name] = generator
+}
+
+// Get returns the generator registered under name
+func (r *Registry) Get(name string) (Generator, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	generator, ok := r.generators[name]
+	if !ok {
+		return nil, apperrors.New(apperrors.CodeInvalid, fmt.Sprintf("unknown generator %s", name))
+	}
+	return generator, nil
+}
+
+// Names returns the registered generator names, sorted
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.generators))
+	for name := range r.generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseParams parses comma separated key=value pairs
+func ParseParams(s string) (Params, error) {
+	params := make(Params)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, apperrors.New(apperrors.CodeInvalid, fmt.Sprintf("invalid generator parameter %q, expected key=value", pair))
+		}
+		params[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return params, nil
+}
+
+// String returns the parameter name, or def when it is not set
+func (p Params) String(name, def string) string {
+	if value, ok := p[name]; ok && value != "" {
+		return value
+	}
+	return def
+}
+
+// Int returns the parameter name as an integer, or def when it is not set
+func (p Params) Int(name string, def int) (int, error) {
+	value, ok := p[name]
+	if !ok || value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, apperrors.New(apperrors.CodeInvalid, fmt.Sprintf("parameter %s must be an integer", name))
+	}
+	return n, nil
+}
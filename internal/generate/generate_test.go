@@ -0,0 +1,311 @@
+package generate
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestBuiltins(t *testing.T) {
+	registry := NewRegistry()
+
+	tests := []struct {
+		name      string
+		generator string
+		params    string
+		check     func(t *testing.T, values map[string][]byte)
+		wantCode  string
+	}{
+		{
+			name:      "password",
+			generator: "password",
+			params:    "length=24,charset=numeric,key=db-password",
+			check: func(t *testing.T, values map[string][]byte) {
+				password := string(values["db-password"])
+				if len(password) != 24 || strings.Trim(password, "0123456789") != "" {
+					t.Errorf("password = %q, want 24 digits", password)
+				}
+			},
+		},
+		{
+			name:      "password too short",
+			generator: "password",
+			params:    "length=4",
+			wantCode:  apperrors.CodeInvalid,
+		},
+		{
+			name:      "hex token",
+			generator: "token",
+			params:    "bytes=16,encoding=hex",
+			check: func(t *testing.T, values map[string][]byte) {
+				if len(values["token"]) != 32 {
+					t.Errorf("token = %q, want 32 hex characters", values["token"])
+				}
+			},
+		},
+		{
+			name:      "rsa key",
+			generator: "rsa",
+			params:    "key=ssh-privatekey",
+			check: func(t *testing.T, values map[string][]byte) {
+				block, _ := pem.Decode(values["ssh-privatekey"])
+				if block == nil {
+					t.Fatal("private key is not PEM encoded")
+				}
+				if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+					t.Errorf("error parsing private key: %v", err)
+				}
+				if _, ok := values["public.pem"]; !ok {
+					t.Error("public key missing")
+				}
+			},
+		},
+		{
+			name:      "unknown curve",
+			generator: "ecdsa",
+			params:    "curve=P224",
+			wantCode:  apperrors.CodeInvalid,
+		},
+		{
+			name:      "self-signed certificate",
+			generator: "self-signed-cert",
+			params:    "commonName=api.example.com,hosts=api.example.com;10.0.0.1,validity=24h",
+			check: func(t *testing.T, values map[string][]byte) {
+				pair, err := tls.X509KeyPair(values["tls.crt"], values["tls.key"])
+				if err != nil {
+					t.Fatalf("invalid key pair: %v", err)
+				}
+				cert, _ := x509.ParseCertificate(pair.Certificate[0])
+				if err := cert.VerifyHostname("10.0.0.1"); err != nil {
+					t.Errorf("certificate does not cover 10.0.0.1: %v", err)
+				}
+			},
+		},
+		{
+			name:      "uuid",
+			generator: "uuid",
+			check: func(t *testing.T, values map[string][]byte) {
+				if _, err := uuid.ParseBytes(values["uuid"]); err != nil {
+					t.Errorf("uuid = %q: %v", values["uuid"], err)
+				}
+			},
+		},
+		{
+			name:      "ed25519 ssh key pair",
+			generator: "ssh-keypair",
+			params:    "comment=deploy@ci",
+			check: func(t *testing.T, values map[string][]byte) {
+				signer, err := ssh.ParsePrivateKey(values["ssh-privatekey"])
+				if err != nil {
+					t.Fatalf("error parsing private key: %v", err)
+				}
+				public, comment, _, _, err := ssh.ParseAuthorizedKey(values["ssh-publickey"])
+				if err != nil || comment != "deploy@ci" || public.Type() != ssh.KeyAlgoED25519 {
+					t.Errorf("public key = %q: %v", values["ssh-publickey"], err)
+				}
+				if string(signer.PublicKey().Marshal()) != string(public.Marshal()) {
+					t.Error("public key does not match the private key")
+				}
+			},
+		},
+		{
+			name:      "htpasswd",
+			generator: "htpasswd",
+			params:    "username=admin",
+			check: func(t *testing.T, values map[string][]byte) {
+				user, hash, _ := strings.Cut(strings.TrimSpace(string(values["auth"])), ":")
+				if user != "admin" || bcrypt.CompareHashAndPassword([]byte(hash), values["password"]) != nil {
+					t.Errorf("auth = %q does not match password %q", values["auth"], values["password"])
+				}
+			},
+		},
+		{
+			name:      "htpasswd without username",
+			generator: "htpasswd",
+			wantCode:  apperrors.CodeInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator, err := registry.Get(tt.generator)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			params, err := ParseParams(tt.params)
+			if err != nil {
+				t.Fatalf("ParseParams() error = %v", err)
+			}
+
+			values, err := generator.Generate(params)
+			if tt.wantCode != "" {
+				if apperrors.CodeOf(err) != tt.wantCode {
+					t.Errorf("Generate() error = %v, want %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			tt.check(t, values)
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("static", GeneratorFunc(func(params Params) (map[string][]byte, error) {
+		return map[string][]byte{"value": []byte("static")}, nil
+	}))
+
+	if _, err := registry.Get("static"); err != nil {
+		t.Errorf("Get() of a registered generator error = %v", err)
+	}
+	if _, err := registry.Get("missing"); apperrors.CodeOf(err) != apperrors.CodeInvalid {
+		t.Errorf("Get() of an unknown generator error = %v, want %s", err, apperrors.CodeInvalid)
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("keep")},
+	})
+	manager := k8s.NewClientForClientset(clientset)
+	registry := NewRegistry()
+
+	tests := []struct {
+		name        string
+		req         Request
+		wantCreated bool
+		wantKeys    []string
+		wantCode    string
+	}{
+		{
+			name: "create",
+			req: Request{Name: "new", Generators: []Spec{
+				{Generator: "password", Params: Params{"key": "db-password"}},
+				{Generator: "uuid"},
+			}},
+			wantCreated: true,
+			wantKeys:    []string{"db-password", "uuid"},
+		},
+		{
+			name:     "extend",
+			req:      Request{Name: "existing", Generators: []Spec{{Generator: "token"}}},
+			wantKeys: []string{"token"},
+		},
+		{
+			name:     "existing key",
+			req:      Request{Name: "existing", Generators: []Spec{{Generator: "password"}}},
+			wantCode: apperrors.CodeAlreadyExists,
+		},
+		{
+			name: "typed secret is validated",
+			req: Request{Name: "ssh", Type: string(corev1.SecretTypeSSHAuth), Generators: []Spec{
+				{Generator: "token"},
+			}},
+			wantCode: apperrors.CodeInvalid,
+		},
+		{
+			name: "ssh-auth secret",
+			req: Request{Name: "ssh", Type: string(corev1.SecretTypeSSHAuth), Generators: []Spec{
+				{Generator: "ssh-keypair"},
+			}},
+			wantCreated: true,
+			wantKeys:    []string{"ssh-privatekey", "ssh-publickey"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Namespace = "default"
+			result, err := registry.GenerateSecret(context.TODO(), manager, &tt.req)
+			if tt.wantCode != "" {
+				if apperrors.CodeOf(err) != tt.wantCode {
+					t.Errorf("GenerateSecret() error = %v, want %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateSecret() error = %v", err)
+			}
+			if result.Created != tt.wantCreated || strings.Join(result.Keys, ",") != strings.Join(tt.wantKeys, ",") {
+				t.Errorf("GenerateSecret() = created %v, keys %v", result.Created, result.Keys)
+			}
+
+			var metadata map[string]KeyMetadata
+			if err := json.Unmarshal([]byte(result.Secret.Annotations[GeneratedAnnotation]), &metadata); err != nil {
+				t.Fatalf("error decoding %s: %v", GeneratedAnnotation, err)
+			}
+			for _, key := range tt.wantKeys {
+				if metadata[key].GeneratedAt.IsZero() {
+					t.Errorf("no generated metadata for key %s: %v", key, metadata)
+				}
+			}
+		})
+	}
+
+	existing, _ := manager.GetSecret(context.TODO(), "default", "existing")
+	if string(existing.Data["password"]) != "keep" {
+		t.Errorf("existing key was overwritten: %q", existing.Data["password"])
+	}
+}
+
+func TestGenerateSecret_Cache(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default", ResourceVersion: "1"},
+		Data:       map[string][]byte{"password": []byte("keep")},
+	})
+	// The fake clientset does not assign versions
+	version := 1
+	clientset.PrependReactor("*", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if write, ok := action.(interface{ GetObject() runtime.Object }); ok {
+			version++
+			write.GetObject().(*corev1.Secret).ResourceVersion = strconv.Itoa(version)
+		}
+		return false, nil, nil
+	})
+	manager := k8s.NewClientForClientset(clientset)
+
+	// A cache that stops after its initial sync never sees the writes
+	ctx, cancel := context.WithCancel(context.Background())
+	manager.EnableCache(ctx, k8s.CacheOptions{})
+	if !manager.WaitForCacheSync(ctx) {
+		t.Fatal("cache did not sync")
+	}
+	cancel()
+
+	registry := NewRegistry()
+	for _, name := range []string{"new", "existing"} {
+		req := &Request{Namespace: "default", Name: name, Generators: []Spec{{Generator: "token"}}}
+		result, err := registry.GenerateSecret(context.TODO(), manager, req)
+		if err != nil {
+			t.Fatalf("GenerateSecret(%s) error = %v", name, err)
+		}
+
+		live, err := clientset.CoreV1().Secrets("default").Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Secret.ResourceVersion != live.ResourceVersion || string(result.Secret.Data["token"]) != string(live.Data["token"]) {
+			t.Errorf("GenerateSecret(%s) = %+v, want the written secret %+v", name, result.Secret, live)
+		}
+	}
+}
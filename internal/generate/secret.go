@@ -0,0 +1,161 @@
+package generate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/validator"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GeneratedAnnotation records, per generated key, how and when it was
+// generated as a JSON object
+const GeneratedAnnotation = "secrets-manager.io/generated"
+
+// Spec asks a generator for values
+type Spec struct {
+	Generator string `json:"generator"`
+	Params    Params `json:"params,omitempty"`
+}
+
+// Request creates a secret, or extends an existing one, with generated keys
+type Request struct {
+	Namespace string `json:"-"`
+	Name      string `json:"-"`
+	// Type of the secret when it is created, Opaque by default
+	Type       string `json:"type,omitempty"`
+	Generators []Spec `json:"generators"`
+	// Overwrite allows replacing keys the secret already has
+	Overwrite bool `json:"overwrite,omitempty"`
+}
+
+// Result describes a completed Request
+type Result struct {
+	Created bool
+	// Keys are the generated keys, sorted
+	Keys   []string
+	Secret *corev1.Secret
+}
+
+// KeyMetadata is the GeneratedAnnotation entry of a key
+type KeyMetadata struct {
+	Generator   string    `json:"generator"`
+	Params      Params    `json:"params,omitempty"`
+	GeneratedAt time.Time `json:"generatedAt"`
+}
+
+// sensitiveParams are not copied into GeneratedAnnotation
+var sensitiveParams = map[string]bool{"password": true}
+
+// GenerateSecret runs the generators of req and stores their values through
+// manager. The secret passes the validator like any other write, so e.g.
+// generating ssh-privatekey into a kubernetes.io/ssh-auth secret is checked.
+func (r *Registry) GenerateSecret(ctx context.Context, manager k8s.SecretManager, req *Request) (*Result, error) {
+	if len(req.Generators) == 0 {
+		return nil, &k8s.ValidationError{Field: "generators", Message: "at least one generator is required"}
+	}
+
+	existing, err := manager.GetSecret(ctx, req.Namespace, req.Name)
+	created := apperrors.CodeOf(err) == apperrors.CodeNotFound
+	if err != nil && !created {
+		return nil, err
+	}
+
+	var data *k8s.SecretData
+	if created {
+		secretType := req.Type
+		if secretType == "" {
+			secretType = string(corev1.SecretTypeOpaque)
+		}
+		data = &k8s.SecretData{Name: req.Name, Namespace: req.Namespace, Type: secretType}
+	} else {
+		if req.Type != "" && corev1.SecretType(req.Type) != existing.Type {
+			return nil, &k8s.ValidationError{Field: "type", Message: fmt.Sprintf("secret %s already exists with type %s", req.Name, existing.Type)}
+		}
+		data = k8s.NewSecretData(existing)
+	}
+
+	metadata := make(map[string]KeyMetadata)
+	if raw := data.Annotations[GeneratedAnnotation]; raw != "" {
+		// An unreadable annotation is replaced rather than failing the write
+		json.Unmarshal([]byte(raw), &metadata)
+	}
+
+	current := data.Values()
+	now := time.Now().UTC().Truncate(time.Second)
+	var keys []string
+	for _, spec := range req.Generators {
+		generator, err := r.Get(spec.Generator)
+		if err != nil {
+			return nil, err
+		}
+		values, err := generator.Generate(spec.Params)
+		if err != nil {
+			return nil, err
+		}
+
+		for key, value := range values {
+			if _, exists := current[key]; exists && !req.Overwrite {
+				return nil, apperrors.New(apperrors.CodeAlreadyExists, fmt.Sprintf("key %s already exists in secret %s", key, req.Name))
+			}
+			current[key] = value
+			data.Set(key, value)
+			keys = append(keys, key)
+			metadata[key] = KeyMetadata{Generator: spec.Generator, Params: recordedParams(spec.Params), GeneratedAt: now}
+		}
+	}
+	sort.Strings(keys)
+
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding generated metadata: %w", err)
+	}
+	if data.Annotations == nil {
+		data.Annotations = make(map[string]string)
+	}
+	data.Annotations[GeneratedAnnotation] = string(encoded)
+
+	if err := validator.ValidateSecretData(data); err != nil {
+		return nil, err
+	}
+	if created {
+		err = manager.CreateSecret(ctx, data)
+	} else {
+		err = manager.UpdateSecret(ctx, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Reading the secret back could be answered by a cache that has not
+	// seen the write yet
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: req.Name, Namespace: req.Namespace}}
+	if !created {
+		secret = existing.DeepCopy()
+	}
+	if err := k8s.ApplySecretData(secret, data); err != nil {
+		return nil, err
+	}
+	secret.ResourceVersion = data.ResourceVersion
+	return &Result{Created: created, Keys: keys, Secret: secret}, nil
+}
+
+func recordedParams(params Params) Params {
+	var recorded Params
+	for key, value := range params {
+		if sensitiveParams[key] {
+			continue
+		}
+		if recorded == nil {
+			recorded = make(Params)
+		}
+		recorded[key] = value
+	}
+	return recorded
+}
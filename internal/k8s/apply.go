@@ -0,0 +1,61 @@
+package k8s
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+)
+
+// Applier is implemented by managers that can write secrets with
+// server-side apply
+type Applier interface {
+	ApplySecret(ctx context.Context, data *SecretData, fieldManager string) error
+}
+
+// ApplySecret creates or updates a secret with server-side apply as
+// fieldManager, taking over fields other managers own. Keys, labels and
+// annotations fieldManager applied before and data no longer holds are
+// removed. The replaced version is recorded in the history like on update.
+func (c *Client) ApplySecret(ctx context.Context, data *SecretData, fieldManager string) error {
+	config := corev1ac.Secret(data.Name, data.Namespace).
+		WithLabels(data.Labels).
+		WithAnnotations(data.Annotations).
+		WithData(data.Values())
+	if data.Type != "" {
+		config.WithType(corev1.SecretType(data.Type))
+	}
+	if data.Immutable {
+		config.WithImmutable(true)
+	}
+
+	var recorded string
+	existing, err := c.clientset.CoreV1().Secrets(data.Namespace).Get(ctx, data.Name, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		if recorded, err = c.recordRevision(ctx, existing); err != nil {
+			return err
+		}
+	case !errors.IsNotFound(err):
+		return secretError(err, data.Namespace, data.Name, "getting")
+	}
+
+	applied, err := c.clientset.CoreV1().Secrets(data.Namespace).Apply(ctx, config, metav1.ApplyOptions{
+		FieldManager: fieldManager,
+		Force:        true,
+	})
+	if err != nil {
+		if recorded != "" {
+			c.clientset.CoreV1().Secrets(data.Namespace).Delete(ctx, recorded, metav1.DeleteOptions{})
+		}
+		return secretError(err, data.Namespace, data.Name, "applying")
+	}
+
+	if recorded != "" {
+		c.pruneRevisions(ctx, applied)
+	}
+	data.ResourceVersion = applied.ResourceVersion
+	return nil
+}
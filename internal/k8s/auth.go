@@ -0,0 +1,36 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TokenReviewer is implemented by managers that can validate bearer tokens
+// with the TokenReview API
+type TokenReviewer interface {
+	ReviewToken(ctx context.Context, token string, audiences []string) (*authenticationv1.UserInfo, error)
+}
+
+// ReviewToken asks the API server who token belongs to. A token it does
+// not accept yields an Unauthorized error.
+func (c *Client) ReviewToken(ctx context.Context, token string, audiences []string) (*authenticationv1.UserInfo, error) {
+	review, err := c.clientset.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token, Audiences: audiences},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.CodeOf(err), "error reviewing token", err)
+	}
+
+	if !review.Status.Authenticated {
+		message := "token is not valid"
+		if review.Status.Error != "" {
+			message = fmt.Sprintf("token is not valid: %s", review.Status.Error)
+		}
+		return nil, apperrors.New(apperrors.CodeUnauthorized, message)
+	}
+	return &review.Status.User, nil
+}
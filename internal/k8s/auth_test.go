@@ -0,0 +1,38 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestClient_ReviewToken(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token == "valid" {
+			review.Status = authenticationv1.TokenReviewStatus{
+				Authenticated: true,
+				User:          authenticationv1.UserInfo{Username: "system:serviceaccount:ci:deployer"},
+			}
+		} else {
+			review.Status = authenticationv1.TokenReviewStatus{Error: "invalid bearer token"}
+		}
+		return true, review, nil
+	})
+	client := &Client{clientset: clientset}
+
+	user, err := client.ReviewToken(context.TODO(), "valid", nil)
+	if err != nil || user.Username != "system:serviceaccount:ci:deployer" {
+		t.Errorf("ReviewToken() = %v, %v", user, err)
+	}
+
+	if _, err := client.ReviewToken(context.TODO(), "other", nil); apperrors.CodeOf(err) != apperrors.CodeUnauthorized {
+		t.Errorf("ReviewToken() of an invalid token error = %v, want %s", err, apperrors.CodeUnauthorized)
+	}
+}
@@ -0,0 +1,185 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// AccessReviewer is implemented by managers that can check the permissions
+// of a user with the SubjectAccessReview API
+type AccessReviewer interface {
+	ReviewAccess(ctx context.Context, user authenticationv1.UserInfo, attributes authorizationv1.ResourceAttributes) error
+}
+
+// Impersonator is implemented by managers that can act as another user, so
+// that the API server enforces the RBAC rules of that user
+type Impersonator interface {
+	Impersonate(user authenticationv1.UserInfo) (SecretManager, error)
+}
+
+// ReviewAccess asks the API server whether user may act on the resource
+// described by attributes. A denied request yields a Forbidden error.
+func (c *Client) ReviewAccess(ctx context.Context, user authenticationv1.UserInfo, attributes authorizationv1.ResourceAttributes) error {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+
+	review, err := c.clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &attributes,
+			User:               user.Username,
+			UID:                user.UID,
+			Groups:             user.Groups,
+			Extra:              extra,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return apperrors.Wrap(apperrors.CodeOf(err), "error reviewing access", err)
+	}
+
+	if !review.Status.Allowed {
+		message := fmt.Sprintf("user %s cannot %s %s", user.Username, attributes.Verb, attributes.Resource)
+		if attributes.Name != "" {
+			message += " " + attributes.Name
+		}
+		if attributes.Namespace != "" {
+			message += " in namespace " + attributes.Namespace
+		}
+		if review.Status.Reason != "" {
+			message += ": " + review.Status.Reason
+		}
+		return apperrors.New(apperrors.CodeForbidden, message)
+	}
+	return nil
+}
+
+// Impersonate returns a client acting as user. It shares the history of c
+// but not its cache, every read goes to the API server with the
+// permissions of user.
+func (c *Client) Impersonate(user authenticationv1.UserInfo) (SecretManager, error) {
+	if c.config == nil {
+		return nil, apperrors.New(apperrors.CodeNotImplemented, "impersonation requires a client built from a kubeconfig")
+	}
+
+	config := rest.CopyConfig(c.config)
+	config.Impersonate = rest.ImpersonationConfig{
+		UserName: user.Username,
+		UID:      user.UID,
+		Groups:   user.Groups,
+	}
+	if len(user.Extra) > 0 {
+		config.Impersonate.Extra = make(map[string][]string, len(user.Extra))
+		for key, value := range user.Extra {
+			config.Impersonate.Extra[key] = value
+		}
+	}
+
+	clientset, err := c.newClientset(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{clientset: clientset, history: c.history}, nil
+}
+
+// accessReviewManager checks every operation with a SubjectAccessReview
+// before handing it to the wrapped manager
+type accessReviewManager struct {
+	manager  SecretManager
+	reviewer AccessReviewer
+	user     authenticationv1.UserInfo
+}
+
+// NewAccessReviewManager wraps manager so that user may only do what the
+// SubjectAccessReviews of reviewer allow. Revisions are read with the get
+// and rolled back with the update permission of the secret.
+func NewAccessReviewManager(manager SecretManager, reviewer AccessReviewer, user authenticationv1.UserInfo) SecretManager {
+	return &accessReviewManager{manager: manager, reviewer: reviewer, user: user}
+}
+
+func (m *accessReviewManager) review(ctx context.Context, verb, namespace, name string) error {
+	return m.reviewer.ReviewAccess(ctx, m.user, authorizationv1.ResourceAttributes{
+		Verb:      verb,
+		Namespace: namespace,
+		Resource:  "secrets",
+		Version:   corev1.SchemeGroupVersion.Version,
+		Name:      name,
+	})
+}
+
+func (m *accessReviewManager) CreateSecret(ctx context.Context, data *SecretData) error {
+	if err := m.review(ctx, "create", data.Namespace, data.Name); err != nil {
+		return err
+	}
+	return m.manager.CreateSecret(ctx, data)
+}
+
+func (m *accessReviewManager) UpdateSecret(ctx context.Context, data *SecretData) error {
+	if err := m.review(ctx, "update", data.Namespace, data.Name); err != nil {
+		return err
+	}
+	return m.manager.UpdateSecret(ctx, data)
+}
+
+func (m *accessReviewManager) DeleteSecret(ctx context.Context, namespace, name string, opts ...DeleteOptions) error {
+	if err := m.review(ctx, "delete", namespace, name); err != nil {
+		return err
+	}
+	return m.manager.DeleteSecret(ctx, namespace, name, opts...)
+}
+
+func (m *accessReviewManager) PatchSecret(ctx context.Context, namespace, name string, patch *SecretPatch) (*corev1.Secret, error) {
+	if err := m.review(ctx, "patch", namespace, name); err != nil {
+		return nil, err
+	}
+	return m.manager.PatchSecret(ctx, namespace, name, patch)
+}
+
+func (m *accessReviewManager) GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	if err := m.review(ctx, "get", namespace, name); err != nil {
+		return nil, err
+	}
+	return m.manager.GetSecret(ctx, namespace, name)
+}
+
+func (m *accessReviewManager) GetSecretString(ctx context.Context, namespace, name, key string) (string, error) {
+	if err := m.review(ctx, "get", namespace, name); err != nil {
+		return "", err
+	}
+	return m.manager.GetSecretString(ctx, namespace, name, key)
+}
+
+func (m *accessReviewManager) ListSecrets(ctx context.Context, namespace string, opts ListOptions) (*SecretList, error) {
+	if err := m.review(ctx, "list", namespace, ""); err != nil {
+		return nil, err
+	}
+	return m.manager.ListSecrets(ctx, namespace, opts)
+}
+
+func (m *accessReviewManager) ListRevisions(ctx context.Context, namespace, name string) ([]Revision, error) {
+	if err := m.review(ctx, "get", namespace, name); err != nil {
+		return nil, err
+	}
+	return m.manager.ListRevisions(ctx, namespace, name)
+}
+
+func (m *accessReviewManager) GetRevision(ctx context.Context, namespace, name string, revision int64) (*Revision, error) {
+	if err := m.review(ctx, "get", namespace, name); err != nil {
+		return nil, err
+	}
+	return m.manager.GetRevision(ctx, namespace, name, revision)
+}
+
+func (m *accessReviewManager) Rollback(ctx context.Context, namespace, name string, revision int64) (*corev1.Secret, error) {
+	if err := m.review(ctx, "update", namespace, name); err != nil {
+		return nil, err
+	}
+	return m.manager.Rollback(ctx, namespace, name, revision)
+}
@@ -0,0 +1,119 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// allowed stands in for the RBAC rules of the tests: alice may read the
+// secrets of the ops namespace
+func allowed(user, verb, namespace string) bool {
+	return user == "alice" && namespace == "ops" && (verb == "get" || verb == "list")
+}
+
+func TestAccessReviewManager(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "ops"},
+		Data:       map[string][]byte{"password": []byte("s3cr3t")},
+	})
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attributes := review.Spec.ResourceAttributes
+		review.Status.Allowed = attributes.Resource == "secrets" && allowed(review.Spec.User, attributes.Verb, attributes.Namespace)
+		return true, review, nil
+	})
+	client := NewClientForClientset(clientset)
+
+	tests := []struct {
+		name     string
+		user     string
+		call     func(SecretManager) error
+		wantCode string
+	}{
+		{"get allowed", "alice", func(m SecretManager) error {
+			_, err := m.GetSecret(context.TODO(), "ops", "db")
+			return err
+		}, ""},
+		{"list allowed", "alice", func(m SecretManager) error {
+			_, err := m.ListSecrets(context.TODO(), "ops", ListOptions{})
+			return err
+		}, ""},
+		{"list all namespaces denied", "alice", func(m SecretManager) error {
+			_, err := m.ListSecrets(context.TODO(), "", ListOptions{})
+			return err
+		}, apperrors.CodeForbidden},
+		{"delete denied", "alice", func(m SecretManager) error {
+			return m.DeleteSecret(context.TODO(), "ops", "db")
+		}, apperrors.CodeForbidden},
+		{"get denied to other users", "bob", func(m SecretManager) error {
+			_, err := m.GetSecretString(context.TODO(), "ops", "db", "password")
+			return err
+		}, apperrors.CodeForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewAccessReviewManager(client, client, authenticationv1.UserInfo{Username: tt.user})
+			if err := tt.call(manager); apperrors.CodeOf(err) != tt.wantCode {
+				t.Errorf("error = %v, want code %q", err, tt.wantCode)
+			}
+		})
+	}
+
+	if _, err := clientset.CoreV1().Secrets("ops").Get(context.TODO(), "db", metav1.GetOptions{}); err != nil {
+		t.Errorf("denied delete removed the secret: %v", err)
+	}
+}
+
+func TestClient_Impersonate(t *testing.T) {
+	var impersonated rest.ImpersonationConfig
+	client := &Client{
+		config: &rest.Config{Host: "https://kubernetes.default.svc"},
+		newClientset: func(config *rest.Config) (kubernetes.Interface, error) {
+			impersonated = config.Impersonate
+			clientset := fake.NewSimpleClientset(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "ops"}})
+			// The API server enforces RBAC for the impersonated user
+			clientset.PrependReactor("*", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if allowed(config.Impersonate.UserName, action.GetVerb(), action.GetNamespace()) {
+					return false, nil, nil
+				}
+				return true, nil, errors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", nil)
+			})
+			return clientset, nil
+		},
+	}
+
+	manager, err := client.Impersonate(authenticationv1.UserInfo{Username: "alice", Groups: []string{"ops"}})
+	if err != nil {
+		t.Fatalf("Impersonate() error = %v", err)
+	}
+	if impersonated.UserName != "alice" || len(impersonated.Groups) != 1 {
+		t.Errorf("impersonation config = %+v", impersonated)
+	}
+	if _, err := manager.GetSecret(context.TODO(), "ops", "db"); err != nil {
+		t.Errorf("GetSecret() error = %v", err)
+	}
+	if err := manager.DeleteSecret(context.TODO(), "ops", "db"); apperrors.CodeOf(err) != apperrors.CodeForbidden {
+		t.Errorf("DeleteSecret() error = %v, want %s", err, apperrors.CodeForbidden)
+	}
+	if client.config.Impersonate.UserName != "" {
+		t.Error("Impersonate() changed the config of the client")
+	}
+
+	if _, err := NewClientForClientset(fake.NewSimpleClientset()).Impersonate(authenticationv1.UserInfo{Username: "alice"}); err == nil {
+		t.Error("Impersonate() without a REST config succeeded")
+	}
+}
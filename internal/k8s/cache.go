@@ -0,0 +1,137 @@
+package k8s
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// CacheOptions configures the informer-backed read cache
+type CacheOptions struct {
+	// Namespace limits the cache to a single namespace; empty caches all of them
+	Namespace    string
+	ResyncPeriod time.Duration
+}
+
+// CacheStats reports the state of the read cache and how often it was used
+type CacheStats struct {
+	Enabled   bool   `json:"enabled"`
+	Synced    bool   `json:"synced"`
+	Namespace string `json:"namespace,omitempty"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+}
+
+// CacheReporter is implemented by managers that can serve reads from a cache
+type CacheReporter interface {
+	CacheStats() CacheStats
+}
+
+type secretCache struct {
+	namespace string
+	informer  cache.SharedIndexInformer
+	lister    corelisters.SecretLister
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+}
+
+// EnableCache starts a shared informer for Secrets. Until it has synced, and
+// for namespaces outside its scope, reads keep going to the API server.
+// Writes, and the reads they are based on, always go to the API server. It
+// must be called before the client is shared between goroutines; the
+// informer stops when ctx is done.
+func (c *Client) EnableCache(ctx context.Context, opts CacheOptions) {
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		c.clientset,
+		opts.ResyncPeriod,
+		informers.WithNamespace(opts.Namespace),
+	)
+	secrets := factory.Core().V1().Secrets()
+
+	c.cache = &secretCache{
+		namespace: opts.Namespace,
+		informer:  secrets.Informer(),
+		lister:    secrets.Lister(),
+	}
+	factory.Start(ctx.Done())
+}
+
+// WaitForCacheSync blocks until the cache has synced or ctx is done
+func (c *Client) WaitForCacheSync(ctx context.Context) bool {
+	if c.cache == nil {
+		return false
+	}
+	return cache.WaitForCacheSync(ctx.Done(), c.cache.informer.HasSynced)
+}
+
+func (c *Client) CacheStats() CacheStats {
+	if c.cache == nil {
+		return CacheStats{}
+	}
+	return CacheStats{
+		Enabled:   true,
+		Synced:    c.cache.informer.HasSynced(),
+		Namespace: c.cache.namespace,
+		Hits:      c.cache.hits.Load(),
+		Misses:    c.cache.misses.Load(),
+	}
+}
+
+// serves reports whether reads for namespace can be answered from the cache,
+// recording a miss when the cache is enabled but cannot answer
+func (sc *secretCache) serves(namespace string) bool {
+	if sc == nil {
+		return false
+	}
+	if !sc.informer.HasSynced() || (sc.namespace != "" && sc.namespace != namespace) {
+		sc.misses.Add(1)
+		return false
+	}
+	sc.hits.Add(1)
+	return true
+}
+
+func (sc *secretCache) get(namespace, name string) (*corev1.Secret, error) {
+	secret, err := sc.lister.Secrets(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	// Lister objects are shared with the informer and must not be mutated
+	return secret.DeepCopy(), nil
+}
+
+func (sc *secretCache) list(namespace string, selector labels.Selector) ([]corev1.Secret, error) {
+	var (
+		secrets []*corev1.Secret
+		err     error
+	)
+	if namespace == "" {
+		secrets, err = sc.lister.List(selector)
+	} else {
+		secrets, err = sc.lister.Secrets(namespace).List(selector)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the API server's namespace/name ordering
+	sort.Slice(secrets, func(i, j int) bool {
+		if secrets[i].Namespace != secrets[j].Namespace {
+			return secrets[i].Namespace < secrets[j].Namespace
+		}
+		return secrets[i].Name < secrets[j].Name
+	})
+
+	items := make([]corev1.Secret, 0, len(secrets))
+	for _, secret := range secrets {
+		items = append(items, *secret.DeepCopy())
+	}
+	return items, nil
+}
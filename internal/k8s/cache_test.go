@@ -0,0 +1,244 @@
+package k8s
+
+import (
+	"context"
+	stderrors "errors"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newCachedClient(t *testing.T, cacheNamespace string, secrets ...*corev1.Secret) *Client {
+	t.Helper()
+
+	clientset := fake.NewSimpleClientset()
+	for _, secret := range secrets {
+		clientset.CoreV1().Secrets(secret.Namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	client := &Client{clientset: clientset}
+	client.EnableCache(ctx, CacheOptions{Namespace: cacheNamespace})
+
+	syncCtx, syncCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer syncCancel()
+	if !client.WaitForCacheSync(syncCtx) {
+		t.Fatal("cache did not sync")
+	}
+	return client
+}
+
+func testSecret(namespace, name string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{
+			"key1": []byte("value1"),
+		},
+	}
+}
+
+func TestClient_CacheReads(t *testing.T) {
+	tests := []struct {
+		name           string
+		cacheNamespace string
+		namespace      string
+		secretName     string
+		wantErr        bool
+		wantHits       uint64
+		wantMisses     uint64
+	}{
+		{
+			name:       "cluster-wide cache hit",
+			namespace:  "default",
+			secretName: "secret1",
+			wantHits:   1,
+		},
+		{
+			name:       "cached not found",
+			namespace:  "default",
+			secretName: "missing",
+			wantErr:    true,
+			wantHits:   1,
+		},
+		{
+			name:           "namespace outside cache scope",
+			cacheNamespace: "default",
+			namespace:      "other",
+			secretName:     "secret2",
+			wantMisses:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newCachedClient(t, tt.cacheNamespace,
+				testSecret("default", "secret1"),
+				testSecret("other", "secret2"),
+			)
+
+			secret, err := client.GetSecret(context.TODO(), tt.namespace, tt.secretName)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetSecret() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && string(secret.Data["key1"]) != "value1" {
+				t.Errorf("GetSecret() returned unexpected data: %v", secret.Data)
+			}
+
+			stats := client.CacheStats()
+			if !stats.Enabled || !stats.Synced {
+				t.Errorf("CacheStats() = %+v, want enabled and synced", stats)
+			}
+			if stats.Hits != tt.wantHits || stats.Misses != tt.wantMisses {
+				t.Errorf("CacheStats() hits/misses = %d/%d, want %d/%d", stats.Hits, stats.Misses, tt.wantHits, tt.wantMisses)
+			}
+		})
+	}
+}
+
+func TestClient_CacheList(t *testing.T) {
+	client := newCachedClient(t, "",
+		testSecret("default", "secret2"),
+		testSecret("default", "secret1"),
+		testSecret("other", "secret3"),
+	)
+
+	list, err := client.ListSecrets(context.TODO(), "default", ListOptions{})
+	if err != nil {
+		t.Fatalf("ListSecrets() error = %v", err)
+	}
+
+	secrets := list.Items
+	if len(secrets) != 2 || secrets[0].Name != "secret1" || secrets[1].Name != "secret2" {
+		t.Errorf("ListSecrets() = %v, want secret1 and secret2 in order", secrets)
+	}
+
+	if stats := client.CacheStats(); stats.Hits != 1 {
+		t.Errorf("CacheStats() hits = %d, want 1", stats.Hits)
+	}
+}
+
+func TestClient_CacheListSelectors(t *testing.T) {
+	tls := testSecret("default", "cert")
+	tls.Type = corev1.SecretTypeTLS
+	tls.Labels = map[string]string{"app": "api"}
+	opaque := testSecret("default", "db")
+	opaque.Type = corev1.SecretTypeOpaque
+	opaque.Labels = map[string]string{"app": "api"}
+
+	client := newCachedClient(t, "", tls, opaque, testSecret("default", "other"))
+
+	tests := []struct {
+		name      string
+		opts      ListOptions
+		wantNames []string
+		wantErr   bool
+	}{
+		{
+			name:      "label selector",
+			opts:      ListOptions{LabelSelector: "app=api"},
+			wantNames: []string{"cert", "db"},
+		},
+		{
+			name:      "label and field selector",
+			opts:      ListOptions{LabelSelector: "app=api", FieldSelector: "type=kubernetes.io/tls"},
+			wantNames: []string{"cert"},
+		},
+		{
+			name:      "field selector on name",
+			opts:      ListOptions{FieldSelector: "metadata.name!=other"},
+			wantNames: []string{"cert", "db"},
+		},
+		{
+			name:    "invalid label selector",
+			opts:    ListOptions{LabelSelector: "app in (api"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid field selector",
+			opts:    ListOptions{FieldSelector: "type"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := client.ListSecrets(context.TODO(), "default", tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListSecrets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				var invalid *ValidationError
+				if !stderrors.As(err, &invalid) {
+					t.Errorf("ListSecrets() error = %T, want *ValidationError", err)
+				}
+				return
+			}
+
+			var names []string
+			for _, secret := range list.Items {
+				names = append(names, secret.Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("ListSecrets() = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestClient_CacheSeesWrites(t *testing.T) {
+	client := newCachedClient(t, "")
+
+	secret := testSecret("default", "written")
+	if _, err := client.clientset.CoreV1().Secrets("default").Create(context.TODO(), secret, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create secret: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := client.GetSecret(context.TODO(), "default", "written")
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("write never reached the cache: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClient_WritesBypassCache(t *testing.T) {
+	ctx := context.TODO()
+	client := newCachedClient(t, "", testSecret("default", "secret1"))
+
+	// The informer has not seen the deletion of ghost, nor the latest
+	// version of secret1
+	store := client.cache.informer.GetStore()
+	store.Add(testSecret("default", "ghost"))
+	stale := testSecret("default", "secret1")
+	stale.Labels = map[string]string{"stale": "true"}
+	store.Update(stale)
+
+	if err := client.CreateSecret(ctx, &SecretData{Name: "ghost", Namespace: "default", Data: map[string]string{"a": "b"}}); err != nil {
+		t.Errorf("CreateSecret() of a secret only the cache holds error = %v", err)
+	}
+
+	if err := client.UpdateSecret(ctx, &SecretData{Name: "secret1", Namespace: "default", Data: map[string]string{"a": "b"}}); err != nil {
+		t.Fatalf("UpdateSecret() error = %v", err)
+	}
+	updated, err := client.clientset.CoreV1().Secrets("default").Get(ctx, "secret1", metav1.GetOptions{})
+	if err != nil || updated.Labels["stale"] != "" {
+		t.Errorf("UpdateSecret() wrote on top of the cached version: %v, %v", updated, err)
+	}
+}
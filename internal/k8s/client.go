@@ -3,44 +3,66 @@ package k8s
 import (
 	"context"
 	"fmt"
-	"path/filepath"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
+	"k8s.io/client-go/rest"
 )
 
 type Client struct {
 	clientset kubernetes.Interface
+	cache     *secretCache
+	history   *secretHistory
+
+	// config and newClientset build the clients of Impersonate
+	config       *rest.Config
+	newClientset func(*rest.Config) (kubernetes.Interface, error)
 }
 
 func NewClient(kubeconfig string) (*Client, error) {
-	if kubeconfig == "" {
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfig = filepath.Join(home, ".kube", "config")
-		}
+	return NewClientWithOptions(ClientOptions{Kubeconfig: kubeconfig})
+}
+
+func NewClientWithOptions(opts ClientOptions) (*Client, error) {
+	config, err := BuildRESTConfig(opts)
+	if err != nil {
+		return nil, err
 	}
 
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	clientset, err := newClientset(config)
 	if err != nil {
-		return nil, fmt.Errorf("error building kubeconfig: %w", err)
+		return nil, err
 	}
 
+	return &Client{clientset: clientset, config: config, newClientset: newClientset}, nil
+}
+
+func newClientset(config *rest.Config) (kubernetes.Interface, error) {
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("error creating kubernetes client: %w", err)
 	}
+	return clientset, nil
+}
 
-	return &Client{clientset: clientset}, nil
+// NewClientForClientset wraps an existing clientset, e.g. a fake one in tests
+func NewClientForClientset(clientset kubernetes.Interface) *Client {
+	return &Client{clientset: clientset}
 }
 
+// CreateSecret creates a secret, setting data.ResourceVersion to the version
+// created
 func (c *Client) CreateSecret(ctx context.Context, data *SecretData) error {
-	_, err := c.GetSecret(ctx, data.Namespace, data.Name)
+	_, err := c.getLive(ctx, data.Namespace, data.Name)
 	if err == nil {
-		return fmt.Errorf("secret %s already exists in namespace %s", data.Name, data.Namespace)
+		return apperrors.New(apperrors.CodeAlreadyExists,
+			fmt.Sprintf("secret %s already exists in namespace %s", data.Name, data.Namespace))
 	}
 	if !errors.IsNotFound(err) {
 		return err
@@ -48,79 +70,232 @@ func (c *Client) CreateSecret(ctx context.Context, data *SecretData) error {
 
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      data.Name,
-			Namespace: data.Namespace,
+			Name:        data.Name,
+			Namespace:   data.Namespace,
+			Labels:      data.Labels,
+			Annotations: data.Annotations,
 		},
 		Type: corev1.SecretType(data.Type),
-		Data: makeSecretData(data.Data),
+		Data: data.Values(),
+	}
+	if data.Immutable {
+		immutable := true
+		secret.Immutable = &immutable
 	}
 
-	_, err = c.clientset.CoreV1().Secrets(data.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+	created, err := c.clientset.CoreV1().Secrets(data.Namespace).Create(ctx, secret, metav1.CreateOptions{})
 	if err != nil {
-		return fmt.Errorf("error creating secret: %w", err)
+		return secretError(err, data.Namespace, data.Name, "creating")
 	}
 
+	data.ResourceVersion = created.ResourceVersion
 	return nil
 }
 
+// UpdateSecret replaces the data of an existing secret. When
+// data.ResourceVersion is set the update fails with a Conflict error if the
+// secret changed since that version; on success it is set to the new version.
 func (c *Client) UpdateSecret(ctx context.Context, data *SecretData) error {
-	existing, err := c.GetSecret(ctx, data.Namespace, data.Name)
+	existing, err := c.getLive(ctx, data.Namespace, data.Name)
 	if err != nil {
 		return fmt.Errorf("error getting existing secret: %w", err)
 	}
 
-	existing.Data = makeSecretData(data.Data)
-	if data.Type != "" {
-		existing.Type = corev1.SecretType(data.Type)
+	if err := CheckResourceVersion(existing, data.ResourceVersion); err != nil {
+		return err
+	}
+	if data.ResourceVersion != "" {
+		// Let the API server enforce the precondition as well, the secret may
+		// change between the read above and the update
+		existing.ResourceVersion = data.ResourceVersion
 	}
 
-	_, err = c.clientset.CoreV1().Secrets(data.Namespace).Update(ctx, existing, metav1.UpdateOptions{})
+	previous := existing.DeepCopy()
+	if err := ApplySecretData(existing, data); err != nil {
+		return err
+	}
+
+	updated, err := c.updateWithHistory(ctx, previous, existing)
 	if err != nil {
-		return fmt.Errorf("error updating secret: %w", err)
+		return secretError(err, data.Namespace, data.Name, "updating")
 	}
 
+	data.ResourceVersion = updated.ResourceVersion
 	return nil
 }
 
-func (c *Client) DeleteSecret(ctx context.Context, namespace, name string) error {
-	err := c.clientset.CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
-	if err != nil {
-		if errors.IsNotFound(err) {
-			return fmt.Errorf("secret %s not found in namespace %s", name, namespace)
+func (c *Client) DeleteSecret(ctx context.Context, namespace, name string, opts ...DeleteOptions) error {
+	deleteOptions := metav1.DeleteOptions{}
+	for _, opt := range opts {
+		if opt.ResourceVersion == "" {
+			continue
 		}
-		return fmt.Errorf("error deleting secret: %w", err)
+
+		existing, err := c.getLive(ctx, namespace, name)
+		if err != nil {
+			return err
+		}
+		if err := CheckResourceVersion(existing, opt.ResourceVersion); err != nil {
+			return err
+		}
+
+		resourceVersion := opt.ResourceVersion
+		deleteOptions.Preconditions = &metav1.Preconditions{ResourceVersion: &resourceVersion}
+	}
+
+	err := c.clientset.CoreV1().Secrets(namespace).Delete(ctx, name, deleteOptions)
+	if err != nil {
+		return secretError(err, namespace, name, "deleting")
 	}
 
 	return nil
 }
 
 func (c *Client) GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
-	secret, err := c.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if namespace == "" {
+		return nil, &ValidationError{Field: "namespace", Message: "namespace is required"}
+	}
+	if name == "" {
+		return nil, &ValidationError{Field: "name", Message: "name is required"}
+	}
+
+	if !c.cache.serves(namespace) {
+		return c.getLive(ctx, namespace, name)
+	}
+	secret, err := c.cache.get(namespace, name)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			return nil, fmt.Errorf("secret %s not found in namespace %s", name, namespace)
-		}
-		return nil, fmt.Errorf("error getting secret: %w", err)
+		return nil, secretError(err, namespace, name, "getting")
+	}
+
+	return secret, nil
+}
+
+// getLive reads a secret from the API server, bypassing the cache. Writes
+// base their read-modify-write on it so that they never act on a stale
+// version.
+func (c *Client) getLive(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	if namespace == "" {
+		return nil, &ValidationError{Field: "namespace", Message: "namespace is required"}
+	}
+	if name == "" {
+		return nil, &ValidationError{Field: "name", Message: "name is required"}
 	}
 
+	secret, err := c.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, secretError(err, namespace, name, "getting")
+	}
 	return secret, nil
 }
 
-func (c *Client) ListSecrets(ctx context.Context, namespace string) ([]corev1.Secret, error) {
-	secretList, err := c.clientset.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{})
+func (c *Client) ListSecrets(ctx context.Context, namespace string, opts ListOptions) (*SecretList, error) {
+	labelSelector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, &ValidationError{Field: "labelSelector", Message: err.Error()}
+	}
+	fieldSelector, err := fields.ParseSelector(opts.FieldSelector)
 	if err != nil {
-		return nil, fmt.Errorf("error listing secrets: %w", err)
+		return nil, &ValidationError{Field: "fieldSelector", Message: err.Error()}
+	}
+	// History secrets are an implementation detail of the secrets they belong to
+	fieldSelector = fields.AndSelectors(fieldSelector, fields.OneTermNotEqualSelector("type", string(HistorySecretType)))
+
+	// Pages are only consistent when served by the API server
+	if opts.Limit == 0 && opts.Continue == "" && c.cache.serves(namespace) {
+		secrets, err := c.cache.list(namespace, labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("error listing secrets: %w", err)
+		}
+		return &SecretList{Items: FilterByFields(secrets, fieldSelector)}, nil
+	}
+
+	secretList, err := c.clientset.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: opts.LabelSelector,
+		FieldSelector: fieldSelector.String(),
+		Limit:         opts.Limit,
+		Continue:      opts.Continue,
+	})
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.CodeOf(err), "error listing secrets", err)
+	}
+
+	return &SecretList{
+		Items:              FilterByFields(secretList.Items, fieldSelector),
+		Continue:           secretList.Continue,
+		RemainingItemCount: secretList.RemainingItemCount,
+	}, nil
+}
+
+// FilterByFields applies the field selectors the API server supports for
+// secrets held outside the API server, e.g. in the cache
+func FilterByFields(secrets []corev1.Secret, selector fields.Selector) []corev1.Secret {
+	if selector.Empty() {
+		return secrets
+	}
+
+	filtered := secrets[:0]
+	for _, secret := range secrets {
+		if selector.Matches(fields.Set{
+			"metadata.name":      secret.Name,
+			"metadata.namespace": secret.Namespace,
+			"type":               string(secret.Type),
+		}) {
+			filtered = append(filtered, secret)
+		}
+	}
+	return filtered
+}
+
+// ApplySecretData writes the fields of data onto an existing secret,
+// refusing to change the data or type of an immutable one
+func ApplySecretData(existing *corev1.Secret, data *SecretData) error {
+	newData := data.Values()
+	typeChanged := data.Type != "" && corev1.SecretType(data.Type) != existing.Type
+	if isImmutable(existing) && (typeChanged || !equalData(existing.Data, newData)) {
+		return &ImmutableError{Namespace: existing.Namespace, Name: existing.Name}
 	}
 
-	return secretList.Items, nil
+	existing.Data = newData
+	if data.Type != "" {
+		existing.Type = corev1.SecretType(data.Type)
+	}
+	if data.Labels != nil {
+		existing.Labels = data.Labels
+	}
+	if data.Annotations != nil {
+		existing.Annotations = data.Annotations
+	}
+	if data.Immutable {
+		immutable := true
+		existing.Immutable = &immutable
+	}
+	return nil
 }
 
-func makeSecretData(data map[string]string) map[string][]byte {
-	secretData := make(map[string][]byte)
-	for key, value := range data {
-		secretData[key] = []byte(value)
+func equalData(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
 	}
-	return secretData
+	for key, value := range a {
+		other, ok := b[key]
+		if !ok || string(value) != string(other) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckResourceVersion returns a Conflict error when an expected version was
+// given and the secret is at a different one
+func CheckResourceVersion(secret *corev1.Secret, expected string) error {
+	if expected == "" || expected == secret.ResourceVersion {
+		return nil
+	}
+	return errors.NewConflict(
+		corev1.Resource("secrets"),
+		secret.Name,
+		fmt.Errorf("resourceVersion %s does not match current version %s", expected, secret.ResourceVersion),
+	)
 }
 
 func (c *Client) GetSecretString(ctx context.Context, namespace, name, key string) (string, error) {
@@ -131,7 +306,7 @@ func (c *Client) GetSecretString(ctx context.Context, namespace, name, key strin
 
 	value, ok := secret.Data[key]
 	if !ok {
-		return "", fmt.Errorf("key %s not found in secret %s", key, name)
+		return "", &KeyNotFoundError{Secret: name, Key: key}
 	}
 
 	return string(value), nil
@@ -147,3 +322,13 @@ func (c *Client) Exists(ctx context.Context, namespace, name string) (bool, erro
 	}
 	return true, nil
 }
+
+// ServerVersion queries the API server version, which doubles as a
+// reachability check
+func (c *Client) ServerVersion() (string, error) {
+	info, err := c.clientset.Discovery().ServerVersion()
+	if err != nil {
+		return "", fmt.Errorf("error getting server version: %w", err)
+	}
+	return info.GitVersion, nil
+}
@@ -1,7 +1,9 @@
 package k8s
 
 import (
+	"bytes"
 	"context"
+	stderrors "errors"
 	"testing"
 
 	corev1 "k8s.io/api/core/v1"
@@ -386,7 +388,7 @@ func TestClient_ListSecrets(t *testing.T) {
 				clientset: clientset,
 			}
 
-			secrets, err := client.ListSecrets(context.TODO(), tt.namespace)
+			secrets, err := client.ListSecrets(context.TODO(), tt.namespace, ListOptions{})
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ListSecrets() error = %v, wantErr %v", err, tt.wantErr)
@@ -399,11 +401,11 @@ func TestClient_ListSecrets(t *testing.T) {
 			}
 
 			if !tt.wantErr {
-				if len(secrets) != tt.wantCount {
-					t.Errorf("ListSecrets() returned %d secrets, want %d", len(secrets), tt.wantCount)
+				if len(secrets.Items) != tt.wantCount {
+					t.Errorf("ListSecrets() returned %d secrets, want %d", len(secrets.Items), tt.wantCount)
 				}
 
-				for _, secret := range secrets {
+				for _, secret := range secrets.Items {
 					if secret.Namespace != tt.namespace {
 						t.Errorf("ListSecrets() returned secret from wrong namespace: got %s, want %s",
 							secret.Namespace, tt.namespace)
@@ -493,13 +495,13 @@ func TestClient_ListSecretsWithLabels(t *testing.T) {
 				clientset: clientset,
 			}
 
-			selector := metav1.ListOptions{
+			opts := ListOptions{
 				LabelSelector: metav1.FormatLabelSelector(&metav1.LabelSelector{
 					MatchLabels: tt.labels,
 				}),
 			}
 
-			secrets, err := client.clientset.CoreV1().Secrets(tt.namespace).List(context.TODO(), selector)
+			secrets, err := client.ListSecrets(context.TODO(), tt.namespace, opts)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ListSecrets() error = %v, wantErr %v", err, tt.wantErr)
@@ -693,3 +695,373 @@ func TestClient_Exists(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_ResourceVersionPreconditions(t *testing.T) {
+	seed := func(clientset *fake.Clientset) {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "test-secret",
+				Namespace:       "default",
+				ResourceVersion: "5",
+			},
+			Data: map[string][]byte{
+				"key1": []byte("value1"),
+			},
+		}
+		clientset.CoreV1().Secrets("default").Create(context.TODO(), secret, metav1.CreateOptions{})
+	}
+
+	tests := []struct {
+		name         string
+		action       func(*Client) error
+		wantConflict bool
+	}{
+		{
+			name: "update at current version",
+			action: func(c *Client) error {
+				return c.UpdateSecret(context.TODO(), &SecretData{
+					Name: "test-secret", Namespace: "default", ResourceVersion: "5",
+					Data: map[string]string{"key1": "value2"},
+				})
+			},
+		},
+		{
+			name: "update at stale version",
+			action: func(c *Client) error {
+				return c.UpdateSecret(context.TODO(), &SecretData{
+					Name: "test-secret", Namespace: "default", ResourceVersion: "4",
+					Data: map[string]string{"key1": "value2"},
+				})
+			},
+			wantConflict: true,
+		},
+		{
+			name: "unconditional update",
+			action: func(c *Client) error {
+				return c.UpdateSecret(context.TODO(), &SecretData{
+					Name: "test-secret", Namespace: "default",
+					Data: map[string]string{"key1": "value2"},
+				})
+			},
+		},
+		{
+			name: "delete at stale version",
+			action: func(c *Client) error {
+				return c.DeleteSecret(context.TODO(), "default", "test-secret", DeleteOptions{ResourceVersion: "4"})
+			},
+			wantConflict: true,
+		},
+		{
+			name: "delete at current version",
+			action: func(c *Client) error {
+				return c.DeleteSecret(context.TODO(), "default", "test-secret", DeleteOptions{ResourceVersion: "5"})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			seed(clientset)
+
+			client := &Client{
+				clientset: clientset,
+			}
+
+			err := tt.action(client)
+
+			if tt.wantConflict != errors.IsConflict(err) {
+				t.Errorf("error = %v, wantConflict %v", err, tt.wantConflict)
+			}
+			if !tt.wantConflict && err != nil {
+				t.Errorf("unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_PatchSecret(t *testing.T) {
+	tests := []struct {
+		name            string
+		patch           *SecretPatch
+		wantErr         bool
+		wantData        map[string]string
+		wantLabels      map[string]string
+		wantAnnotations map[string]string
+	}{
+		{
+			name: "set, unset and rename keys",
+			patch: &SecretPatch{
+				Set:    map[string]string{"key1": "new-value1", "key4": "value4"},
+				Unset:  []string{"key2"},
+				Rename: map[string]string{"key3": "renamed"},
+			},
+			wantData:   map[string]string{"key1": "new-value1", "renamed": "value3", "key4": "value4"},
+			wantLabels: map[string]string{"app": "test"},
+		},
+		{
+			name: "labels and annotations only",
+			patch: &SecretPatch{
+				SetLabels:      map[string]string{"team": "payments"},
+				UnsetLabels:    []string{"app"},
+				SetAnnotations: map[string]string{"owner": "alice"},
+			},
+			wantData:        map[string]string{"key1": "value1", "key2": "value2", "key3": "value3"},
+			wantLabels:      map[string]string{"team": "payments"},
+			wantAnnotations: map[string]string{"owner": "alice"},
+		},
+		{
+			name: "rename missing key",
+			patch: &SecretPatch{
+				Rename: map[string]string{"missing": "renamed"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "stale resource version",
+			patch: &SecretPatch{
+				Set:             map[string]string{"key1": "new-value1"},
+				ResourceVersion: "1",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "test-secret",
+					Namespace:       "default",
+					ResourceVersion: "2",
+					Labels:          map[string]string{"app": "test"},
+				},
+				Data: map[string][]byte{
+					"key1": []byte("value1"),
+					"key2": []byte("value2"),
+					"key3": []byte("value3"),
+				},
+			}
+			clientset.CoreV1().Secrets("default").Create(context.TODO(), secret, metav1.CreateOptions{})
+
+			client := &Client{
+				clientset: clientset,
+			}
+
+			patched, err := client.PatchSecret(context.TODO(), "default", "test-secret", tt.patch)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PatchSecret() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(patched.Data) != len(tt.wantData) {
+				t.Errorf("PatchSecret() data = %v, want %v", patched.Data, tt.wantData)
+			}
+			for k, v := range tt.wantData {
+				if string(patched.Data[k]) != v {
+					t.Errorf("Secret data mismatch for key %s: got %s, want %s", k, patched.Data[k], v)
+				}
+			}
+			if len(patched.Labels) != len(tt.wantLabels) || len(patched.Annotations) != len(tt.wantAnnotations) {
+				t.Errorf("PatchSecret() metadata = %v/%v, want %v/%v", patched.Labels, patched.Annotations, tt.wantLabels, tt.wantAnnotations)
+			}
+			for k, v := range tt.wantLabels {
+				if patched.Labels[k] != v {
+					t.Errorf("Label mismatch for %s: got %s, want %s", k, patched.Labels[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestSecretPatch_ApplyRenames(t *testing.T) {
+	tests := []struct {
+		name     string
+		rename   map[string]string
+		wantErr  bool
+		wantData map[string]string
+	}{
+		{
+			name:     "independent renames",
+			rename:   map[string]string{"a": "x", "b": "y"},
+			wantData: map[string]string{"x": "1", "y": "2", "c": "3"},
+		},
+		{
+			name:     "rename to itself",
+			rename:   map[string]string{"a": "a"},
+			wantData: map[string]string{"a": "1", "b": "2", "c": "3"},
+		},
+		{
+			name:    "chained renames",
+			rename:  map[string]string{"a": "b", "b": "d"},
+			wantErr: true,
+		},
+		{
+			name:    "swapped renames",
+			rename:  map[string]string{"a": "b", "b": "a"},
+			wantErr: true,
+		},
+		{
+			name:    "renames to the same key",
+			rename:  map[string]string{"a": "x", "b": "x"},
+			wantErr: true,
+		},
+		{
+			name:    "rename to an existing key",
+			rename:  map[string]string{"a": "c"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Map iteration order varies, so apply the patch a few times
+			for i := 0; i < 20; i++ {
+				secret := &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "default"},
+					Data:       map[string][]byte{"a": []byte("1"), "b": []byte("2"), "c": []byte("3")},
+				}
+
+				err := (&SecretPatch{Rename: tt.rename}).Apply(secret)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if tt.wantErr {
+					if len(secret.Data) != 3 || string(secret.Data["a"]) != "1" {
+						t.Fatalf("failed Apply() changed the data: %v", secret.Data)
+					}
+					continue
+				}
+
+				if len(secret.Data) != len(tt.wantData) {
+					t.Fatalf("Apply() data = %v, want %v", secret.Data, tt.wantData)
+				}
+				for k, v := range tt.wantData {
+					if string(secret.Data[k]) != v {
+						t.Fatalf("Apply() data = %v, want %v", secret.Data, tt.wantData)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestClient_ImmutableSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  func(*Client) error
+		wantErr bool
+	}{
+		{
+			name: "change data",
+			action: func(c *Client) error {
+				return c.UpdateSecret(context.TODO(), &SecretData{
+					Name: "test-secret", Namespace: "default",
+					Data: map[string]string{"key1": "value2"},
+				})
+			},
+			wantErr: true,
+		},
+		{
+			name: "change labels only",
+			action: func(c *Client) error {
+				return c.UpdateSecret(context.TODO(), &SecretData{
+					Name: "test-secret", Namespace: "default",
+					Data:   map[string]string{"key1": "value1"},
+					Labels: map[string]string{"team": "payments"},
+				})
+			},
+		},
+		{
+			name: "patch data",
+			action: func(c *Client) error {
+				_, err := c.PatchSecret(context.TODO(), "default", "test-secret", &SecretPatch{
+					Unset: []string{"key1"},
+				})
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name: "patch annotations",
+			action: func(c *Client) error {
+				_, err := c.PatchSecret(context.TODO(), "default", "test-secret", &SecretPatch{
+					SetAnnotations: map[string]string{"owner": "alice"},
+				})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			immutable := true
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-secret",
+					Namespace: "default",
+					Labels:    map[string]string{"app": "test"},
+				},
+				Data:      map[string][]byte{"key1": []byte("value1")},
+				Immutable: &immutable,
+			}
+			clientset.CoreV1().Secrets("default").Create(context.TODO(), secret, metav1.CreateOptions{})
+
+			client := &Client{
+				clientset: clientset,
+			}
+
+			err := tt.action(client)
+
+			var immutableErr *ImmutableError
+			if tt.wantErr != stderrors.As(err, &immutableErr) {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_BinaryAndStringData(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	client := &Client{clientset: clientset}
+
+	binary := []byte{0x00, 0xff, 0xfe}
+	err := client.CreateSecret(context.TODO(), &SecretData{
+		Name:       "keystore",
+		Namespace:  "default",
+		Data:       map[string]string{"user": "admin", "password": "old"},
+		BinaryData: map[string][]byte{"keystore.jks": binary},
+		StringData: map[string]string{"password": "new"},
+	})
+	if err != nil {
+		t.Fatalf("CreateSecret() error = %v", err)
+	}
+
+	secret, err := client.GetSecret(context.TODO(), "default", "keystore")
+	if err != nil {
+		t.Fatalf("GetSecret() error = %v", err)
+	}
+	if string(secret.Data["password"]) != "new" || string(secret.Data["user"]) != "admin" {
+		t.Errorf("stringData was not merged over data: %v", secret.Data)
+	}
+	if !bytes.Equal(secret.Data["keystore.jks"], binary) {
+		t.Errorf("binary value = %v, want %v", secret.Data["keystore.jks"], binary)
+	}
+
+	data := NewSecretData(secret)
+	if _, ok := data.Data["keystore.jks"]; ok {
+		t.Errorf("NewSecretData() put a binary value into Data")
+	}
+	if !bytes.Equal(data.BinaryData["keystore.jks"], binary) || data.Data["user"] != "admin" {
+		t.Errorf("NewSecretData() = %v / %v", data.Data, data.BinaryData)
+	}
+}
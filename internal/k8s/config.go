@@ -0,0 +1,89 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// ClientOptions describes how to reach the Kubernetes API server
+type ClientOptions struct {
+	// InCluster forces the use of the Pod's ServiceAccount credentials
+	InCluster bool
+	// Kubeconfig is an explicit kubeconfig path; when empty the $KUBECONFIG
+	// merge list and ~/.kube/config are used
+	Kubeconfig string
+	Context    string
+	Cluster    string
+	User       string
+	QPS        float32
+	Burst      int
+	Timeout    time.Duration
+}
+
+// BuildRESTConfig resolves a rest.Config from the given options. In-cluster
+// credentials are picked automatically when running inside a Pod and no
+// kubeconfig, context, cluster or user was requested explicitly.
+func BuildRESTConfig(opts ClientOptions) (*rest.Config, error) {
+	var (
+		config *rest.Config
+		err    error
+	)
+
+	if useInCluster(opts) {
+		config, err = rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("error building in-cluster config: %w", err)
+		}
+	} else {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		if opts.Kubeconfig != "" {
+			rules.ExplicitPath = opts.Kubeconfig
+		}
+
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: opts.Context}
+		overrides.Context.Cluster = opts.Cluster
+		overrides.Context.AuthInfo = opts.User
+
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("error building kubeconfig: %w", err)
+		}
+	}
+
+	if opts.QPS > 0 {
+		config.QPS = opts.QPS
+	}
+	if opts.Burst > 0 {
+		config.Burst = opts.Burst
+	}
+	if opts.Timeout > 0 {
+		config.Timeout = opts.Timeout
+	}
+
+	return config, nil
+}
+
+// useInCluster reports whether opts ask for in-cluster credentials, or
+// leave the choice open inside a Pod
+func useInCluster(opts ClientOptions) bool {
+	if opts.InCluster {
+		return true
+	}
+	explicit := opts.Kubeconfig != "" || opts.Context != "" || opts.Cluster != "" || opts.User != "" ||
+		os.Getenv(clientcmd.RecommendedConfigPathEnvVar) != ""
+	return !explicit && runningInCluster()
+}
+
+func runningInCluster() bool {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" || os.Getenv("KUBERNETES_SERVICE_PORT") == "" {
+		return false
+	}
+	_, err := os.Stat(serviceAccountTokenPath)
+	return err == nil
+}
@@ -0,0 +1,170 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: staging
+clusters:
+- name: staging
+  cluster:
+    server: https://staging.example.com
+- name: prod
+  cluster:
+    server: https://prod.example.com
+users:
+- name: staging-user
+  user:
+    token: staging-token
+- name: prod-user
+  user:
+    token: prod-token
+contexts:
+- name: staging
+  context:
+    cluster: staging
+    user: staging-user
+- name: prod
+  context:
+    cluster: prod
+    user: prod-user
+`
+
+func writeKubeconfig(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	return path
+}
+
+func TestBuildRESTConfig(t *testing.T) {
+	kubeconfig := writeKubeconfig(t)
+
+	tests := []struct {
+		name      string
+		opts      ClientOptions
+		env       string
+		wantHost  string
+		wantToken string
+		wantErr   bool
+	}{
+		{
+			name:      "current context",
+			opts:      ClientOptions{Kubeconfig: kubeconfig},
+			wantHost:  "https://staging.example.com",
+			wantToken: "staging-token",
+		},
+		{
+			name:      "context override",
+			opts:      ClientOptions{Kubeconfig: kubeconfig, Context: "prod"},
+			wantHost:  "https://prod.example.com",
+			wantToken: "prod-token",
+		},
+		{
+			name:      "cluster and user override",
+			opts:      ClientOptions{Kubeconfig: kubeconfig, Cluster: "prod", User: "staging-user"},
+			wantHost:  "https://prod.example.com",
+			wantToken: "staging-token",
+		},
+		{
+			name:      "KUBECONFIG merge list",
+			opts:      ClientOptions{Context: "prod"},
+			env:       filepath.Join(t.TempDir(), "missing") + string(os.PathListSeparator) + kubeconfig,
+			wantHost:  "https://prod.example.com",
+			wantToken: "prod-token",
+		},
+		{
+			name:    "unknown context",
+			opts:    ClientOptions{Kubeconfig: kubeconfig, Context: "missing"},
+			wantErr: true,
+		},
+		{
+			name:    "in-cluster outside a pod",
+			opts:    ClientOptions{InCluster: true},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("KUBECONFIG", tt.env)
+			t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+			config, err := BuildRESTConfig(tt.opts)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("BuildRESTConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr {
+				if config.Host != tt.wantHost {
+					t.Errorf("BuildRESTConfig() host = %s, want %s", config.Host, tt.wantHost)
+				}
+				if config.BearerToken != tt.wantToken {
+					t.Errorf("BuildRESTConfig() token = %s, want %s", config.BearerToken, tt.wantToken)
+				}
+			}
+		})
+	}
+}
+
+func TestUseInCluster(t *testing.T) {
+	token := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(token, []byte("token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(path string) { serviceAccountTokenPath = path }(serviceAccountTokenPath)
+	serviceAccountTokenPath = token
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+
+	tests := []struct {
+		name string
+		opts ClientOptions
+		env  string
+		want bool
+	}{
+		{"nothing requested", ClientOptions{}, "", true},
+		{"forced", ClientOptions{InCluster: true, Context: "prod"}, "", true},
+		{"kubeconfig", ClientOptions{Kubeconfig: "config"}, "", false},
+		{"context", ClientOptions{Context: "prod"}, "", false},
+		{"cluster", ClientOptions{Cluster: "prod"}, "", false},
+		{"user", ClientOptions{User: "prod-user"}, "", false},
+		{"KUBECONFIG", ClientOptions{}, "config", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("KUBECONFIG", tt.env)
+			if got := useInCluster(tt.opts); got != tt.want {
+				t.Errorf("useInCluster() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildRESTConfig_Limits(t *testing.T) {
+	t.Setenv("KUBECONFIG", "")
+
+	config, err := BuildRESTConfig(ClientOptions{
+		Kubeconfig: writeKubeconfig(t),
+		QPS:        50,
+		Burst:      100,
+		Timeout:    15 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("BuildRESTConfig() error = %v", err)
+	}
+
+	if config.QPS != 50 || config.Burst != 100 || config.Timeout != 15*time.Second {
+		t.Errorf("BuildRESTConfig() limits = %v/%v/%v, want 50/100/15s", config.QPS, config.Burst, config.Timeout)
+	}
+}
@@ -1,11 +1,65 @@
 package k8s
 
-// NotFoundError represents a resource not found error
+import (
+	"fmt"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+)
+
+// NotFoundError represents a resource not found error. Err keeps the API
+// server's error so that apierrors.IsNotFound still recognises it.
 type NotFoundError struct {
-	Resource string
-	Name     string
+	Resource  string
+	Name      string
+	Namespace string
+	Err       error
 }
 
 func (e *NotFoundError) Error() string {
+	if e.Namespace != "" {
+		return e.Resource + " " + e.Name + " not found in namespace " + e.Namespace
+	}
 	return e.Resource + " " + e.Name + " not found"
 }
+
+func (e *NotFoundError) Unwrap() error { return e.Err }
+
+func (e *NotFoundError) ErrorCode() string { return apperrors.CodeNotFound }
+
+// KeyNotFoundError is returned when a secret exists but lacks the requested key
+type KeyNotFoundError struct {
+	Secret string
+	Key    string
+}
+
+func (e *KeyNotFoundError) Error() string {
+	return "key " + e.Key + " not found in secret " + e.Secret
+}
+
+func (e *KeyNotFoundError) ErrorCode() string { return apperrors.CodeNotFound }
+
+// ImmutableError is returned when a write would change the data or type of an
+// immutable secret
+type ImmutableError struct {
+	Namespace string
+	Name      string
+}
+
+func (e *ImmutableError) Error() string {
+	return "secret " + e.Name + " in namespace " + e.Namespace + " is immutable"
+}
+
+func (e *ImmutableError) ErrorCode() string { return apperrors.CodeImmutable }
+
+// secretError turns an error of the API server about a secret into a typed
+// error. The original error stays in the chain.
+func secretError(err error, namespace, name, action string) error {
+	switch apperrors.CodeOf(err) {
+	case apperrors.CodeNotFound:
+		return &NotFoundError{Resource: "secret", Name: name, Namespace: namespace, Err: err}
+	case apperrors.CodeAlreadyExists:
+		return apperrors.Wrap(apperrors.CodeAlreadyExists,
+			fmt.Sprintf("secret %s already exists in namespace %s", name, namespace), err)
+	}
+	return apperrors.Wrap(apperrors.CodeOf(err), "error "+action+" secret", err)
+}
@@ -0,0 +1,381 @@
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/crypto"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// HistorySecretType is the type of the companion secrets holding revisions
+	HistorySecretType corev1.SecretType = "secrets-manager.io/history"
+
+	// HistoryLimitAnnotation overrides the number of revisions kept for a
+	// secret; "0" disables its history
+	HistoryLimitAnnotation = "secrets-manager.io/history-limit"
+
+	historyOwnerLabel        = "secrets-manager.io/history-of"
+	historyRevisionLabel     = "secrets-manager.io/revision"
+	historyOwnerAnnotation   = "secrets-manager.io/history-of"
+	historyCreatedAnnotation = "secrets-manager.io/created-at"
+	historySourceAnnotation  = "secrets-manager.io/source-resource-version"
+	historyPayloadKey        = "payload"
+
+	// maxRevisionAttempts bounds the revision numbers tried when concurrent
+	// updates record revisions at the same time
+	maxRevisionAttempts = 5
+)
+
+// HistoryOptions configures the revision history kept for every secret
+type HistoryOptions struct {
+	// Key is the AES-256 key revisions are encrypted with
+	Key []byte
+	// Limit is the number of revisions kept per secret unless the secret's
+	// HistoryLimitAnnotation says otherwise
+	Limit int
+}
+
+// Revision is a previous version of a secret
+type Revision struct {
+	Revision  int64     `json:"revision"`
+	CreatedAt time.Time `json:"createdAt"`
+	// ResourceVersion is the version of the secret the revision was taken from
+	ResourceVersion string `json:"resourceVersion"`
+	// Secret is the content of the revision, only set by GetRevision
+	Secret *corev1.Secret `json:"-"`
+}
+
+type secretHistory struct {
+	cipher *crypto.Cipher
+	limit  int
+}
+
+// revisionPayload is the encrypted content of a history secret
+type revisionPayload struct {
+	Type        corev1.SecretType `json:"type"`
+	Data        map[string][]byte `json:"data"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+var errHistoryDisabled = apperrors.New(apperrors.CodeNotImplemented, "revision history is not enabled")
+
+// EnableHistory makes every update of a secret first record its previous
+// version in an encrypted companion secret of type HistorySecretType. It must
+// be called before the client is shared between goroutines.
+func (c *Client) EnableHistory(opts HistoryOptions) error {
+	cipher, err := crypto.NewCipher(opts.Key)
+	if err != nil {
+		return err
+	}
+	if opts.Limit < 0 {
+		return fmt.Errorf("history limit must not be negative")
+	}
+
+	c.history = &secretHistory{cipher: cipher, limit: opts.Limit}
+	return nil
+}
+
+// ListRevisions returns the recorded revisions of a secret, oldest first
+func (c *Client) ListRevisions(ctx context.Context, namespace, name string) ([]Revision, error) {
+	if c.history == nil {
+		return nil, errHistoryDisabled
+	}
+
+	secrets, err := c.historySecrets(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]Revision, 0, len(secrets))
+	for i := range secrets {
+		revisions = append(revisions, newRevision(&secrets[i]))
+	}
+	return revisions, nil
+}
+
+// GetRevision returns a recorded revision of a secret with its content
+func (c *Client) GetRevision(ctx context.Context, namespace, name string, revision int64) (*Revision, error) {
+	if c.history == nil {
+		return nil, errHistoryDisabled
+	}
+
+	notFound := &NotFoundError{Resource: "revision", Name: fmt.Sprintf("%d of secret %s", revision, name), Namespace: namespace}
+
+	secret, err := c.clientset.CoreV1().Secrets(namespace).Get(ctx, revisionSecretName(name, revision), metav1.GetOptions{})
+	if err != nil {
+		if apperrors.CodeOf(err) == apperrors.CodeNotFound {
+			notFound.Err = err
+			return nil, notFound
+		}
+		return nil, secretError(err, namespace, name, "getting revision of")
+	}
+	if secret.Type != HistorySecretType || secret.Annotations[historyOwnerAnnotation] != name {
+		return nil, notFound
+	}
+
+	plaintext, err := c.history.cipher.Decrypt(secret.Data[historyPayloadKey], revisionAAD(namespace, name, revision))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting revision %d of secret %s: %w", revision, name, err)
+	}
+	var payload revisionPayload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return nil, fmt.Errorf("error decoding revision %d of secret %s: %w", revision, name, err)
+	}
+
+	rev := newRevision(secret)
+	rev.Secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       namespace,
+			Labels:          payload.Labels,
+			Annotations:     payload.Annotations,
+			ResourceVersion: rev.ResourceVersion,
+		},
+		Type: payload.Type,
+		Data: payload.Data,
+	}
+	return &rev, nil
+}
+
+// Rollback restores the type, data, labels and annotations of a secret from
+// a revision. The version being replaced is recorded as a new revision, so a
+// rollback can itself be undone.
+func (c *Client) Rollback(ctx context.Context, namespace, name string, revision int64) (*corev1.Secret, error) {
+	rev, err := c.GetRevision(ctx, namespace, name, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated *corev1.Secret
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := c.getLive(ctx, namespace, name)
+		if err != nil {
+			return err
+		}
+		previous := existing.DeepCopy()
+
+		if err := ApplySecretData(existing, NewSecretData(rev.Secret)); err != nil {
+			return err
+		}
+		existing.Labels = rev.Secret.Labels
+		existing.Annotations = rev.Secret.Annotations
+
+		updated, err = c.updateWithHistory(ctx, previous, existing)
+		if err != nil {
+			return secretError(err, namespace, name, "rolling back")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// updateWithHistory records previous as a revision and writes updated. The
+// revision is discarded again when the write fails.
+func (c *Client) updateWithHistory(ctx context.Context, previous, updated *corev1.Secret) (*corev1.Secret, error) {
+	recorded, err := c.recordRevision(ctx, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.clientset.CoreV1().Secrets(updated.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		if recorded != "" {
+			c.clientset.CoreV1().Secrets(updated.Namespace).Delete(ctx, recorded, metav1.DeleteOptions{})
+		}
+		return nil, err
+	}
+
+	if recorded != "" {
+		c.pruneRevisions(ctx, result)
+	}
+	return result, nil
+}
+
+// recordRevision stores secret as the next revision of its history. It returns the name of the history secret, or
+// "" when no history is kept for secret.
+func (c *Client) recordRevision(ctx context.Context, secret *corev1.Secret) (string, error) {
+	if c.history == nil || secret.Type == HistorySecretType {
+		return "", nil
+	}
+	limit := c.history.limitFor(secret)
+	if limit == 0 {
+		return "", nil
+	}
+
+	existing, err := c.historySecrets(ctx, secret.Namespace, secret.Name)
+	if err != nil {
+		return "", err
+	}
+	var next int64 = 1
+	if len(existing) > 0 {
+		next = revisionNumber(&existing[len(existing)-1]) + 1
+	}
+
+	plaintext, err := json.Marshal(revisionPayload{
+		Type:        secret.Type,
+		Data:        secret.Data,
+		Labels:      secret.Labels,
+		Annotations: secret.Annotations,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error encoding revision: %w", err)
+	}
+
+	// A concurrent update of the secret may take the same revision number,
+	// in which case the next one is tried
+	for attempt := 0; ; attempt++ {
+		history, err := c.newRevisionSecret(secret, plaintext, next)
+		if err != nil {
+			return "", err
+		}
+		_, err = c.clientset.CoreV1().Secrets(secret.Namespace).Create(ctx, history, metav1.CreateOptions{})
+		if err == nil {
+			return history.Name, nil
+		}
+		if !errors.IsAlreadyExists(err) || attempt == maxRevisionAttempts-1 {
+			return "", secretError(err, secret.Namespace, history.Name, "recording revision")
+		}
+		next++
+	}
+}
+
+// newRevisionSecret seals plaintext, the content of secret, into the history
+// secret of the given revision
+func (c *Client) newRevisionSecret(secret *corev1.Secret, plaintext []byte, revision int64) (*corev1.Secret, error) {
+	sealed, err := c.history.cipher.Encrypt(plaintext, revisionAAD(secret.Namespace, secret.Name, revision))
+	if err != nil {
+		return nil, err
+	}
+
+	history := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      revisionSecretName(secret.Name, revision),
+			Namespace: secret.Namespace,
+			Labels: map[string]string{
+				historyOwnerLabel:    ownerLabelValue(secret.Name),
+				historyRevisionLabel: strconv.FormatInt(revision, 10),
+			},
+			Annotations: map[string]string{
+				historyOwnerAnnotation:   secret.Name,
+				historyCreatedAnnotation: time.Now().UTC().Format(time.RFC3339),
+				historySourceAnnotation:  secret.ResourceVersion,
+			},
+		},
+		Type: HistorySecretType,
+		Data: map[string][]byte{historyPayloadKey: sealed},
+	}
+	if secret.UID != "" {
+		// Let the garbage collector remove the history with the secret
+		history.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: "v1",
+			Kind:       "Secret",
+			Name:       secret.Name,
+			UID:        secret.UID,
+		}}
+	}
+	return history, nil
+}
+
+// pruneRevisions deletes the oldest revisions of secret beyond its limit.
+// It is best effort: the write it follows has already succeeded, and
+// anything left over is pruned on the next one.
+func (c *Client) pruneRevisions(ctx context.Context, secret *corev1.Secret) {
+	limit := c.history.limitFor(secret)
+	existing, err := c.historySecrets(ctx, secret.Namespace, secret.Name)
+	if err != nil {
+		return
+	}
+	for i := 0; i < len(existing)-limit; i++ {
+		c.clientset.CoreV1().Secrets(secret.Namespace).Delete(ctx, existing[i].Name, metav1.DeleteOptions{})
+	}
+}
+
+// historySecrets lists the history secrets of a secret, oldest first
+func (c *Client) historySecrets(ctx context.Context, namespace, name string) ([]corev1.Secret, error) {
+	list, err := c.clientset.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: historyOwnerLabel + "=" + ownerLabelValue(name),
+	})
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.CodeOf(err), "error listing revisions", err)
+	}
+
+	secrets := make([]corev1.Secret, 0, len(list.Items))
+	for _, secret := range list.Items {
+		if secret.Type == HistorySecretType && secret.Annotations[historyOwnerAnnotation] == name {
+			secrets = append(secrets, secret)
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return revisionNumber(&secrets[i]) < revisionNumber(&secrets[j])
+	})
+	return secrets, nil
+}
+
+func (h *secretHistory) limitFor(secret *corev1.Secret) int {
+	if value, ok := secret.Annotations[HistoryLimitAnnotation]; ok {
+		if limit, err := strconv.Atoi(value); err == nil && limit >= 0 {
+			return limit
+		}
+	}
+	return h.limit
+}
+
+func newRevision(secret *corev1.Secret) Revision {
+	created, _ := time.Parse(time.RFC3339, secret.Annotations[historyCreatedAnnotation])
+	return Revision{
+		Revision:        revisionNumber(secret),
+		CreatedAt:       created,
+		ResourceVersion: secret.Annotations[historySourceAnnotation],
+	}
+}
+
+func revisionNumber(secret *corev1.Secret) int64 {
+	revision, _ := strconv.ParseInt(secret.Labels[historyRevisionLabel], 10, 64)
+	return revision
+}
+
+// revisionSecretName returns the name of the history secret of a revision.
+// Names too long for it are truncated and suffixed with a hash of the full
+// name; the owner annotation tells which secret a revision belongs to.
+func revisionSecretName(name string, revision int64) string {
+	suffix := fmt.Sprintf(".rev.%d", revision)
+	if len(name)+len(suffix) <= validation.DNS1123SubdomainMaxLength {
+		return name + suffix
+	}
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])[:10]
+	prefix := strings.TrimRight(name[:validation.DNS1123SubdomainMaxLength-len(suffix)-len(hash)-1], "-.")
+	return prefix + "-" + hash + suffix
+}
+
+// revisionAAD binds a sealed revision to the secret and revision it belongs to
+func revisionAAD(namespace, name string, revision int64) []byte {
+	return []byte(fmt.Sprintf("%s/%s/%d", namespace, name, revision))
+}
+
+// ownerLabelValue returns name, truncated to the length a label value may
+// have; the owner annotation disambiguates truncated names
+func ownerLabelValue(name string) string {
+	if len(name) <= validation.LabelValueMaxLength {
+		return name
+	}
+	return strings.TrimRight(name[:validation.LabelValueMaxLength], "-.")
+}
@@ -0,0 +1,186 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"strings"
+	"testing"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/crypto"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newHistoryClient(t *testing.T, limit int) *Client {
+	t.Helper()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{clientset: fake.NewSimpleClientset()}
+	if err := client.EnableHistory(HistoryOptions{Key: key, Limit: limit}); err != nil {
+		t.Fatalf("EnableHistory() error = %v", err)
+	}
+	return client
+}
+
+func revisionNumbers(t *testing.T, client *Client, name string) []int64 {
+	t.Helper()
+
+	revisions, err := client.ListRevisions(context.TODO(), "default", name)
+	if err != nil {
+		t.Fatalf("ListRevisions() error = %v", err)
+	}
+	var numbers []int64
+	for _, revision := range revisions {
+		numbers = append(numbers, revision.Revision)
+	}
+	return numbers
+}
+
+func TestClient_History(t *testing.T) {
+	ctx := context.TODO()
+	client := newHistoryClient(t, 2)
+
+	if err := client.CreateSecret(ctx, &SecretData{Name: "db", Namespace: "default", Data: map[string]string{"password": "v1"}}); err != nil {
+		t.Fatalf("CreateSecret() error = %v", err)
+	}
+	for _, password := range []string{"v2", "v3", "v4"} {
+		if err := client.UpdateSecret(ctx, &SecretData{Name: "db", Namespace: "default", Data: map[string]string{"password": password}}); err != nil {
+			t.Fatalf("UpdateSecret() error = %v", err)
+		}
+	}
+
+	if got := revisionNumbers(t, client, "db"); len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Fatalf("ListRevisions() = %v, want [2 3]", got)
+	}
+
+	stored, err := client.clientset.CoreV1().Secrets("default").Get(ctx, "db.rev.2", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("history secret not found: %v", err)
+	}
+	if stored.Type != HistorySecretType || bytes.Contains(stored.Data[historyPayloadKey], []byte("v2")) {
+		t.Errorf("history secret is not an encrypted %s: %v", HistorySecretType, stored)
+	}
+
+	revision, err := client.GetRevision(ctx, "default", "db", 2)
+	if err != nil {
+		t.Fatalf("GetRevision() error = %v", err)
+	}
+	if string(revision.Secret.Data["password"]) != "v2" {
+		t.Errorf("GetRevision() password = %s, want v2", revision.Secret.Data["password"])
+	}
+
+	if _, err := client.Rollback(ctx, "default", "db", 2); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	current, _ := client.GetSecret(ctx, "default", "db")
+	if string(current.Data["password"]) != "v2" {
+		t.Errorf("password after rollback = %s, want v2", current.Data["password"])
+	}
+	if got := revisionNumbers(t, client, "db"); len(got) != 2 || got[0] != 3 || got[1] != 4 {
+		t.Errorf("ListRevisions() after rollback = %v, want [3 4]", got)
+	}
+
+	_, err = client.GetRevision(ctx, "default", "db", 1)
+	var notFound *NotFoundError
+	if !stderrors.As(err, &notFound) {
+		t.Errorf("GetRevision() of a pruned revision error = %v, want NotFoundError", err)
+	}
+	list, err := client.ListSecrets(ctx, "default", ListOptions{})
+	if err != nil || len(list.Items) != 1 || list.Items[0].Name != "db" {
+		t.Errorf("ListSecrets() = %v, %v, want only db", list, err)
+	}
+}
+
+func TestClient_HistoryConcurrentRevision(t *testing.T) {
+	ctx := context.TODO()
+	client := newHistoryClient(t, 10)
+
+	if err := client.CreateSecret(ctx, &SecretData{Name: "db", Namespace: "default", Data: map[string]string{"password": "v1"}}); err != nil {
+		t.Fatalf("CreateSecret() error = %v", err)
+	}
+	// A concurrent update took revision 1 after this one listed the history
+	client.clientset.CoreV1().Secrets("default").Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db.rev.1", Namespace: "default"},
+	}, metav1.CreateOptions{})
+
+	if err := client.UpdateSecret(ctx, &SecretData{Name: "db", Namespace: "default", Data: map[string]string{"password": "v2"}}); err != nil {
+		t.Fatalf("UpdateSecret() error = %v", err)
+	}
+
+	if got := revisionNumbers(t, client, "db"); len(got) != 1 || got[0] != 2 {
+		t.Fatalf("ListRevisions() = %v, want [2]", got)
+	}
+	revision, err := client.GetRevision(ctx, "default", "db", 2)
+	if err != nil {
+		t.Fatalf("GetRevision() error = %v", err)
+	}
+	if string(revision.Secret.Data["password"]) != "v1" {
+		t.Errorf("GetRevision() password = %s, want v1", revision.Secret.Data["password"])
+	}
+}
+
+func TestClient_HistoryLongName(t *testing.T) {
+	ctx := context.TODO()
+	client := newHistoryClient(t, 10)
+	name := strings.Repeat("a", 250)
+
+	if err := client.CreateSecret(ctx, &SecretData{Name: name, Namespace: "default", Data: map[string]string{"password": "v1"}}); err != nil {
+		t.Fatalf("CreateSecret() error = %v", err)
+	}
+	if err := client.UpdateSecret(ctx, &SecretData{Name: name, Namespace: "default", Data: map[string]string{"password": "v2"}}); err != nil {
+		t.Fatalf("UpdateSecret() error = %v", err)
+	}
+
+	historyName := revisionSecretName(name, 1)
+	if errs := validation.IsDNS1123Subdomain(historyName); len(errs) > 0 {
+		t.Errorf("history secret name %s is invalid: %v", historyName, errs)
+	}
+	if other := revisionSecretName(strings.Repeat("a", 249)+"b", 1); other == historyName {
+		t.Errorf("names sharing a prefix map to the same history secret %s", historyName)
+	}
+
+	revision, err := client.GetRevision(ctx, "default", name, 1)
+	if err != nil {
+		t.Fatalf("GetRevision() error = %v", err)
+	}
+	if string(revision.Secret.Data["password"]) != "v1" {
+		t.Errorf("GetRevision() password = %s, want v1", revision.Secret.Data["password"])
+	}
+}
+
+func TestClient_HistoryLimitAnnotation(t *testing.T) {
+	ctx := context.TODO()
+	client := newHistoryClient(t, 10)
+
+	client.CreateSecret(ctx, &SecretData{
+		Name:        "db",
+		Namespace:   "default",
+		Data:        map[string]string{"password": "v1"},
+		Annotations: map[string]string{HistoryLimitAnnotation: "0"},
+	})
+	if err := client.UpdateSecret(ctx, &SecretData{Name: "db", Namespace: "default", Data: map[string]string{"password": "v2"}}); err != nil {
+		t.Fatalf("UpdateSecret() error = %v", err)
+	}
+
+	if got := revisionNumbers(t, client, "db"); len(got) != 0 {
+		t.Errorf("ListRevisions() = %v, want no revisions", got)
+	}
+}
+
+func TestClient_HistoryDisabled(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+	})
+	client := &Client{clientset: clientset}
+
+	if _, err := client.ListRevisions(context.TODO(), "default", "db"); apperrors.CodeOf(err) != apperrors.CodeNotImplemented {
+		t.Errorf("ListRevisions() error = %v, want %s", err, apperrors.CodeNotImplemented)
+	}
+}
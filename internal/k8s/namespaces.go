@@ -0,0 +1,32 @@
+package k8s
+
+import (
+	"context"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// NamespaceLister is implemented by managers that can list namespaces
+type NamespaceLister interface {
+	ListNamespaces(ctx context.Context, selector string) ([]string, error)
+}
+
+// ListNamespaces returns the names of the namespaces matching a label selector
+func (c *Client) ListNamespaces(ctx context.Context, selector string) ([]string, error) {
+	if _, err := labels.Parse(selector); err != nil {
+		return nil, &ValidationError{Field: "labelSelector", Message: err.Error()}
+	}
+
+	list, err := c.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.CodeOf(err), "error listing namespaces", err)
+	}
+
+	names := make([]string, 0, len(list.Items))
+	for _, namespace := range list.Items {
+		names = append(names, namespace.Name)
+	}
+	return names, nil
+}
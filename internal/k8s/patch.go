@@ -0,0 +1,162 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// SecretPatch describes key-level changes to a secret. Everything not
+// mentioned is left untouched. Renames are applied first, then unsets, then
+// sets.
+type SecretPatch struct {
+	Set              map[string]string `json:"set,omitempty"`
+	Unset            []string          `json:"unset,omitempty"`
+	Rename           map[string]string `json:"rename,omitempty"`
+	SetLabels        map[string]string `json:"setLabels,omitempty"`
+	UnsetLabels      []string          `json:"unsetLabels,omitempty"`
+	SetAnnotations   map[string]string `json:"setAnnotations,omitempty"`
+	UnsetAnnotations []string          `json:"unsetAnnotations,omitempty"`
+	// ResourceVersion makes the patch conditional on the current version
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// IsEmpty reports whether the patch changes nothing
+func (p *SecretPatch) IsEmpty() bool {
+	return len(p.Set) == 0 && len(p.Unset) == 0 && len(p.Rename) == 0 &&
+		len(p.SetLabels) == 0 && len(p.UnsetLabels) == 0 &&
+		len(p.SetAnnotations) == 0 && len(p.UnsetAnnotations) == 0
+}
+
+// Apply performs the patch on secret in place. Only labels and annotations
+// may be patched on an immutable secret.
+func (p *SecretPatch) Apply(secret *corev1.Secret) error {
+	if isImmutable(secret) && (len(p.Set) > 0 || len(p.Unset) > 0 || len(p.Rename) > 0) {
+		return &ImmutableError{Namespace: secret.Namespace, Name: secret.Name}
+	}
+
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+
+	if err := p.applyRenames(secret); err != nil {
+		return err
+	}
+
+	for _, key := range p.Unset {
+		delete(secret.Data, key)
+	}
+	for key, value := range p.Set {
+		secret.Data[key] = []byte(value)
+	}
+
+	secret.Labels = patchMap(secret.Labels, p.SetLabels, p.UnsetLabels)
+	secret.Annotations = patchMap(secret.Annotations, p.SetAnnotations, p.UnsetAnnotations)
+	return nil
+}
+
+// applyRenames moves the renamed keys all at once. A key may not be both
+// renamed and the target of a rename, since the result would depend on the
+// order the renames are applied in.
+func (p *SecretPatch) applyRenames(secret *corev1.Secret) error {
+	sources := make([]string, 0, len(p.Rename))
+	for from := range p.Rename {
+		sources = append(sources, from)
+	}
+	sort.Strings(sources)
+
+	targets := make(map[string]string, len(p.Rename))
+	for _, from := range sources {
+		to := p.Rename[from]
+		if _, ok := secret.Data[from]; !ok {
+			return &ValidationError{Field: "rename", Message: fmt.Sprintf("key %s not found in secret %s", from, secret.Name)}
+		}
+		if to == from {
+			continue
+		}
+		if _, renamed := p.Rename[to]; renamed {
+			return &ValidationError{Field: "rename", Message: fmt.Sprintf("key %s is both renamed and the target of a rename", to)}
+		}
+		if other, ok := targets[to]; ok {
+			return &ValidationError{Field: "rename", Message: fmt.Sprintf("keys %s and %s are both renamed to %s", other, from, to)}
+		}
+		if _, exists := secret.Data[to]; exists {
+			return &ValidationError{Field: "rename", Message: fmt.Sprintf("key %s already exists in secret %s", to, secret.Name)}
+		}
+		targets[to] = from
+	}
+
+	values := make(map[string][]byte, len(targets))
+	for to, from := range targets {
+		values[to] = secret.Data[from]
+	}
+	for _, from := range targets {
+		delete(secret.Data, from)
+	}
+	for to, value := range values {
+		secret.Data[to] = value
+	}
+	return nil
+}
+
+func patchMap(m map[string]string, set map[string]string, unset []string) map[string]string {
+	if len(set) == 0 && len(unset) == 0 {
+		return m
+	}
+	if m == nil {
+		m = make(map[string]string)
+	}
+	for _, key := range unset {
+		delete(m, key)
+	}
+	for key, value := range set {
+		m[key] = value
+	}
+	return m
+}
+
+// PatchSecret applies key-level changes to an existing secret and returns the
+// result. Without a ResourceVersion precondition the read-modify-write cycle
+// is retried when the secret changes concurrently.
+func (c *Client) PatchSecret(ctx context.Context, namespace, name string, patch *SecretPatch) (*corev1.Secret, error) {
+	var updated *corev1.Secret
+
+	attempt := func() error {
+		existing, err := c.getLive(ctx, namespace, name)
+		if err != nil {
+			return err
+		}
+		if err := CheckResourceVersion(existing, patch.ResourceVersion); err != nil {
+			return err
+		}
+		if patch.IsEmpty() {
+			updated = existing
+			return nil
+		}
+
+		previous := existing.DeepCopy()
+		if err := patch.Apply(existing); err != nil {
+			return err
+		}
+
+		updated, err = c.updateWithHistory(ctx, previous, existing)
+		if err != nil {
+			return secretError(err, namespace, name, "patching")
+		}
+		return nil
+	}
+
+	var err error
+	if patch.ResourceVersion != "" {
+		err = attempt()
+	} else {
+		err = retry.RetryOnConflict(retry.DefaultRetry, attempt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
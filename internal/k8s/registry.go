@@ -0,0 +1,70 @@
+package k8s
+
+import (
+	"fmt"
+)
+
+// DefaultClusterName is used when a single, unnamed cluster is configured
+const DefaultClusterName = "default"
+
+// Registry keeps one SecretManager per named cluster. It is populated at
+// startup and only read afterwards.
+type Registry struct {
+	managers    map[string]SecretManager
+	names       []string
+	defaultName string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{managers: make(map[string]SecretManager)}
+}
+
+// Register adds a cluster. The first registered cluster becomes the default.
+func (r *Registry) Register(name string, manager SecretManager) error {
+	if name == "" {
+		return fmt.Errorf("cluster name is required")
+	}
+	if _, exists := r.managers[name]; exists {
+		return fmt.Errorf("cluster %s is already registered", name)
+	}
+
+	r.managers[name] = manager
+	r.names = append(r.names, name)
+	if r.defaultName == "" {
+		r.defaultName = name
+	}
+	return nil
+}
+
+func (r *Registry) SetDefault(name string) error {
+	if _, exists := r.managers[name]; !exists {
+		return &NotFoundError{Resource: "cluster", Name: name}
+	}
+	r.defaultName = name
+	return nil
+}
+
+// Get returns the manager for the named cluster, or the default cluster when
+// name is empty
+func (r *Registry) Get(name string) (SecretManager, error) {
+	if name == "" {
+		name = r.defaultName
+	}
+
+	manager, exists := r.managers[name]
+	if !exists {
+		return nil, &NotFoundError{Resource: "cluster", Name: name}
+	}
+	return manager, nil
+}
+
+// Names returns the registered clusters in registration order
+func (r *Registry) Names() []string {
+	names := make([]string, len(r.names))
+	copy(names, r.names)
+	return names
+}
+
+func (r *Registry) Default() string {
+	return r.defaultName
+}
@@ -3,7 +3,10 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"strings"
+	"unicode/utf8"
 
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
 	corev1 "k8s.io/api/core/v1"
 )
 
@@ -12,6 +15,45 @@ type SecretData struct {
 	Namespace string            `json:"namespace" validate:"required"`
 	Type      string            `json:"type"`
 	Data      map[string]string `json:"data" validate:"required"`
+	// BinaryData holds values that are not valid UTF-8, base64 encoded in JSON
+	BinaryData map[string][]byte `json:"binaryData,omitempty"`
+	// StringData is write-only and merged over Data, like the field of the
+	// same name on a Secret
+	StringData map[string]string `json:"stringData,omitempty"`
+	// Labels and Annotations replace the secret's metadata on update when set
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Immutable secrets reject any later change to their data or type
+	Immutable bool `json:"immutable,omitempty"`
+	// ResourceVersion, when set on update, makes the write conditional on the
+	// secret not having changed since that version was read. Successful
+	// creates and updates set it to the version written.
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// ListOptions filters and pages ListSecrets. An empty namespace lists all
+// namespaces.
+type ListOptions struct {
+	LabelSelector string
+	FieldSelector string
+	// Limit caps the page size; zero returns everything in one page
+	Limit int64
+	// Continue is the token returned with the previous page
+	Continue string
+}
+
+// SecretList is one page of ListSecrets results
+type SecretList struct {
+	Items []corev1.Secret
+	// Continue is set when more pages are available
+	Continue           string
+	RemainingItemCount *int64
+}
+
+// DeleteOptions carries optional preconditions for DeleteSecret
+type DeleteOptions struct {
+	// ResourceVersion makes the delete conditional on the current version
+	ResourceVersion string
 }
 
 type SecretManager interface {
@@ -19,18 +61,133 @@ type SecretManager interface {
 
 	UpdateSecret(ctx context.Context, data *SecretData) error
 
-	DeleteSecret(ctx context.Context, namespace, name string) error
+	DeleteSecret(ctx context.Context, namespace, name string, opts ...DeleteOptions) error
+
+	PatchSecret(ctx context.Context, namespace, name string, patch *SecretPatch) (*corev1.Secret, error)
 
 	GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error)
 
-	ListSecrets(ctx context.Context, namespace string) ([]corev1.Secret, error)
+	GetSecretString(ctx context.Context, namespace, name, key string) (string, error)
+
+	ListSecrets(ctx context.Context, namespace string, opts ListOptions) (*SecretList, error)
+
+	ListRevisions(ctx context.Context, namespace, name string) ([]Revision, error)
+
+	GetRevision(ctx context.Context, namespace, name string, revision int64) (*Revision, error)
+
+	Rollback(ctx context.Context, namespace, name string, revision int64) (*corev1.Secret, error)
+}
+
+// HealthChecker is implemented by managers that can report whether their
+// backing API server is reachable
+type HealthChecker interface {
+	ServerVersion() (string, error)
+}
+
+// NewSecretData converts a secret into its editable form, keeping the
+// resourceVersion so that writing it back is conditional
+func NewSecretData(secret *corev1.Secret) *SecretData {
+	data := make(map[string]string, len(secret.Data))
+	var binaryData map[string][]byte
+	for key, value := range secret.Data {
+		if !utf8.Valid(value) {
+			if binaryData == nil {
+				binaryData = make(map[string][]byte)
+			}
+			binaryData[key] = value
+			continue
+		}
+		data[key] = string(value)
+	}
+
+	return &SecretData{
+		Name:            secret.Name,
+		Namespace:       secret.Namespace,
+		Type:            string(secret.Type),
+		Data:            data,
+		BinaryData:      binaryData,
+		Labels:          copyMap(secret.Labels),
+		Annotations:     copyMap(secret.Annotations),
+		Immutable:       isImmutable(secret),
+		ResourceVersion: secret.ResourceVersion,
+	}
+}
+
+// Values returns the bytes stored for every key: BinaryData, then Data, then
+// StringData, later maps winning on duplicate keys
+func (d *SecretData) Values() map[string][]byte {
+	values := make(map[string][]byte, len(d.BinaryData)+len(d.Data)+len(d.StringData))
+	for key, value := range d.BinaryData {
+		values[key] = value
+	}
+	for key, value := range d.Data {
+		values[key] = []byte(value)
+	}
+	for key, value := range d.StringData {
+		values[key] = []byte(value)
+	}
+	return values
+}
+
+// Set stores value under key, in Data when it is valid UTF-8 and in
+// BinaryData otherwise
+func (d *SecretData) Set(key string, value []byte) {
+	delete(d.Data, key)
+	delete(d.BinaryData, key)
+	delete(d.StringData, key)
+	if utf8.Valid(value) {
+		if d.Data == nil {
+			d.Data = make(map[string]string)
+		}
+		d.Data[key] = string(value)
+		return
+	}
+	if d.BinaryData == nil {
+		d.BinaryData = make(map[string][]byte)
+	}
+	d.BinaryData[key] = value
+}
+
+func isImmutable(secret *corev1.Secret) bool {
+	return secret.Immutable != nil && *secret.Immutable
+}
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
 }
 
 type ValidationError struct {
-	Field   string
-	Message string
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	// Rule is the ID of the policy rule that was violated, if any
+	Rule string `json:"rule,omitempty"`
 }
 
 func (e *ValidationError) Error() string {
+	if e.Rule != "" {
+		return fmt.Sprintf("%s: %s (rule %s)", e.Field, e.Message, e.Rule)
+	}
 	return fmt.Sprintf("%s: %s", e.Field, e.Message)
 }
+
+func (e *ValidationError) ErrorCode() string { return apperrors.CodeInvalid }
+
+// ValidationErrors reports every problem found with a secret at once
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e ValidationErrors) ErrorCode() string { return apperrors.CodeInvalid }
@@ -0,0 +1,178 @@
+package policy
+
+import (
+	"context"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// enforcer evaluates the policy on the secret a create, update, patch or
+// rollback would leave and refuses the write on violations. Other
+// operations go straight to the wrapped manager.
+type enforcer struct {
+	k8s.SecretManager
+	policy *Policy
+}
+
+// applyEnforcer is the enforcer of a manager that also implements k8s.Applier
+type applyEnforcer struct {
+	*enforcer
+	applier k8s.Applier
+}
+
+// Enforce wraps manager so that writes violating p fail with
+// k8s.ValidationErrors. Server-side apply stays available when manager
+// supports it.
+func Enforce(manager k8s.SecretManager, p *Policy) k8s.SecretManager {
+	e := &enforcer{SecretManager: manager, policy: p}
+	if applier, ok := manager.(k8s.Applier); ok {
+		return &applyEnforcer{enforcer: e, applier: applier}
+	}
+	return e
+}
+
+func (e *enforcer) check(violations k8s.ValidationErrors) error {
+	if len(violations) > 0 {
+		return violations
+	}
+	return nil
+}
+
+func (e *enforcer) CreateSecret(ctx context.Context, data *k8s.SecretData) error {
+	if err := e.check(e.policy.EvaluateData(data)); err != nil {
+		return err
+	}
+	return e.SecretManager.CreateSecret(ctx, data)
+}
+
+// UpdateSecret evaluates the existing secret with the update applied. The
+// write is pinned to the version evaluated, and evaluated again when the
+// secret changed in between, unless the caller pinned the version.
+func (e *enforcer) UpdateSecret(ctx context.Context, data *k8s.SecretData) error {
+	pinned := data.ResourceVersion
+	err := retryUnpinned(pinned, func() error {
+		existing, err := e.SecretManager.GetSecret(ctx, data.Namespace, data.Name)
+		if err != nil {
+			return err
+		}
+		if err := k8s.CheckResourceVersion(existing, pinned); err != nil {
+			return err
+		}
+
+		updated := existing.DeepCopy()
+		if err := k8s.ApplySecretData(updated, data); err != nil {
+			return err
+		}
+		if err := e.check(e.policy.Evaluate(updated)); err != nil {
+			return err
+		}
+
+		data.ResourceVersion = existing.ResourceVersion
+		return e.SecretManager.UpdateSecret(ctx, data)
+	})
+	if err != nil {
+		data.ResourceVersion = pinned
+	}
+	return err
+}
+
+// PatchSecret evaluates the existing secret with the patch applied, pinning
+// the write to the version evaluated like UpdateSecret
+func (e *enforcer) PatchSecret(ctx context.Context, namespace, name string, patch *k8s.SecretPatch) (*corev1.Secret, error) {
+	var result *corev1.Secret
+	err := retryUnpinned(patch.ResourceVersion, func() error {
+		existing, err := e.SecretManager.GetSecret(ctx, namespace, name)
+		if err != nil {
+			return err
+		}
+		if err := k8s.CheckResourceVersion(existing, patch.ResourceVersion); err != nil {
+			return err
+		}
+
+		patched := existing.DeepCopy()
+		if err := patch.Apply(patched); err != nil {
+			return err
+		}
+		if err := e.check(e.policy.Evaluate(patched)); err != nil {
+			return err
+		}
+
+		pinned := *patch
+		pinned.ResourceVersion = existing.ResourceVersion
+		result, err = e.SecretManager.PatchSecret(ctx, namespace, name, &pinned)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Rollback evaluates the revision the secret would be rolled back to
+func (e *enforcer) Rollback(ctx context.Context, namespace, name string, revision int64) (*corev1.Secret, error) {
+	rev, err := e.SecretManager.GetRevision(ctx, namespace, name, revision)
+	if err != nil {
+		return nil, err
+	}
+	restored := rev.Secret.DeepCopy()
+	restored.Namespace, restored.Name = namespace, name
+	if err := e.check(e.policy.Evaluate(restored)); err != nil {
+		return nil, err
+	}
+	return e.SecretManager.Rollback(ctx, namespace, name, revision)
+}
+
+// ApplySecret evaluates the secret as server-side apply would leave it:
+// data and type as applied, labels and annotations merged into those of
+// the existing secret
+func (e *applyEnforcer) ApplySecret(ctx context.Context, data *k8s.SecretData, fieldManager string) error {
+	existing, err := e.SecretManager.GetSecret(ctx, data.Namespace, data.Name)
+	switch {
+	case err == nil:
+		applied := existing.DeepCopy()
+		applied.Data = data.Values()
+		if data.Type != "" {
+			applied.Type = corev1.SecretType(data.Type)
+		}
+		applied.Labels = merge(applied.Labels, data.Labels)
+		applied.Annotations = merge(applied.Annotations, data.Annotations)
+		err = e.check(e.policy.Evaluate(applied))
+	case apperrors.CodeOf(err) == apperrors.CodeNotFound:
+		err = e.check(e.policy.EvaluateData(data))
+	default:
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	return e.applier.ApplySecret(ctx, data, fieldManager)
+}
+
+func merge(m, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(m)+len(overrides))
+	for key, value := range m {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
+
+// retryUnpinned runs write again when the secret changed in between. A
+// write pinned by the caller to a version fails on the first conflict.
+func retryUnpinned(pinned string, write func() error) error {
+	if pinned != "" {
+		return write()
+	}
+	return retry.OnError(retry.DefaultRetry, isConflict, write)
+}
+
+// isConflict reports whether the secret changed while a write was evaluated.
+// The read evaluated may also lag behind when served from a cache.
+func isConflict(err error) bool {
+	return apperrors.CodeOf(err) == apperrors.CodeConflict
+}
@@ -0,0 +1,223 @@
+// Package policy enforces the rules a platform sets for the secrets of its
+// namespaces, on top of what validator checks for every secret.
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// ExpiryAnnotation holds the RFC 3339 time a secret expires at. Rules with
+// RequireExpiry make it mandatory.
+const ExpiryAnnotation = "secrets-manager.io/expires-at"
+
+var (
+	awsAccessKeyPattern = regexp.MustCompile(`\b(AKIA|ASIA)[A-Z0-9]{16}\b`)
+	awsSecretKeyPattern = regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+]{40}\b`)
+	awsSecretKeyName    = regexp.MustCompile(`(?i)^aws_?secret_?access_?key$`)
+	awsSecretKeyValue   = regexp.MustCompile(`^[A-Za-z0-9/+]{40}$`)
+)
+
+// Policy is the content of a policy file
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule holds checks for the secrets of the namespaces it matches. Each
+// violation is reported with the ID of the rule.
+type Rule struct {
+	ID string `json:"id"`
+	// Namespaces are path.Match patterns of the namespaces the rule applies
+	// to, all namespaces when empty
+	Namespaces     []string `json:"namespaces,omitempty"`
+	RequiredLabels []string `json:"requiredLabels,omitempty"`
+	// ForbiddenKeys are path.Match patterns of keys secrets may not hold
+	ForbiddenKeys []string `json:"forbiddenKeys,omitempty"`
+	// MaxSize bounds the total size of the keys and values, in bytes
+	MaxSize int `json:"maxSize,omitempty"`
+	// RequireExpiry makes ExpiryAnnotation mandatory and refuses expired
+	// secrets
+	RequireExpiry bool `json:"requireExpiry,omitempty"`
+	// AllowedTypes restricts the secret types, Opaque standing for an unset
+	// type
+	AllowedTypes []string `json:"allowedTypes,omitempty"`
+	// DenyAWSKeys refuses AWS access keys in plain text
+	DenyAWSKeys bool `json:"denyAWSKeys,omitempty"`
+}
+
+// Load reads and validates a policy file
+func Load(file string) (*Policy, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy file: %w", err)
+	}
+	return Parse(content)
+}
+
+// Parse reads a policy from YAML or JSON and validates it
+func Parse(content []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.UnmarshalStrict(content, &p); err != nil {
+		return nil, fmt.Errorf("error parsing policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate checks that every rule has a unique ID, valid patterns and
+// something to check
+func (p *Policy) Validate() error {
+	ids := make(map[string]bool, len(p.Rules))
+	for i, rule := range p.Rules {
+		if rule.ID == "" {
+			return fmt.Errorf("policy rule %d has no id", i)
+		}
+		if ids[rule.ID] {
+			return fmt.Errorf("policy rule %s is defined twice", rule.ID)
+		}
+		ids[rule.ID] = true
+
+		for _, pattern := range append(append([]string{}, rule.Namespaces...), rule.ForbiddenKeys...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("policy rule %s: invalid pattern %q", rule.ID, pattern)
+			}
+		}
+		if rule.MaxSize < 0 {
+			return fmt.Errorf("policy rule %s: maxSize must not be negative", rule.ID)
+		}
+		if len(rule.RequiredLabels) == 0 && len(rule.ForbiddenKeys) == 0 && rule.MaxSize == 0 &&
+			!rule.RequireExpiry && len(rule.AllowedTypes) == 0 && !rule.DenyAWSKeys {
+			return fmt.Errorf("policy rule %s checks nothing", rule.ID)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns the violations of secret, nil when it complies
+func (p *Policy) Evaluate(secret *corev1.Secret) k8s.ValidationErrors {
+	var violations k8s.ValidationErrors
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.applies(secret.Namespace) {
+			violations = append(violations, rule.evaluate(secret)...)
+		}
+	}
+	return violations
+}
+
+// EvaluateData returns the violations of the secret data describes
+func (p *Policy) EvaluateData(data *k8s.SecretData) k8s.ValidationErrors {
+	return p.Evaluate(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        data.Name,
+			Namespace:   data.Namespace,
+			Labels:      data.Labels,
+			Annotations: data.Annotations,
+		},
+		Type: corev1.SecretType(data.Type),
+		Data: data.Values(),
+	})
+}
+
+func (r *Rule) applies(namespace string) bool {
+	if len(r.Namespaces) == 0 {
+		return true
+	}
+	return matchAny(r.Namespaces, namespace)
+}
+
+func (r *Rule) evaluate(secret *corev1.Secret) k8s.ValidationErrors {
+	var violations k8s.ValidationErrors
+	violate := func(field, format string, args ...interface{}) {
+		violations = append(violations, &k8s.ValidationError{Field: field, Message: fmt.Sprintf(format, args...), Rule: r.ID})
+	}
+
+	for _, label := range r.RequiredLabels {
+		if secret.Labels[label] == "" {
+			violate("labels", "label %s is required", label)
+		}
+	}
+
+	keys := make([]string, 0, len(secret.Data))
+	size := 0
+	for key, value := range secret.Data {
+		keys = append(keys, key)
+		size += len(key) + len(value)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if matchAny(r.ForbiddenKeys, key) {
+			violate("data", "key %s is not allowed", key)
+		}
+	}
+	if r.MaxSize > 0 && size > r.MaxSize {
+		violate("data", "secret holds %d bytes, more than the %d allowed", size, r.MaxSize)
+	}
+
+	if r.RequireExpiry {
+		if value, ok := secret.Annotations[ExpiryAnnotation]; !ok {
+			violate("annotations", "annotation %s is required", ExpiryAnnotation)
+		} else if expiry, err := time.Parse(time.RFC3339, value); err != nil {
+			violate("annotations", "annotation %s must be an RFC 3339 time", ExpiryAnnotation)
+		} else if !expiry.After(time.Now()) {
+			violate("annotations", "secret expired at %s", value)
+		}
+	}
+
+	if len(r.AllowedTypes) > 0 {
+		secretType := string(secret.Type)
+		if secretType == "" {
+			secretType = string(corev1.SecretTypeOpaque)
+		}
+		if !contains(r.AllowedTypes, secretType) {
+			violate("type", "type %s is not allowed, use one of %s", secretType, strings.Join(r.AllowedTypes, ", "))
+		}
+	}
+
+	if r.DenyAWSKeys {
+		for _, key := range keys {
+			if holdsAWSKey(key, secret.Data[key]) {
+				violate("data", "key %s holds an AWS access key in plain text", key)
+			}
+		}
+	}
+	return violations
+}
+
+func holdsAWSKey(key string, value []byte) bool {
+	if awsSecretKeyName.MatchString(key) && awsSecretKeyValue.Match(value) {
+		return true
+	}
+	return awsAccessKeyPattern.Match(value) || awsSecretKeyPattern.Match(value)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
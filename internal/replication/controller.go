@@ -0,0 +1,191 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/rs/zerolog"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Cluster is what the controller needs of a cluster
+type Cluster interface {
+	k8s.SecretManager
+	k8s.NamespaceLister
+}
+
+// Controller keeps replicas of annotated source secrets in sync
+type Controller struct {
+	cluster Cluster
+	logger  *zerolog.Logger
+}
+
+// Result summarizes a reconciliation
+type Result struct {
+	Created []string
+	Updated []string
+	Deleted []string
+}
+
+// NewController returns a controller for cluster. logger may be nil.
+func NewController(cluster Cluster, logger *zerolog.Logger) *Controller {
+	if logger == nil {
+		nop := zerolog.Nop()
+		logger = &nop
+	}
+	return &Controller{cluster: cluster, logger: logger}
+}
+
+// Run reconciles every interval until ctx is done
+func (c *Controller) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := c.Reconcile(ctx)
+		if err != nil {
+			c.logger.Error().Err(err).Msg("secret replication failed")
+		}
+		if changed := len(result.Created) + len(result.Updated) + len(result.Deleted); changed > 0 {
+			c.logger.Info().
+				Strs("created", result.Created).
+				Strs("updated", result.Updated).
+				Strs("deleted", result.Deleted).
+				Msg("secret replicas synced")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile creates the missing replicas of every source, updates the ones
+// whose source changed and deletes the ones whose source or target namespace
+// went away. A secret of the target name that is not a replica of the
+// source is left alone, and so are the replicas of a source whose target
+// namespaces cannot be listed.
+func (c *Controller) Reconcile(ctx context.Context) (Result, error) {
+	var result Result
+
+	all, err := c.cluster.ListSecrets(ctx, "", k8s.ListOptions{})
+	if err != nil {
+		return result, err
+	}
+
+	existing := make(map[string]*corev1.Secret, len(all.Items))
+	for i := range all.Items {
+		secret := &all.Items[i]
+		existing[secret.Namespace+"/"+secret.Name] = secret
+	}
+
+	var errs []error
+	wanted := make(map[string]bool)
+	// Sources whose targets could not be resolved keep all their replicas
+	unresolved := make(map[string]bool)
+	for i := range all.Items {
+		source := &all.Items[i]
+		if !isSource(source) {
+			continue
+		}
+		origin := source.Namespace + "/" + source.Name
+
+		targets, err := c.targets(ctx, source)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", origin, err))
+			unresolved[origin] = true
+			continue
+		}
+		for _, namespace := range targets {
+			ref := namespace + "/" + source.Name
+			wanted[ref] = true
+
+			replica, found := existing[ref]
+			switch {
+			case !found:
+				if err := c.cluster.CreateSecret(ctx, replicaOf(source, namespace)); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", ref, err))
+					continue
+				}
+				result.Created = append(result.Created, ref)
+			case replica.Annotations[OriginAnnotation] != origin || replica.Labels[ReplicaLabel] != "true":
+				c.logger.Warn().Str("source", origin).Str("target", ref).Msg("target secret exists and is not a replica, skipping")
+			case replica.Annotations[OriginVersionAnnotation] != source.ResourceVersion || source.ResourceVersion == "":
+				data := replicaOf(source, namespace)
+				data.ResourceVersion = replica.ResourceVersion
+				if err := c.cluster.UpdateSecret(ctx, data); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", ref, err))
+					continue
+				}
+				result.Updated = append(result.Updated, ref)
+			}
+		}
+	}
+
+	for ref, secret := range existing {
+		if secret.Labels[ReplicaLabel] != "true" || wanted[ref] || unresolved[secret.Annotations[OriginAnnotation]] {
+			continue
+		}
+		if err := c.cluster.DeleteSecret(ctx, secret.Namespace, secret.Name, k8s.DeleteOptions{ResourceVersion: secret.ResourceVersion}); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ref, err))
+			continue
+		}
+		result.Deleted = append(result.Deleted, ref)
+	}
+
+	sort.Strings(result.Created)
+	sort.Strings(result.Updated)
+	sort.Strings(result.Deleted)
+	return result, errors.Join(errs...)
+}
+
+func isSource(secret *corev1.Secret) bool {
+	if secret.Labels[ReplicaLabel] == "true" {
+		return false
+	}
+	return secret.Annotations[TargetsAnnotation] != "" || secret.Annotations[TargetSelectorAnnotation] != ""
+}
+
+// targets returns the namespaces source is replicated to, without its own
+func (c *Controller) targets(ctx context.Context, source *corev1.Secret) ([]string, error) {
+	namespaces := make(map[string]bool)
+	for _, namespace := range strings.Split(source.Annotations[TargetsAnnotation], ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces[namespace] = true
+		}
+	}
+
+	if selector := source.Annotations[TargetSelectorAnnotation]; selector != "" {
+		selected, err := c.cluster.ListNamespaces(ctx, selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, namespace := range selected {
+			namespaces[namespace] = true
+		}
+	}
+
+	delete(namespaces, source.Namespace)
+	targets := make([]string, 0, len(namespaces))
+	for namespace := range namespaces {
+		targets = append(targets, namespace)
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
+
+func replicaOf(source *corev1.Secret, namespace string) *k8s.SecretData {
+	data := copyOf(source, namespace, source.Name)
+	if data.Labels == nil {
+		data.Labels = make(map[string]string)
+	}
+	data.Labels[ReplicaLabel] = "true"
+	return data
+}
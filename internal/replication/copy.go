@@ -0,0 +1,112 @@
+// Package replication copies secrets between namespaces, once or kept in
+// sync by a controller.
+package replication
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/apply"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Annotations and labels marking copies and replicas
+const (
+	// OriginAnnotation holds the namespace/name a secret was copied from
+	OriginAnnotation = "secrets-manager.io/replicated-from"
+	// OriginVersionAnnotation holds the resourceVersion of the source the
+	// replica was last synced from
+	OriginVersionAnnotation = "secrets-manager.io/replicated-resource-version"
+	// ReplicaLabel marks the secrets owned by the replication controller
+	ReplicaLabel = "secrets-manager.io/replica"
+
+	// TargetsAnnotation lists the namespaces a source is replicated to,
+	// comma separated
+	TargetsAnnotation = "secrets-manager.io/replicate-to"
+	// TargetSelectorAnnotation selects the namespaces a source is replicated
+	// to by label, e.g. "team=payments"
+	TargetSelectorAnnotation = "secrets-manager.io/replicate-to-selector"
+
+	annotationPrefix = "secrets-manager.io/"
+)
+
+// CopyRequest copies a secret once
+type CopyRequest struct {
+	Namespace string `json:"-"`
+	Name      string `json:"-"`
+	// TargetNamespace defaults to Namespace
+	TargetNamespace string `json:"targetNamespace"`
+	// TargetName defaults to Name
+	TargetName string `json:"targetName,omitempty"`
+	// Overwrite replaces an existing target
+	Overwrite bool `json:"overwrite,omitempty"`
+}
+
+// Copy copies the data, type, labels and annotations of a secret to another
+// namespace or name. The copy records its origin but is not kept in sync.
+func Copy(ctx context.Context, manager k8s.SecretManager, req *CopyRequest) (*corev1.Secret, error) {
+	targetNamespace, targetName := req.TargetNamespace, req.TargetName
+	if targetNamespace == "" {
+		targetNamespace = req.Namespace
+	}
+	if targetName == "" {
+		targetName = req.Name
+	}
+	if targetNamespace == req.Namespace && targetName == req.Name {
+		return nil, &k8s.ValidationError{Field: "target", Message: "target must differ from the source"}
+	}
+
+	source, err := manager.GetSecret(ctx, req.Namespace, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	data := copyOf(source, targetNamespace, targetName)
+	delete(data.Labels, ReplicaLabel)
+	if err := manager.CreateSecret(ctx, data); err != nil {
+		if !req.Overwrite || apperrors.CodeOf(err) != apperrors.CodeAlreadyExists {
+			return nil, err
+		}
+		if err := manager.UpdateSecret(ctx, data); err != nil {
+			return nil, err
+		}
+	}
+
+	// Reading the copy back could be answered by a cache that has not seen
+	// the write yet
+	copied := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: targetName, Namespace: targetNamespace}}
+	if err := k8s.ApplySecretData(copied, data); err != nil {
+		return nil, err
+	}
+	copied.ResourceVersion = data.ResourceVersion
+	return copied, nil
+}
+
+// copyOf returns the content of source under a new namespace and name. The
+// annotations of this project and the apply ownership labels are dropped so
+// that e.g. a copy is not rotated on its own; only the origin is recorded.
+func copyOf(source *corev1.Secret, namespace, name string) *k8s.SecretData {
+	data := k8s.NewSecretData(source)
+	data.Namespace = namespace
+	data.Name = name
+	data.ResourceVersion = ""
+	// A copy is not defined in the apply source of the original, apply
+	// would prune it
+	delete(data.Labels, apply.ManagedByLabel)
+	delete(data.Labels, apply.SourceLabel)
+
+	annotations := make(map[string]string)
+	for key, value := range data.Annotations {
+		if !strings.HasPrefix(key, annotationPrefix) {
+			annotations[key] = value
+		}
+	}
+	annotations[OriginAnnotation] = fmt.Sprintf("%s/%s", source.Namespace, source.Name)
+	annotations[OriginVersionAnnotation] = source.ResourceVersion
+	data.Annotations = annotations
+	return data
+}
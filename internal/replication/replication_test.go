@@ -0,0 +1,249 @@
+package replication
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/apply"
+	"github.com/mpalu/k8s-secrets-manager/internal/backend"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func namespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.TODO()
+	clientset := fake.NewSimpleClientset(
+		namespace("infra", nil),
+		namespace("team-a", map[string]string{"team": "x"}),
+		namespace("team-b", map[string]string{"team": "x"}),
+		namespace("other", nil),
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "pull-secret",
+				Namespace: "infra",
+				Annotations: map[string]string{
+					TargetSelectorAnnotation:          "team=x",
+					TargetsAnnotation:                 "other",
+					"secrets-manager.io/rotate-every": "30d",
+					"example.com/owner":               "platform",
+				},
+			},
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+		},
+		// Not a replica, must not be overwritten
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "pull-secret", Namespace: "team-b"},
+			Data:       map[string][]byte{"own": []byte("data")},
+		},
+		// Replica of a source that no longer exists
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "stale",
+				Namespace:   "team-a",
+				Labels:      map[string]string{ReplicaLabel: "true"},
+				Annotations: map[string]string{OriginAnnotation: "infra/stale"},
+			},
+		},
+	)
+	controller := NewController(k8s.NewClientForClientset(clientset), nil)
+
+	result, err := controller.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if strings.Join(result.Created, ",") != "other/pull-secret,team-a/pull-secret" ||
+		strings.Join(result.Deleted, ",") != "team-a/stale" {
+		t.Errorf("Reconcile() = %+v", result)
+	}
+
+	replica, err := clientset.CoreV1().Secrets("team-a").Get(ctx, "pull-secret", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("replica not created: %v", err)
+	}
+	if replica.Type != corev1.SecretTypeDockerConfigJson || replica.Annotations[OriginAnnotation] != "infra/pull-secret" ||
+		replica.Labels[ReplicaLabel] != "true" || replica.Annotations["example.com/owner"] != "platform" {
+		t.Errorf("replica = %+v", replica.ObjectMeta)
+	}
+	if _, ok := replica.Annotations["secrets-manager.io/rotate-every"]; ok {
+		t.Error("replica kept the rotation policy of its source")
+	}
+
+	own, _ := clientset.CoreV1().Secrets("team-b").Get(ctx, "pull-secret", metav1.GetOptions{})
+	if string(own.Data["own"]) != "data" {
+		t.Errorf("secret that is not a replica was overwritten: %v", own.Data)
+	}
+
+	if err := clientset.CoreV1().Secrets("infra").Delete(ctx, "pull-secret", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	result, err = controller.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if strings.Join(result.Deleted, ",") != "other/pull-secret,team-a/pull-secret" {
+		t.Errorf("Reconcile() after deleting the source = %+v", result)
+	}
+	if _, err := clientset.CoreV1().Secrets("team-b").Get(ctx, "pull-secret", metav1.GetOptions{}); err != nil {
+		t.Errorf("secret that is not a replica was deleted: %v", err)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	ctx := context.TODO()
+	clientset := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+			Data:       map[string][]byte{"password": []byte("s3cr3t")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "staging"},
+			Data:       map[string][]byte{"password": []byte("old")},
+		},
+	)
+	manager := k8s.NewClientForClientset(clientset)
+
+	tests := []struct {
+		name     string
+		req      CopyRequest
+		wantCode string
+	}{
+		{"rename", CopyRequest{TargetName: "db-copy"}, ""},
+		{"other namespace exists", CopyRequest{TargetNamespace: "staging"}, apperrors.CodeAlreadyExists},
+		{"overwrite", CopyRequest{TargetNamespace: "staging", Overwrite: true}, ""},
+		{"same secret", CopyRequest{}, apperrors.CodeInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Namespace, tt.req.Name = "default", "db"
+			copied, err := Copy(ctx, manager, &tt.req)
+			if tt.wantCode != "" {
+				if apperrors.CodeOf(err) != tt.wantCode {
+					t.Errorf("Copy() error = %v, want %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Copy() error = %v", err)
+			}
+			if string(copied.Data["password"]) != "s3cr3t" || copied.Annotations[OriginAnnotation] != "default/db" {
+				t.Errorf("Copy() = %+v", copied)
+			}
+			if copied.Labels[ReplicaLabel] != "" {
+				t.Error("a copy must not be managed by the replication controller")
+			}
+		})
+	}
+}
+
+func TestCopy_Cache(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", ResourceVersion: "1"},
+		Data:       map[string][]byte{"password": []byte("s3cr3t")},
+	})
+	// The fake clientset does not assign versions
+	clientset.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		action.(k8stesting.CreateAction).GetObject().(*corev1.Secret).ResourceVersion = "2"
+		return false, nil, nil
+	})
+	manager := k8s.NewClientForClientset(clientset)
+
+	// A cache that stops after its initial sync never sees the copy
+	ctx, cancel := context.WithCancel(context.Background())
+	manager.EnableCache(ctx, k8s.CacheOptions{})
+	if !manager.WaitForCacheSync(ctx) {
+		t.Fatal("cache did not sync")
+	}
+	cancel()
+
+	copied, err := Copy(context.TODO(), manager, &CopyRequest{Namespace: "default", Name: "db", TargetName: "db-copy"})
+	if err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	if copied.ResourceVersion != "2" || string(copied.Data["password"]) != "s3cr3t" {
+		t.Errorf("Copy() = %+v, want the written copy", copied)
+	}
+}
+
+func TestReconcile_UnresolvedTargets(t *testing.T) {
+	ctx := context.TODO()
+	clientset := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pull-secret",
+				Namespace:   "infra",
+				Annotations: map[string]string{TargetSelectorAnnotation: "team=x"},
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pull-secret",
+				Namespace:   "team-a",
+				Labels:      map[string]string{ReplicaLabel: "true"},
+				Annotations: map[string]string{OriginAnnotation: "infra/pull-secret"},
+			},
+		},
+	)
+	clientset.PrependReactor("list", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewServiceUnavailable("etcd is unavailable")
+	})
+	controller := NewController(k8s.NewClientForClientset(clientset), nil)
+
+	result, err := controller.Reconcile(ctx)
+	if err == nil {
+		t.Error("Reconcile() error = nil, want the namespace list error")
+	}
+	if len(result.Deleted) > 0 {
+		t.Errorf("Reconcile() deleted %v while the targets were unknown", result.Deleted)
+	}
+	if _, err := clientset.CoreV1().Secrets("team-a").Get(ctx, "pull-secret", metav1.GetOptions{}); err != nil {
+		t.Errorf("replica was deleted: %v", err)
+	}
+}
+
+func TestReconcile_AppliedSource(t *testing.T) {
+	ctx := context.TODO()
+	store := backend.NewMemory()
+	source := &k8s.SecretData{
+		Name:        "pull-secret",
+		Namespace:   "infra",
+		Annotations: map[string]string{TargetsAnnotation: "team-a"},
+		Data:        map[string]string{"token": "t"},
+	}
+	opts := apply.Options{Prune: true}
+	if _, err := apply.Apply(ctx, store, []*k8s.SecretData{source}, opts); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if _, err := NewController(store, nil).Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	steps, err := apply.Apply(ctx, store, []*k8s.SecretData{source}, opts)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	for _, step := range steps {
+		if step.Action == apply.ActionPrune {
+			t.Errorf("Apply() pruned the replica %s/%s", step.Namespace, step.Name)
+		}
+	}
+	replica, err := store.GetSecret(ctx, "team-a", "pull-secret")
+	if err != nil {
+		t.Fatalf("replica not found: %v", err)
+	}
+	if _, ok := replica.Labels[apply.ManagedByLabel]; ok {
+		t.Errorf("replica labels = %v, want no apply ownership", replica.Labels)
+	}
+}
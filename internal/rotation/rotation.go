@@ -0,0 +1,301 @@
+// Package rotation regenerates secret values on the schedule set by their
+// annotations.
+package rotation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/generate"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/rs/zerolog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Annotations describing the rotation policy of a secret and its state
+const (
+	// IntervalAnnotation enables rotation, e.g. "30d" or "12h"
+	IntervalAnnotation = "secrets-manager.io/rotate-every"
+	// GeneratorAnnotation names the generator producing the new values,
+	// "password" by default
+	GeneratorAnnotation = "secrets-manager.io/rotation-generator"
+	// ParamsAnnotation holds the generator parameters as key=value pairs
+	ParamsAnnotation = "secrets-manager.io/rotation-params"
+
+	LastRotatedAnnotation  = "secrets-manager.io/last-rotated"
+	NextRotationAnnotation = "secrets-manager.io/next-rotation"
+)
+
+// Event reasons
+const (
+	ReasonRotated        = "Rotated"
+	ReasonRotationFailed = "RotationFailed"
+)
+
+// Policy is the rotation policy of a secret
+type Policy struct {
+	Interval  time.Duration
+	Generator string
+	Params    generate.Params
+}
+
+// PolicyFor reads the rotation policy of secret. It returns nil when the
+// secret is not rotated.
+func PolicyFor(secret *corev1.Secret) (*Policy, error) {
+	value, ok := secret.Annotations[IntervalAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	interval, err := ParseInterval(value)
+	if err != nil {
+		return nil, err
+	}
+	params, err := generate.ParseParams(secret.Annotations[ParamsAnnotation])
+	if err != nil {
+		return nil, err
+	}
+
+	generator := secret.Annotations[GeneratorAnnotation]
+	if generator == "" {
+		generator = "password"
+	}
+	return &Policy{Interval: interval, Generator: generator, Params: params}, nil
+}
+
+// ParseInterval parses a Go duration, also accepting a number of days such
+// as "30d"
+func ParseInterval(value string) (time.Duration, error) {
+	var interval time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		interval = time.Duration(n) * 24 * time.Hour
+	} else {
+		interval, err = time.ParseDuration(value)
+	}
+	if err != nil || interval <= 0 {
+		return 0, apperrors.New(apperrors.CodeInvalid, fmt.Sprintf("invalid rotation interval %q", value))
+	}
+	return interval, nil
+}
+
+// EventRecorder is the part of client-go's record.EventRecorder the rotator
+// needs
+type EventRecorder interface {
+	Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{})
+}
+
+// Options configure a Rotator
+type Options struct {
+	// Generators defaults to the built-in generators
+	Generators *generate.Registry
+	// Recorder receives an Event for every rotation; optional
+	Recorder EventRecorder
+	Logger   *zerolog.Logger
+	// Now defaults to time.Now
+	Now func() time.Time
+}
+
+// Rotator rotates the secrets of one SecretManager
+type Rotator struct {
+	manager    k8s.SecretManager
+	generators *generate.Registry
+	recorder   EventRecorder
+	logger     *zerolog.Logger
+	now        func() time.Time
+
+	mu sync.Mutex
+	// broken holds the resourceVersion of the secrets whose rotation failed
+	// for good, so that they are reported once rather than every run
+	broken map[string]string
+}
+
+// NewRotator returns a Rotator writing through manager
+func NewRotator(manager k8s.SecretManager, opts Options) *Rotator {
+	r := &Rotator{
+		manager:    manager,
+		generators: opts.Generators,
+		recorder:   opts.Recorder,
+		logger:     opts.Logger,
+		now:        opts.Now,
+		broken:     make(map[string]string),
+	}
+	if r.generators == nil {
+		r.generators = generate.NewRegistry()
+	}
+	if r.logger == nil {
+		nop := zerolog.Nop()
+		r.logger = &nop
+	}
+	if r.now == nil {
+		r.now = time.Now
+	}
+	return r
+}
+
+// Due reports whether secret should be rotated now under policy. A secret
+// that was never rotated is due one interval after its creation.
+func (r *Rotator) Due(secret *corev1.Secret, policy *Policy) bool {
+	next, err := time.Parse(time.RFC3339, secret.Annotations[NextRotationAnnotation])
+	if err != nil {
+		next = secret.CreationTimestamp.Add(policy.Interval)
+		if last, err := time.Parse(time.RFC3339, secret.Annotations[LastRotatedAnnotation]); err == nil {
+			next = last.Add(policy.Interval)
+		}
+	}
+	return !r.now().Before(next)
+}
+
+// RotateDue rotates every secret of namespace, or of all namespaces when it is
+// empty, whose rotation is due. It returns the names of the rotated secrets
+// and the errors of the ones that failed. A secret that cannot be rotated
+// until it changes, e.g. because it is immutable or its annotations are
+// invalid, is reported once and skipped until its resourceVersion changes.
+func (r *Rotator) RotateDue(ctx context.Context, namespace string) ([]string, error) {
+	list, err := r.manager.ListSecrets(ctx, namespace, k8s.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	broken := make(map[string]string)
+
+	var rotated []string
+	var errs []error
+	for i := range list.Items {
+		secret := &list.Items[i]
+		ref := secret.Namespace + "/" + secret.Name
+		if version, ok := r.broken[ref]; ok && version == secret.ResourceVersion {
+			broken[ref] = version
+			continue
+		}
+
+		policy, err := PolicyFor(secret)
+		if err == nil && (policy == nil || !r.Due(secret, policy)) {
+			continue
+		}
+		if err == nil {
+			err = r.rotate(ctx, secret, policy)
+		} else {
+			r.failed(secret, err)
+		}
+		if err != nil {
+			if permanent(err) {
+				broken[ref] = secret.ResourceVersion
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", ref, err))
+			continue
+		}
+		rotated = append(rotated, ref)
+	}
+	r.broken = broken
+
+	sort.Strings(rotated)
+	return rotated, errors.Join(errs...)
+}
+
+// Rotate rotates a secret now, whether or not it is due
+func (r *Rotator) Rotate(ctx context.Context, namespace, name string) error {
+	secret, err := r.manager.GetSecret(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+	policy, err := PolicyFor(secret)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return apperrors.New(apperrors.CodeInvalid, fmt.Sprintf("secret %s has no %s annotation", name, IntervalAnnotation))
+	}
+	return r.rotate(ctx, secret, policy)
+}
+
+// Run rotates due secrets every interval until ctx is done
+func (r *Rotator) Run(ctx context.Context, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		rotated, err := r.RotateDue(ctx, namespace)
+		if err != nil {
+			r.logger.Error().Err(err).Msg("secret rotation failed")
+		}
+		if len(rotated) > 0 {
+			r.logger.Info().Strs("secrets", rotated).Msg("secrets rotated")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Rotator) rotate(ctx context.Context, secret *corev1.Secret, policy *Policy) error {
+	err := r.write(ctx, secret, policy)
+	if err != nil {
+		r.failed(secret, err)
+		return err
+	}
+
+	if r.recorder != nil {
+		r.recorder.Eventf(secret, corev1.EventTypeNormal, ReasonRotated,
+			"Rotated with generator %s, next rotation in %s", policy.Generator, policy.Interval)
+	}
+	return nil
+}
+
+func (r *Rotator) write(ctx context.Context, secret *corev1.Secret, policy *Policy) error {
+	generator, err := r.generators.Get(policy.Generator)
+	if err != nil {
+		return err
+	}
+	values, err := generator.Generate(policy.Params)
+	if err != nil {
+		return fmt.Errorf("error generating values: %w", err)
+	}
+
+	// Writing back with the read resourceVersion makes a concurrent change win;
+	// the secret is then retried on the next run
+	data := k8s.NewSecretData(secret)
+	for key, value := range values {
+		data.Set(key, value)
+	}
+
+	now := r.now().UTC()
+	if data.Annotations == nil {
+		data.Annotations = make(map[string]string)
+	}
+	data.Annotations[LastRotatedAnnotation] = now.Format(time.RFC3339)
+	data.Annotations[NextRotationAnnotation] = now.Add(policy.Interval).Format(time.RFC3339)
+
+	if err := r.manager.UpdateSecret(ctx, data); err != nil {
+		return fmt.Errorf("error updating secret: %w", err)
+	}
+	return nil
+}
+
+// permanent reports whether a rotation failed for a reason retrying the same
+// version of the secret cannot fix
+func permanent(err error) bool {
+	code := apperrors.CodeOf(err)
+	return code == apperrors.CodeInvalid || code == apperrors.CodeImmutable
+}
+
+func (r *Rotator) failed(secret *corev1.Secret, err error) {
+	if r.recorder != nil {
+		r.recorder.Eventf(secret, corev1.EventTypeWarning, ReasonRotationFailed, "Rotation failed: %v", err)
+	}
+}
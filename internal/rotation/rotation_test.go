@@ -0,0 +1,148 @@
+package rotation
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/backend"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"0d", 0, true},
+		{"monthly", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseInterval(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseInterval(%q) = %v, %v", tt.value, got, err)
+		}
+	}
+}
+
+func TestRotateDue(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	secret := func(name string, annotations map[string]string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				Annotations:       annotations,
+				CreationTimestamp: metav1.NewTime(now.Add(-48 * time.Hour)),
+			},
+			Data: map[string][]byte{"password": []byte("old"), "username": []byte("app")},
+		}
+	}
+
+	clientset := fake.NewSimpleClientset(
+		secret("due", map[string]string{
+			IntervalAnnotation: "1d",
+			ParamsAnnotation:   "length=16",
+		}),
+		secret("not-due", map[string]string{
+			IntervalAnnotation:     "1d",
+			NextRotationAnnotation: now.Add(time.Hour).Format(time.RFC3339),
+		}),
+		secret("unmanaged", nil),
+		secret("bad-generator", map[string]string{
+			IntervalAnnotation:  "1d",
+			GeneratorAnnotation: "missing",
+		}),
+	)
+	recorder := record.NewFakeRecorder(10)
+	rotator := NewRotator(k8s.NewClientForClientset(clientset), Options{
+		Recorder: recorder,
+		Now:      func() time.Time { return now },
+	})
+
+	rotated, err := rotator.RotateDue(context.TODO(), "default")
+	if err == nil || !strings.Contains(err.Error(), "bad-generator") {
+		t.Errorf("RotateDue() error = %v, want failure of bad-generator", err)
+	}
+	if len(rotated) != 1 || rotated[0] != "default/due" {
+		t.Fatalf("RotateDue() rotated = %v, want [default/due]", rotated)
+	}
+
+	updated, _ := clientset.CoreV1().Secrets("default").Get(context.TODO(), "due", metav1.GetOptions{})
+	if password := string(updated.Data["password"]); password == "old" || len(password) != 16 {
+		t.Errorf("password = %q, want a new 16 character password", password)
+	}
+	if string(updated.Data["username"]) != "app" {
+		t.Errorf("username = %q, want it untouched", updated.Data["username"])
+	}
+	if updated.Annotations[LastRotatedAnnotation] != "2024-03-01T12:00:00Z" ||
+		updated.Annotations[NextRotationAnnotation] != "2024-03-02T12:00:00Z" {
+		t.Errorf("rotation annotations = %v", updated.Annotations)
+	}
+
+	events := []string{<-recorder.Events, <-recorder.Events}
+	joined := strings.Join(events, "\n")
+	if !strings.Contains(joined, "Warning "+ReasonRotationFailed) || !strings.Contains(joined, "Normal "+ReasonRotated) {
+		t.Errorf("events = %v", events)
+	}
+}
+
+func TestRotateDue_PermanentFailure(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := backend.NewMemory()
+	store.CreateSecret(ctx, &k8s.SecretData{
+		Name:      "frozen",
+		Namespace: "default",
+		Data:      map[string]string{"password": "old"},
+		Immutable: true,
+		Annotations: map[string]string{
+			IntervalAnnotation:     "1d",
+			NextRotationAnnotation: now.Add(-time.Hour).Format(time.RFC3339),
+		},
+	})
+	recorder := record.NewFakeRecorder(10)
+	rotator := NewRotator(store, Options{Recorder: recorder, Now: func() time.Time { return now }})
+
+	if _, err := rotator.RotateDue(ctx, "default"); err == nil {
+		t.Fatal("RotateDue() of an immutable secret succeeded")
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("%d events recorded, want 1", len(recorder.Events))
+	}
+	<-recorder.Events
+
+	if _, err := rotator.RotateDue(ctx, "default"); err != nil {
+		t.Errorf("RotateDue() reported the same failure again: %v", err)
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("event recorded again for an unchanged secret: %s", <-recorder.Events)
+	}
+
+	if _, err := store.PatchSecret(ctx, "default", "frozen", &k8s.SecretPatch{SetLabels: map[string]string{"team": "api"}}); err != nil {
+		t.Fatalf("PatchSecret() error = %v", err)
+	}
+	if _, err := rotator.RotateDue(ctx, "default"); err == nil {
+		t.Error("RotateDue() did not retry a secret that changed")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "plain", Namespace: "default"},
+	})
+	rotator := NewRotator(k8s.NewClientForClientset(clientset), Options{})
+
+	if err := rotator.Rotate(context.TODO(), "default", "plain"); err == nil {
+		t.Error("Rotate() of a secret without a policy succeeded")
+	}
+}
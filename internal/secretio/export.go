@@ -0,0 +1,109 @@
+package secretio
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/dotenv"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// exportPageSize is the number of secrets fetched per list request
+const exportPageSize = 500
+
+// ExportOptions selects the secrets to export. With a Name a single secret
+// is exported, otherwise the secrets of Namespace matching LabelSelector.
+type ExportOptions struct {
+	Namespace     string
+	Name          string
+	LabelSelector string
+	Format        Format
+}
+
+// Export writes the selected secrets to w. Server managed fields such as
+// resourceVersion, uid and managedFields are left out so that manifests can
+// be applied to another cluster. Whole namespace exports skip service
+// account tokens and revision history, which only make sense where they
+// were created.
+func Export(ctx context.Context, manager k8s.SecretManager, w io.Writer, opts ExportOptions) error {
+	if opts.Name != "" {
+		secret, err := manager.GetSecret(ctx, opts.Namespace, opts.Name)
+		if err != nil {
+			return err
+		}
+		return exportSecret(w, opts.Format, secret)
+	}
+
+	if opts.Format == FormatEnv {
+		return apperrors.New(apperrors.CodeInvalid, "the env format holds a single secret, give a name")
+	}
+	if opts.Namespace == "" && opts.Format != FormatManifest && opts.Format != FormatSecretData {
+		return apperrors.New(apperrors.CodeInvalid, "exporting every namespace requires the manifest or secretdata format")
+	}
+
+	secrets, err := listSecrets(ctx, manager, opts.Namespace, opts.LabelSelector)
+	if err != nil {
+		return err
+	}
+
+	switch opts.Format {
+	case FormatManifest:
+		return WriteManifests(w, secrets)
+	case FormatSecretData:
+		return writeSecretData(w, secrets, false)
+	}
+	flat := make(map[string]map[string]string, len(secrets))
+	for i := range secrets {
+		values, err := flatten(&secrets[i])
+		if err != nil {
+			return err
+		}
+		flat[secrets[i].Name] = values
+	}
+	return encodeFlat(w, opts.Format, flat)
+}
+
+func exportSecret(w io.Writer, format Format, secret *corev1.Secret) error {
+	switch format {
+	case FormatManifest:
+		return WriteManifests(w, []corev1.Secret{*secret})
+	case FormatSecretData:
+		return writeSecretData(w, []corev1.Secret{*secret}, true)
+	}
+
+	values, err := flatten(secret)
+	if err != nil {
+		return err
+	}
+	if format == FormatEnv {
+		if err := dotenv.Write(w, values); err != nil {
+			return apperrors.Wrap(apperrors.CodeInvalid, fmt.Sprintf("error exporting secret %s", secret.Name), err)
+		}
+		return nil
+	}
+	return encodeFlat(w, format, values)
+}
+
+func listSecrets(ctx context.Context, manager k8s.SecretManager, namespace, selector string) ([]corev1.Secret, error) {
+	var secrets []corev1.Secret
+	opts := k8s.ListOptions{LabelSelector: selector, Limit: exportPageSize}
+	for {
+		list, err := manager.ListSecrets(ctx, namespace, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, secret := range list.Items {
+			if secret.Type == corev1.SecretTypeServiceAccountToken || secret.Type == k8s.HistorySecretType {
+				continue
+			}
+			secrets = append(secrets, secret)
+		}
+		if list.Continue == "" {
+			return secrets, nil
+		}
+		opts.Continue = list.Continue
+	}
+}
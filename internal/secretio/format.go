@@ -0,0 +1,266 @@
+// Package secretio exports secrets to and imports them from dotenv, JSON,
+// YAML, SecretData and Kubernetes manifest files. Imports transparently
+// decrypt files encrypted with the encfile package.
+package secretio
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// Format is a file format secrets are exported to and imported from
+type Format string
+
+const (
+	// FormatEnv holds the keys of a single secret as KEY=VALUE lines
+	FormatEnv Format = "env"
+	// FormatJSON and FormatYAML map keys to values for a single secret, or
+	// secret names to such maps for a namespace
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	// FormatManifest is a stream of v1/Secret YAML documents
+	FormatManifest Format = "manifest"
+	// FormatSecretData is the JSON body of the create and update endpoints,
+	// one object or an array of them
+	FormatSecretData Format = "secretdata"
+)
+
+// ParseFormat validates a format name
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case FormatEnv, FormatJSON, FormatYAML, FormatManifest, FormatSecretData:
+		return format, nil
+	}
+	return "", apperrors.New(apperrors.CodeInvalid, fmt.Sprintf("unknown format %s, expected env, json, yaml, manifest or secretdata", name))
+}
+
+// ContentType returns the media type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatEnv:
+		return "text/plain; charset=utf-8"
+	case FormatJSON, FormatSecretData:
+		return "application/json"
+	}
+	return "application/yaml"
+}
+
+// manifest is the exported form of a secret, without the fields the API
+// server manages
+type manifest struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   manifestMeta      `json:"metadata"`
+	Type       corev1.SecretType `json:"type,omitempty"`
+	Immutable  *bool             `json:"immutable,omitempty"`
+	Data       map[string][]byte `json:"data,omitempty"`
+}
+
+type manifestMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// WriteManifests writes secrets as a stream of v1/Secret YAML documents
+// without the fields the API server manages
+func WriteManifests(w io.Writer, secrets []corev1.Secret) error {
+	for i, secret := range secrets {
+		out, err := yaml.Marshal(manifest{
+			APIVersion: "v1",
+			Kind:       "Secret",
+			Metadata: manifestMeta{
+				Name:        secret.Name,
+				Namespace:   secret.Namespace,
+				Labels:      secret.Labels,
+				Annotations: secret.Annotations,
+			},
+			Type:      secret.Type,
+			Immutable: secret.Immutable,
+			Data:      secret.Data,
+		})
+		if err != nil {
+			return fmt.Errorf("error encoding secret %s: %w", secret.Name, err)
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadManifests reads v1/Secret documents, or v1/List documents of them
+func ReadManifests(r io.Reader) ([]corev1.Secret, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+
+	var secrets []corev1.Secret
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF {
+				return secrets, nil
+			}
+			return nil, invalidInput("error reading manifest: %v", err)
+		}
+		if len(bytes.TrimSpace(raw)) == 0 || string(raw) == "null" {
+			continue
+		}
+
+		decoded, err := decodeObject(raw)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, decoded...)
+	}
+}
+
+func decodeObject(raw json.RawMessage) ([]corev1.Secret, error) {
+	var object struct {
+		APIVersion string            `json:"apiVersion"`
+		Kind       string            `json:"kind"`
+		Items      []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, invalidInput("error reading manifest: %v", err)
+	}
+
+	switch {
+	case object.APIVersion == "v1" && object.Kind == "Secret":
+		var secret corev1.Secret
+		if err := json.Unmarshal(raw, &secret); err != nil {
+			return nil, invalidInput("error reading secret: %v", err)
+		}
+		return []corev1.Secret{secret}, nil
+	case object.APIVersion == "v1" && object.Kind == "List":
+		var secrets []corev1.Secret
+		for _, item := range object.Items {
+			decoded, err := decodeObject(item)
+			if err != nil {
+				return nil, err
+			}
+			secrets = append(secrets, decoded...)
+		}
+		return secrets, nil
+	}
+	return nil, invalidInput("unsupported object %s/%s, expected v1/Secret", object.APIVersion, object.Kind)
+}
+
+// flatten returns the values of secret as strings. Flat formats cannot hold
+// binary values.
+func flatten(secret *corev1.Secret) (map[string]string, error) {
+	values := make(map[string]string, len(secret.Data))
+	for key, value := range secret.Data {
+		if !utf8.Valid(value) {
+			return nil, apperrors.New(apperrors.CodeInvalid,
+				fmt.Sprintf("key %s of secret %s is binary, export it as a manifest", key, secret.Name))
+		}
+		values[key] = string(value)
+	}
+	return values, nil
+}
+
+// writeSecretData writes secrets as SecretData JSON, a single object when
+// single is set
+func writeSecretData(w io.Writer, secrets []corev1.Secret, single bool) error {
+	data := make([]*k8s.SecretData, 0, len(secrets))
+	for i := range secrets {
+		data = append(data, FromManifest(&secrets[i]))
+	}
+	var v interface{} = data
+	if single {
+		v = data[0]
+	}
+	return encodeFlat(w, FormatJSON, v)
+}
+
+// readSecretData reads SecretData JSON or YAML, one object or an array
+func readSecretData(r io.Reader) ([]*k8s.SecretData, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading input: %w", err)
+	}
+	content, err = yaml.YAMLToJSON(content)
+	if err != nil {
+		return nil, invalidInput("error reading secretdata: %v", err)
+	}
+
+	var secrets []*k8s.SecretData
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &secrets)
+	} else {
+		secret := &k8s.SecretData{}
+		err = json.Unmarshal(trimmed, secret)
+		secrets = append(secrets, secret)
+	}
+	if err != nil {
+		return nil, invalidInput("error reading secretdata: %v", err)
+	}
+	for _, secret := range secrets {
+		if secret == nil || secret.Name == "" {
+			return nil, invalidInput("every secret needs a name")
+		}
+	}
+	return secrets, nil
+}
+
+func encodeFlat(w io.Writer, format Format, v interface{}) error {
+	var out []byte
+	var err error
+	if format == FormatJSON {
+		out, err = json.MarshalIndent(v, "", "  ")
+		out = append(out, '\n')
+	} else {
+		out, err = yaml.Marshal(v)
+	}
+	if err != nil {
+		return fmt.Errorf("error encoding secrets: %w", err)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+func decodeFlat(r io.Reader, format Format, v interface{}) error {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading input: %w", err)
+	}
+	if format == FormatJSON {
+		err = json.Unmarshal(content, v)
+	} else {
+		err = yaml.UnmarshalStrict(content, v)
+	}
+	if err != nil {
+		return invalidInput("error reading %s: %v", format, err)
+	}
+	return nil
+}
+
+func invalidInput(format string, args ...interface{}) error {
+	return apperrors.New(apperrors.CodeBadRequest, fmt.Sprintf(format, args...))
+}
+
+func sortedNames(secrets map[string]map[string]string) []string {
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
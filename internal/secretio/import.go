@@ -0,0 +1,216 @@
+package secretio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/mpalu/k8s-secrets-manager/internal/dotenv"
+	"github.com/mpalu/k8s-secrets-manager/internal/encfile"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"github.com/mpalu/k8s-secrets-manager/internal/validator"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ConflictPolicy decides what happens when an imported secret already exists
+type ConflictPolicy string
+
+const (
+	ConflictSkip      ConflictPolicy = "skip"
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictFail aborts the import before anything is written
+	ConflictFail ConflictPolicy = "fail"
+)
+
+// ParseConflictPolicy validates a conflict policy name
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(strings.ToLower(name)); policy {
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+		return policy, nil
+	}
+	return "", apperrors.New(apperrors.CodeInvalid, fmt.Sprintf("unknown conflict policy %s, expected skip, overwrite or fail", name))
+}
+
+// ImportOptions describe an import
+type ImportOptions struct {
+	// Namespace receives secrets without a namespace of their own, and every
+	// secret when OverrideNamespace is set
+	Namespace         string
+	OverrideNamespace bool
+	// Name is required by the env format and turns JSON and YAML input into
+	// the keys of a single secret
+	Name string
+	// Type of the secrets read from flat formats, Opaque by default
+	Type     string
+	Format   Format
+	Conflict ConflictPolicy
+	// DryRun reports what would be imported without writing
+	DryRun bool
+	// Identities decrypt input encrypted with the encfile package
+	Identities []age.Identity
+}
+
+// ImportResult lists the imported secrets as namespace/name
+type ImportResult struct {
+	Created []string `json:"created"`
+	Updated []string `json:"updated"`
+	Skipped []string `json:"skipped"`
+}
+
+// Import reads secrets from r and writes them through manager, see
+// WriteSecrets
+func Import(ctx context.Context, manager k8s.SecretManager, r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	secrets, err := Read(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	return WriteSecrets(ctx, manager, secrets, opts.Conflict, opts.DryRun)
+}
+
+// WriteSecrets creates secrets, handling the existing ones by policy. Every
+// secret is validated and checked for conflicts before the first write.
+// With dryRun nothing is written and the result tells what would have been.
+func WriteSecrets(ctx context.Context, manager k8s.SecretManager, secrets []*k8s.SecretData, conflict ConflictPolicy, dryRun bool) (*ImportResult, error) {
+	if len(secrets) == 0 {
+		return nil, invalidInput("no secrets found in the input")
+	}
+
+	exists := make(map[string]bool, len(secrets))
+	seen := make(map[string]bool, len(secrets))
+	var conflicts []string
+	for _, data := range secrets {
+		if err := validator.ValidateSecretData(data); err != nil {
+			return nil, fmt.Errorf("secret %s/%s: %w", data.Namespace, data.Name, err)
+		}
+
+		ref := data.Namespace + "/" + data.Name
+		if seen[ref] {
+			return nil, invalidInput("secret %s appears more than once", ref)
+		}
+		seen[ref] = true
+		_, err := manager.GetSecret(ctx, data.Namespace, data.Name)
+		switch code := apperrors.CodeOf(err); {
+		case err == nil:
+			exists[ref] = true
+			conflicts = append(conflicts, ref)
+		case code == apperrors.CodeNotFound:
+			exists[ref] = false
+		default:
+			return nil, err
+		}
+	}
+	if conflict == ConflictFail && len(conflicts) > 0 {
+		return nil, apperrors.New(apperrors.CodeAlreadyExists, fmt.Sprintf("secrets already exist: %s", strings.Join(conflicts, ", ")))
+	}
+
+	result := &ImportResult{Created: []string{}, Updated: []string{}, Skipped: []string{}}
+	for _, data := range secrets {
+		ref := data.Namespace + "/" + data.Name
+		switch {
+		case !exists[ref]:
+			if !dryRun {
+				if err := manager.CreateSecret(ctx, data); err != nil {
+					return result, fmt.Errorf("error creating secret %s: %w", ref, err)
+				}
+			}
+			result.Created = append(result.Created, ref)
+		case conflict == ConflictOverwrite:
+			if !dryRun {
+				if err := manager.UpdateSecret(ctx, data); err != nil {
+					return result, fmt.Errorf("error updating secret %s: %w", ref, err)
+				}
+			}
+			result.Updated = append(result.Updated, ref)
+		default:
+			result.Skipped = append(result.Skipped, ref)
+		}
+	}
+	return result, nil
+}
+
+// Read decodes the secrets of r into their writable form without writing
+// them, decrypting r first when it is an encrypted file. Conflict and DryRun
+// of opts are ignored.
+func Read(r io.Reader, opts ImportOptions) ([]*k8s.SecretData, error) {
+	r, err := encfile.DecryptReader(r, opts.Identities)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.Format {
+	case FormatSecretData:
+		secrets, err := readSecretData(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, secret := range secrets {
+			if opts.OverrideNamespace || secret.Namespace == "" {
+				secret.Namespace = opts.Namespace
+			}
+		}
+		return secrets, nil
+	case FormatManifest:
+		manifests, err := ReadManifests(r)
+		if err != nil {
+			return nil, err
+		}
+		secrets := make([]*k8s.SecretData, 0, len(manifests))
+		for i := range manifests {
+			secret := &manifests[i]
+			if opts.OverrideNamespace || secret.Namespace == "" {
+				secret.Namespace = opts.Namespace
+			}
+			secrets = append(secrets, FromManifest(secret))
+		}
+		return secrets, nil
+	}
+
+	flat := make(map[string]map[string]string)
+	switch {
+	case opts.Format == FormatEnv:
+		if opts.Name == "" {
+			return nil, apperrors.New(apperrors.CodeInvalid, "the env format holds a single secret, give a name")
+		}
+		env, err := dotenv.Parse(r)
+		if err != nil {
+			return nil, invalidInput("%v", err)
+		}
+		flat[opts.Name] = env
+	case opts.Name != "":
+		var values map[string]string
+		if err := decodeFlat(r, opts.Format, &values); err != nil {
+			return nil, err
+		}
+		flat[opts.Name] = values
+	default:
+		if err := decodeFlat(r, opts.Format, &flat); err != nil {
+			return nil, err
+		}
+	}
+
+	secretType := opts.Type
+	if secretType == "" {
+		secretType = string(corev1.SecretTypeOpaque)
+	}
+	secrets := make([]*k8s.SecretData, 0, len(flat))
+	for _, name := range sortedNames(flat) {
+		secrets = append(secrets, &k8s.SecretData{
+			Name:      name,
+			Namespace: opts.Namespace,
+			Type:      secretType,
+			Data:      flat[name],
+		})
+	}
+	return secrets, nil
+}
+
+// FromManifest converts a secret read from a manifest into its writable form
+func FromManifest(secret *corev1.Secret) *k8s.SecretData {
+	data := k8s.NewSecretData(secret)
+	data.StringData = secret.StringData
+	data.ResourceVersion = ""
+	return data
+}
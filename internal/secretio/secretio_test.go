@@ -0,0 +1,225 @@
+package secretio
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/mpalu/k8s-secrets-manager/internal/encfile"
+	apperrors "github.com/mpalu/k8s-secrets-manager/internal/errors"
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newManager() *k8s.Client {
+	return k8s.NewClientForClientset(fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "db",
+				Namespace:       "default",
+				Labels:          map[string]string{"app": "api"},
+				UID:             "0b9f6c1e",
+				ResourceVersion: "42",
+				ManagedFields:   []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{"USER": []byte("admin"), "PASSWORD": []byte("s3cr3t")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "keystore", Namespace: "default"},
+			Data:       map[string][]byte{"store.jks": {0xfe, 0xed}},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default"},
+			Type:       corev1.SecretTypeServiceAccountToken,
+		},
+	))
+}
+
+func TestExport(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     ExportOptions
+		want     []string
+		wantNot  []string
+		wantCode string
+	}{
+		{
+			name: "env",
+			opts: ExportOptions{Name: "db", Format: FormatEnv},
+			want: []string{"PASSWORD=s3cr3t\nUSER=admin\n"},
+		},
+		{
+			name: "json",
+			opts: ExportOptions{Name: "db", Format: FormatJSON},
+			want: []string{`"USER": "admin"`},
+		},
+		{
+			name:    "namespace as yaml",
+			opts:    ExportOptions{LabelSelector: "app=api", Format: FormatYAML},
+			want:    []string{"db:\n  PASSWORD: s3cr3t\n  USER: admin\n"},
+			wantNot: []string{"keystore"},
+		},
+		{
+			name:    "namespace as manifests",
+			opts:    ExportOptions{Format: FormatManifest},
+			want:    []string{"kind: Secret", "name: db", "name: keystore", "---", "USER: YWRtaW4="},
+			wantNot: []string{"resourceVersion", "uid", "managedFields", "creationTimestamp", "name: token"},
+		},
+		{
+			name:    "namespace as secretdata",
+			opts:    ExportOptions{Format: FormatSecretData},
+			want:    []string{`"name": "db"`, `"USER": "admin"`, `"binaryData"`},
+			wantNot: []string{"resourceVersion", "name\": \"token"},
+		},
+		{
+			name:     "binary value in a flat format",
+			opts:     ExportOptions{Name: "keystore", Format: FormatJSON},
+			wantCode: apperrors.CodeInvalid,
+		},
+		{
+			name:     "env needs a name",
+			opts:     ExportOptions{Format: FormatEnv},
+			wantCode: apperrors.CodeInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Namespace = "default"
+			var out bytes.Buffer
+			err := Export(context.TODO(), newManager(), &out, tt.opts)
+			if tt.wantCode != "" {
+				if apperrors.CodeOf(err) != tt.wantCode {
+					t.Errorf("Export() error = %v, want %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("Export() output lacks %q:\n%s", want, out.String())
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(out.String(), unwanted) {
+					t.Errorf("Export() output contains %q:\n%s", unwanted, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	var exported bytes.Buffer
+	if err := Export(context.TODO(), newManager(), &exported, ExportOptions{Namespace: "default", Format: FormatManifest}); err != nil {
+		t.Fatal(err)
+	}
+	identity, _ := age.GenerateX25519Identity()
+	encrypted, err := encfile.Encrypt([]byte(`{"name": "api", "data": {"TOKEN": "t0k3n"}}`), []age.Recipient{identity.Recipient()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		opts     ImportOptions
+		want     ImportResult
+		wantCode string
+	}{
+		{
+			name:  "manifests skip existing",
+			input: exported.String(),
+			opts:  ImportOptions{Format: FormatManifest, Conflict: ConflictSkip},
+			want:  ImportResult{Skipped: []string{"default/db", "default/keystore"}},
+		},
+		{
+			name:  "manifests into another namespace",
+			input: exported.String(),
+			opts:  ImportOptions{Namespace: "staging", OverrideNamespace: true, Format: FormatManifest, Conflict: ConflictFail},
+			want:  ImportResult{Created: []string{"staging/db", "staging/keystore"}},
+		},
+		{
+			name:     "fail on conflict",
+			input:    exported.String(),
+			opts:     ImportOptions{Format: FormatManifest, Conflict: ConflictFail},
+			wantCode: apperrors.CodeAlreadyExists,
+		},
+		{
+			name:  "list of secrets",
+			input: `{"apiVersion":"v1","kind":"List","items":[{"apiVersion":"v1","kind":"Secret","metadata":{"name":"a"},"stringData":{"k":"v"}}]}`,
+			opts:  ImportOptions{Namespace: "default", Format: FormatManifest},
+			want:  ImportResult{Created: []string{"default/a"}},
+		},
+		{
+			name:  "env overwrites",
+			input: "USER=root\n",
+			opts:  ImportOptions{Namespace: "default", Name: "db", Format: FormatEnv, Conflict: ConflictOverwrite},
+			want:  ImportResult{Updated: []string{"default/db"}},
+		},
+		{
+			name:  "yaml namespace",
+			input: "cache:\n  url: redis://cache\nqueue:\n  url: amqp://queue\n",
+			opts:  ImportOptions{Namespace: "default", Format: FormatYAML},
+			want:  ImportResult{Created: []string{"default/cache", "default/queue"}},
+		},
+		{
+			name:  "secretdata",
+			input: `[{"name": "api", "data": {"TOKEN": "t0k3n"}}, {"name": "db", "namespace": "prod", "data": {"USER": "admin"}}]`,
+			opts:  ImportOptions{Namespace: "default", Format: FormatSecretData},
+			want:  ImportResult{Created: []string{"default/api", "prod/db"}},
+		},
+		{
+			name:  "encrypted",
+			input: string(encrypted),
+			opts:  ImportOptions{Namespace: "default", Format: FormatSecretData, Identities: []age.Identity{identity}},
+			want:  ImportResult{Created: []string{"default/api"}},
+		},
+		{
+			name:     "encrypted without an identity",
+			input:    string(encrypted),
+			opts:     ImportOptions{Namespace: "default", Format: FormatSecretData},
+			wantCode: apperrors.CodeInvalid,
+		},
+		{
+			name:     "other kinds are rejected",
+			input:    "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: x\n",
+			opts:     ImportOptions{Namespace: "default", Format: FormatManifest},
+			wantCode: apperrors.CodeBadRequest,
+		},
+		{
+			name:     "invalid keys are rejected before writing",
+			input:    `{"good": {"k": "v"}, "bad": {"no/slash": "v"}}`,
+			opts:     ImportOptions{Namespace: "default", Format: FormatJSON},
+			wantCode: apperrors.CodeInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newManager()
+			result, err := Import(context.TODO(), manager, strings.NewReader(tt.input), tt.opts)
+			if tt.wantCode != "" {
+				if apperrors.CodeOf(err) != tt.wantCode {
+					t.Errorf("Import() error = %v, want %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Import() error = %v", err)
+			}
+			if strings.Join(result.Created, ",") != strings.Join(tt.want.Created, ",") ||
+				strings.Join(result.Updated, ",") != strings.Join(tt.want.Updated, ",") ||
+				strings.Join(result.Skipped, ",") != strings.Join(tt.want.Skipped, ",") {
+				t.Errorf("Import() = %+v, want %+v", result, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package validator
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NewTLSSecret builds a kubernetes.io/tls secret from PEM encoded data
+func NewTLSSecret(namespace, name string, cert, key []byte) (*k8s.SecretData, error) {
+	return buildSecret(namespace, name, corev1.SecretTypeTLS, map[string]string{
+		corev1.TLSCertKey:       string(cert),
+		corev1.TLSPrivateKeyKey: string(key),
+	})
+}
+
+// NewDockerRegistrySecret builds a kubernetes.io/dockerconfigjson secret
+// holding the credentials of a single registry
+func NewDockerRegistrySecret(namespace, name, server, username, password, email string) (*k8s.SecretData, error) {
+	config := dockerConfigJSON{
+		Auths: map[string]dockerConfigEntry{
+			server: {
+				Username: username,
+				Password: password,
+				Email:    email,
+				Auth:     base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+			},
+		},
+	}
+	content, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding docker config: %w", err)
+	}
+
+	return buildSecret(namespace, name, corev1.SecretTypeDockerConfigJson, map[string]string{
+		corev1.DockerConfigJsonKey: string(content),
+	})
+}
+
+// NewBasicAuthSecret builds a kubernetes.io/basic-auth secret
+func NewBasicAuthSecret(namespace, name, username, password string) (*k8s.SecretData, error) {
+	data := make(map[string]string)
+	if username != "" {
+		data[corev1.BasicAuthUsernameKey] = username
+	}
+	if password != "" {
+		data[corev1.BasicAuthPasswordKey] = password
+	}
+	return buildSecret(namespace, name, corev1.SecretTypeBasicAuth, data)
+}
+
+// NewSSHAuthSecret builds a kubernetes.io/ssh-auth secret from a PEM or
+// OpenSSH encoded private key
+func NewSSHAuthSecret(namespace, name string, privateKey []byte) (*k8s.SecretData, error) {
+	return buildSecret(namespace, name, corev1.SecretTypeSSHAuth, map[string]string{
+		corev1.SSHAuthPrivateKey: string(privateKey),
+	})
+}
+
+func buildSecret(namespace, name string, secretType corev1.SecretType, data map[string]string) (*k8s.SecretData, error) {
+	secret := &k8s.SecretData{
+		Name:      name,
+		Namespace: namespace,
+		Type:      string(secretType),
+		Data:      data,
+	}
+	if err := ValidateSecretData(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
@@ -0,0 +1,187 @@
+package validator
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	bootstrapTokenIDPattern     = regexp.MustCompile(`^[a-z0-9]{6}$`)
+	bootstrapTokenSecretPattern = regexp.MustCompile(`^[a-z0-9]{16}$`)
+)
+
+// typeRule describes what a well-known secret type requires of its data
+type typeRule struct {
+	required []string
+	validate func(data *k8s.SecretData, values map[string]string) error
+}
+
+var typeRules = map[corev1.SecretType]typeRule{
+	corev1.SecretTypeOpaque: {},
+	corev1.SecretTypeServiceAccountToken: {
+		validate: validateServiceAccountToken,
+	},
+	corev1.SecretTypeDockercfg: {
+		required: []string{corev1.DockerConfigKey},
+		validate: validateDockercfg,
+	},
+	corev1.SecretTypeDockerConfigJson: {
+		required: []string{corev1.DockerConfigJsonKey},
+		validate: validateDockerConfigJSON,
+	},
+	corev1.SecretTypeBasicAuth: {
+		validate: validateBasicAuth,
+	},
+	corev1.SecretTypeSSHAuth: {
+		required: []string{corev1.SSHAuthPrivateKey},
+		validate: validateSSHAuth,
+	},
+	corev1.SecretTypeTLS: {
+		required: []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey},
+		validate: validateTLS,
+	},
+	corev1.SecretTypeBootstrapToken: {
+		required: []string{"token-id", "token-secret"},
+		validate: validateBootstrapToken,
+	},
+}
+
+// ValidateSecretType checks that a secret of a well-known type carries the
+// keys its type requires and that their content parses. Other types are
+// accepted as they are.
+func ValidateSecretType(data *k8s.SecretData) error {
+	rule, known := typeRules[corev1.SecretType(data.Type)]
+	if !known {
+		return nil
+	}
+
+	values := make(map[string]string)
+	for key, value := range data.Values() {
+		values[key] = string(value)
+	}
+
+	for _, key := range rule.required {
+		if _, ok := values[key]; !ok {
+			return &k8s.ValidationError{
+				Field:   "data",
+				Message: fmt.Sprintf("secrets of type %s require key %s", data.Type, key),
+			}
+		}
+	}
+
+	if rule.validate == nil {
+		return nil
+	}
+	return rule.validate(data, values)
+}
+
+func validateServiceAccountToken(data *k8s.SecretData, values map[string]string) error {
+	if data.Annotations[corev1.ServiceAccountNameKey] == "" {
+		return &k8s.ValidationError{
+			Field:   "annotations",
+			Message: fmt.Sprintf("secrets of type %s require annotation %s", data.Type, corev1.ServiceAccountNameKey),
+		}
+	}
+	return nil
+}
+
+// dockerConfigEntry is a registry entry of a .dockercfg or .dockerconfigjson
+type dockerConfigEntry struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// dockerConfigJSON is the content of a .dockerconfigjson key
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+func validateDockercfg(data *k8s.SecretData, values map[string]string) error {
+	var auths map[string]dockerConfigEntry
+	if err := json.Unmarshal([]byte(values[corev1.DockerConfigKey]), &auths); err != nil {
+		return &k8s.ValidationError{Field: "data", Message: fmt.Sprintf("%s is not valid JSON: %v", corev1.DockerConfigKey, err)}
+	}
+	return validateDockerAuths(corev1.DockerConfigKey, auths)
+}
+
+func validateDockerConfigJSON(data *k8s.SecretData, values map[string]string) error {
+	var config dockerConfigJSON
+	if err := json.Unmarshal([]byte(values[corev1.DockerConfigJsonKey]), &config); err != nil {
+		return &k8s.ValidationError{Field: "data", Message: fmt.Sprintf("%s is not valid JSON: %v", corev1.DockerConfigJsonKey, err)}
+	}
+	return validateDockerAuths(corev1.DockerConfigJsonKey, config.Auths)
+}
+
+func validateDockerAuths(key string, auths map[string]dockerConfigEntry) error {
+	if len(auths) == 0 {
+		return &k8s.ValidationError{Field: "data", Message: fmt.Sprintf("%s has no registry credentials", key)}
+	}
+
+	for server, entry := range auths {
+		if entry.Auth == "" {
+			if entry.Username == "" && entry.Password == "" {
+				return &k8s.ValidationError{Field: "data", Message: fmt.Sprintf("%s: registry %s has no credentials", key, server)}
+			}
+			continue
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil || !strings.Contains(string(decoded), ":") {
+			return &k8s.ValidationError{Field: "data", Message: fmt.Sprintf("%s: auth of registry %s must be base64 of username:password", key, server)}
+		}
+	}
+	return nil
+}
+
+func validateBasicAuth(data *k8s.SecretData, values map[string]string) error {
+	if values[corev1.BasicAuthUsernameKey] == "" && values[corev1.BasicAuthPasswordKey] == "" {
+		return &k8s.ValidationError{
+			Field: "data",
+			Message: fmt.Sprintf("secrets of type %s require key %s or %s",
+				data.Type, corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey),
+		}
+	}
+	return nil
+}
+
+func validateSSHAuth(data *k8s.SecretData, values map[string]string) error {
+	if _, err := ssh.ParseRawPrivateKey([]byte(values[corev1.SSHAuthPrivateKey])); err != nil {
+		return &k8s.ValidationError{Field: "data", Message: fmt.Sprintf("%s is not a valid private key: %v", corev1.SSHAuthPrivateKey, err)}
+	}
+	return nil
+}
+
+func validateTLS(data *k8s.SecretData, values map[string]string) error {
+	// X509KeyPair also checks that the key matches the leaf certificate
+	if _, err := tls.X509KeyPair([]byte(values[corev1.TLSCertKey]), []byte(values[corev1.TLSPrivateKeyKey])); err != nil {
+		return &k8s.ValidationError{Field: "data", Message: fmt.Sprintf("invalid certificate and key pair: %v", err)}
+	}
+	return nil
+}
+
+func validateBootstrapToken(data *k8s.SecretData, values map[string]string) error {
+	id := values["token-id"]
+	if !bootstrapTokenIDPattern.MatchString(id) {
+		return &k8s.ValidationError{Field: "data", Message: "token-id must be 6 characters of [a-z0-9]"}
+	}
+	if !bootstrapTokenSecretPattern.MatchString(values["token-secret"]) {
+		return &k8s.ValidationError{Field: "data", Message: "token-secret must be 16 characters of [a-z0-9]"}
+	}
+	if data.Name != "bootstrap-token-"+id {
+		return &k8s.ValidationError{Field: "name", Message: "bootstrap token secrets must be named bootstrap-token-" + id}
+	}
+	if data.Namespace != "kube-system" {
+		return &k8s.ValidationError{Field: "namespace", Message: "bootstrap token secrets must live in kube-system"}
+	}
+	return nil
+}
@@ -2,10 +2,17 @@ package validator
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
+// totalAnnotationSizeLimit mirrors the API server's limit on the combined
+// size of all annotation keys and values
+const totalAnnotationSizeLimit int64 = 256 * (1 << 10)
+
 func ValidateSecretData(data *k8s.SecretData) error {
 	if data.Name == "" {
 		return &k8s.ValidationError{
@@ -21,52 +28,152 @@ func ValidateSecretData(data *k8s.SecretData) error {
 		}
 	}
 
-	if len(data.Data) == 0 {
+	// Service account tokens are filled in by the token controller
+	if len(data.Values()) == 0 && corev1.SecretType(data.Type) != corev1.SecretTypeServiceAccountToken {
 		return &k8s.ValidationError{
 			Field:   "data",
 			Message: "at least one data entry is required",
 		}
 	}
 
-	for key := range data.Data {
-		if key == "" {
+	if err := validateKeys("data", data.Data); err != nil {
+		return err
+	}
+	if err := validateKeys("stringData", data.StringData); err != nil {
+		return err
+	}
+	for key := range data.BinaryData {
+		if err := validateKey("binaryData", key); err != nil {
+			return err
+		}
+		if _, ok := data.Data[key]; ok {
 			return &k8s.ValidationError{
-				Field:   "data",
-				Message: "empty key is not allowed",
+				Field:   "binaryData",
+				Message: fmt.Sprintf("key %s is set in both data and binaryData", key),
 			}
 		}
+	}
 
-		if !isValidKey(key) {
+	if err := ValidateSecretMetadata(data); err != nil {
+		return err
+	}
+	return ValidateSecretType(data)
+}
+
+// ValidateSecretMetadata checks the labels and annotations of an update,
+// which unlike a create may omit the data
+func ValidateSecretMetadata(data *k8s.SecretData) error {
+	if err := validateLabels("labels", data.Labels); err != nil {
+		return err
+	}
+	return validateAnnotations("annotations", data.Annotations)
+}
+
+// validateLabels applies the Kubernetes rules for label keys (qualified
+// names) and values
+func validateLabels(field string, labels map[string]string) error {
+	for key, value := range labels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
 			return &k8s.ValidationError{
-				Field:   "data",
-				Message: fmt.Sprintf("invalid key format: %s", key),
+				Field:   field,
+				Message: fmt.Sprintf("invalid label key %q: %s", key, strings.Join(errs, "; ")),
+			}
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return &k8s.ValidationError{
+				Field:   field,
+				Message: fmt.Sprintf("invalid value for label %q: %s", key, strings.Join(errs, "; ")),
 			}
 		}
 	}
+	return nil
+}
+
+// validateAnnotations applies the Kubernetes rules for annotation keys
+// (qualified names) and their total size
+func validateAnnotations(field string, annotations map[string]string) error {
+	var size int64
+	for key, value := range annotations {
+		if errs := validation.IsQualifiedName(strings.ToLower(key)); len(errs) > 0 {
+			return &k8s.ValidationError{
+				Field:   field,
+				Message: fmt.Sprintf("invalid annotation key %q: %s", key, strings.Join(errs, "; ")),
+			}
+		}
+		size += int64(len(key)) + int64(len(value))
+	}
 
+	if size > totalAnnotationSizeLimit {
+		return &k8s.ValidationError{
+			Field:   field,
+			Message: fmt.Sprintf("annotations exceed %d bytes", totalAnnotationSizeLimit),
+		}
+	}
+	return nil
+}
+
+func validateKeys(field string, data map[string]string) error {
+	for key := range data {
+		if err := validateKey(field, key); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func validateKey(field, key string) error {
+	if key == "" {
+		return &k8s.ValidationError{
+			Field:   field,
+			Message: "empty key is not allowed",
+		}
+	}
+
+	if !isValidKey(key) {
+		return &k8s.ValidationError{
+			Field:   field,
+			Message: fmt.Sprintf("invalid key format: %s", key),
+		}
+	}
+	return nil
+}
+
+// isValidKey applies the Kubernetes rules for data keys: alphanumerics, '-',
+// '_' and '.', as used by keys such as .dockerconfigjson or tls.crt
 func isValidKey(key string) bool {
-	// DNS subdomain name validation as per Kubernetes naming conventions
-	// https://kubernetes.io/docs/concepts/overview/working-with-objects/names/#dns-subdomain-names
-	if len(key) > 253 {
-		return false
-	}
-
-	// Must consist of lowercase alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character
-	validKey := true
-	for i, char := range key {
-		isAlphanumeric := (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9')
-		isDash := char == '-'
-		isDot := char == '.'
-
-		// First and last characters must be alphanumeric
-		if i == 0 || i == len(key)-1 {
-			validKey = validKey && isAlphanumeric
-		} else {
-			validKey = validKey && (isAlphanumeric || isDash || isDot)
+	return len(validation.IsConfigMapKey(key)) == 0
+}
+
+// ValidateSecretPatch checks the keys a patch writes
+func ValidateSecretPatch(patch *k8s.SecretPatch) error {
+	if patch.IsEmpty() {
+		return &k8s.ValidationError{
+			Field:   "patch",
+			Message: "patch does not change anything",
+		}
+	}
+
+	for key := range patch.Set {
+		if !isValidKey(key) {
+			return &k8s.ValidationError{
+				Field:   "set",
+				Message: fmt.Sprintf("invalid key format: %s", key),
+			}
 		}
 	}
-	return validKey
+
+	for _, key := range patch.Rename {
+		if !isValidKey(key) {
+			return &k8s.ValidationError{
+				Field:   "rename",
+				Message: fmt.Sprintf("invalid key format: %s", key),
+			}
+		}
+	}
+
+	if err := validateLabels("setLabels", patch.SetLabels); err != nil {
+		return err
+	}
+
+	return validateAnnotations("setAnnotations", patch.SetAnnotations)
 }
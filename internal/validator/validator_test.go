@@ -1,9 +1,19 @@
 package validator
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/mpalu/k8s-secrets-manager/internal/k8s"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestValidateSecretData(t *testing.T) {
@@ -69,6 +79,50 @@ func TestValidateSecretData(t *testing.T) {
 			wantErr:  true,
 			errField: "data",
 		},
+		{
+			name: "valid labels and annotations",
+			data: &k8s.SecretData{
+				Name:        "test-secret",
+				Namespace:   "default",
+				Data:        map[string]string{"key1": "value1"},
+				Labels:      map[string]string{"app.kubernetes.io/name": "api", "team": ""},
+				Annotations: map[string]string{"example.com/Owner": "Payments Team <payments@example.com>"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid label key",
+			data: &k8s.SecretData{
+				Name:      "test-secret",
+				Namespace: "default",
+				Data:      map[string]string{"key1": "value1"},
+				Labels:    map[string]string{"-team": "payments"},
+			},
+			wantErr:  true,
+			errField: "labels",
+		},
+		{
+			name: "invalid label value",
+			data: &k8s.SecretData{
+				Name:      "test-secret",
+				Namespace: "default",
+				Data:      map[string]string{"key1": "value1"},
+				Labels:    map[string]string{"team": "payments team"},
+			},
+			wantErr:  true,
+			errField: "labels",
+		},
+		{
+			name: "invalid annotation key",
+			data: &k8s.SecretData{
+				Name:        "test-secret",
+				Namespace:   "default",
+				Data:        map[string]string{"key1": "value1"},
+				Annotations: map[string]string{"example.com/owner/team": "payments"},
+			},
+			wantErr:  true,
+			errField: "annotations",
+		},
 	}
 
 	for _, tt := range tests {
@@ -88,3 +142,180 @@ func TestValidateSecretData(t *testing.T) {
 		})
 	}
 }
+
+// testKeyPair returns a PEM encoded self-signed certificate and its key
+func testKeyPair(t *testing.T) (cert, key []byte) {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestValidateSecretType(t *testing.T) {
+	cert, key := testKeyPair(t)
+	_, otherKey := testKeyPair(t)
+
+	_, sshKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshBlock, err := ssh.MarshalPrivateKey(sshKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPEM := string(pem.EncodeToMemory(sshBlock))
+
+	secret := func(secretType string, data map[string]string) *k8s.SecretData {
+		return &k8s.SecretData{Name: "test-secret", Namespace: "default", Type: secretType, Data: data}
+	}
+
+	tests := []struct {
+		name     string
+		data     *k8s.SecretData
+		wantErr  bool
+		errField string
+	}{
+		{
+			name: "unknown type",
+			data: secret("example.com/custom", map[string]string{"key1": "value1"}),
+		},
+		{
+			name: "valid tls",
+			data: secret("kubernetes.io/tls", map[string]string{"tls.crt": string(cert), "tls.key": string(key)}),
+		},
+		{
+			name:     "tls missing key",
+			data:     secret("kubernetes.io/tls", map[string]string{"tls.crt": string(cert)}),
+			wantErr:  true,
+			errField: "data",
+		},
+		{
+			name:     "tls key does not match certificate",
+			data:     secret("kubernetes.io/tls", map[string]string{"tls.crt": string(cert), "tls.key": string(otherKey)}),
+			wantErr:  true,
+			errField: "data",
+		},
+		{
+			name: "valid dockerconfigjson",
+			data: secret("kubernetes.io/dockerconfigjson", map[string]string{
+				".dockerconfigjson": `{"auths": {"registry.example.com": {"auth": "dXNlcjpwYXNz"}}}`,
+			}),
+		},
+		{
+			name: "dockerconfigjson with invalid JSON",
+			data: secret("kubernetes.io/dockerconfigjson", map[string]string{
+				".dockerconfigjson": `{"auths":`,
+			}),
+			wantErr:  true,
+			errField: "data",
+		},
+		{
+			name: "dockerconfigjson with malformed auth",
+			data: secret("kubernetes.io/dockerconfigjson", map[string]string{
+				".dockerconfigjson": `{"auths": {"registry.example.com": {"auth": "bm9jb2xvbg=="}}}`,
+			}),
+			wantErr:  true,
+			errField: "data",
+		},
+		{
+			name: "valid basic-auth",
+			data: secret("kubernetes.io/basic-auth", map[string]string{"username": "admin"}),
+		},
+		{
+			name:     "basic-auth without credentials",
+			data:     secret("kubernetes.io/basic-auth", map[string]string{"token": "x"}),
+			wantErr:  true,
+			errField: "data",
+		},
+		{
+			name: "valid ssh-auth",
+			data: secret("kubernetes.io/ssh-auth", map[string]string{"ssh-privatekey": sshPEM}),
+		},
+		{
+			name:     "ssh-auth with invalid key",
+			data:     secret("kubernetes.io/ssh-auth", map[string]string{"ssh-privatekey": "not a key"}),
+			wantErr:  true,
+			errField: "data",
+		},
+		{
+			name: "valid bootstrap token",
+			data: &k8s.SecretData{
+				Name:      "bootstrap-token-abcdef",
+				Namespace: "kube-system",
+				Type:      "bootstrap.kubernetes.io/token",
+				Data:      map[string]string{"token-id": "abcdef", "token-secret": "0123456789abcdef"},
+			},
+		},
+		{
+			name: "bootstrap token with wrong name",
+			data: &k8s.SecretData{
+				Name:      "token",
+				Namespace: "kube-system",
+				Type:      "bootstrap.kubernetes.io/token",
+				Data:      map[string]string{"token-id": "abcdef", "token-secret": "0123456789abcdef"},
+			},
+			wantErr:  true,
+			errField: "name",
+		},
+		{
+			name: "service account token without data",
+			data: &k8s.SecretData{
+				Name:        "sa-token",
+				Namespace:   "default",
+				Type:        "kubernetes.io/service-account-token",
+				Annotations: map[string]string{"kubernetes.io/service-account.name": "builder"},
+			},
+		},
+		{
+			name:     "service account token without annotation",
+			data:     secret("kubernetes.io/service-account-token", nil),
+			wantErr:  true,
+			errField: "annotations",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSecretData(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSecretData() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if validErr, ok := err.(*k8s.ValidationError); ok && validErr.Field != tt.errField {
+				t.Errorf("ValidateSecretData() error field = %v, want %v", validErr.Field, tt.errField)
+			}
+		})
+	}
+}
+
+func TestNewDockerRegistrySecret(t *testing.T) {
+	secret, err := NewDockerRegistrySecret("default", "pull", "registry.example.com", "user", "pass", "")
+	if err != nil {
+		t.Fatalf("NewDockerRegistrySecret() error = %v", err)
+	}
+	if secret.Type != "kubernetes.io/dockerconfigjson" {
+		t.Errorf("Type = %s, want kubernetes.io/dockerconfigjson", secret.Type)
+	}
+	if err := ValidateSecretType(secret); err != nil {
+		t.Errorf("ValidateSecretType() error = %v", err)
+	}
+}